@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+)
+
+// retryInterval is the delay before the first retry of a failed write, it doubles up to maxRetryInterval
+var retryInterval = time.Second
+
+const maxRetryInterval = time.Minute
+
+// ErrBufferFull is returned by AsyncSink.Write when the sink is too far behind to queue the entry
+var ErrBufferFull = errors.New("audit buffer is full")
+
+// AsyncSink writes entries to sink in background, so a slow sink doesn't delay applying of changes.
+// Entries are written in order, a failed write is retried with exponential backoff until it succeeds,
+// so entries are lost only if the buffer overflows or the sink still fails on Close.
+type AsyncSink struct {
+	sink  Sink
+	queue chan asyncEntry
+
+	mu     sync.RWMutex
+	closed bool
+	// stop interrupts retries on Close, done is closed when the queue is drained
+	stop chan struct{}
+	done chan struct{}
+}
+
+type asyncEntry struct {
+	ctx   context.Context
+	entry Entry
+}
+
+// NewAsyncSink starts writing entries queued to a buffer of size entries to sink
+func NewAsyncSink(sink Sink, size int) *AsyncSink {
+	s := &AsyncSink{
+		sink:  sink,
+		queue: make(chan asyncEntry, size),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues entry, it fails only if the buffer is full or the sink is closed
+func (s *AsyncSink) Write(ctx context.Context, e Entry) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errors.New("audit sink is closed")
+	}
+	select {
+	case s.queue <- asyncEntry{ctx: context.WithoutCancel(ctx), entry: e}:
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+func (s *AsyncSink) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		if err := s.write(e); err != nil {
+			metrics.AuditEntries.WithLabelValues(metrics.StatusError).Inc()
+			log.Logger(e.ctx).WithField(log.DNSNameKey, e.entry.Name).WithField(log.ErrorKey, err).Error("failed to write audit entry")
+			continue
+		}
+		metrics.AuditEntries.WithLabelValues(metrics.StatusOK).Inc()
+	}
+}
+
+// write writes e retrying failures until it succeeds or the sink is closed
+func (s *AsyncSink) write(e asyncEntry) error {
+	delay := retryInterval
+	for {
+		err := s.sink.Write(e.ctx, e.entry)
+		if err == nil {
+			return nil
+		}
+		log.Logger(e.ctx).WithField(log.ErrorKey, err).Debugf("failed to write audit entry, retrying in %s", delay)
+		select {
+		case <-s.stop:
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRetryInterval)
+	}
+}
+
+// Close writes queued entries and closes the sink, after Close each entry is tried once if the sink fails
+func (s *AsyncSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.stop)
+	close(s.queue)
+	s.mu.Unlock()
+
+	<-s.done
+	return s.sink.Close()
+}
@@ -0,0 +1,67 @@
+// Package audit writes entries describing DNS changes applied by the webhook to pluggable sinks
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// ResultOK is a change applied successfully or logged in dry run mode
+	ResultOK = "ok"
+	// ResultError is a change failed to apply
+	ResultError = "error"
+)
+
+// Entry describes a single RRSet operation
+type Entry struct {
+	Time          time.Time `json:"time"`
+	TraceID       string    `json:"traceId,omitempty"`
+	Account       string    `json:"account"`
+	Zone          string    `json:"zone"`
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	SetIdentifier string    `json:"setIdentifier,omitempty"`
+	Action        string    `json:"action"`
+	OldTargets    []string  `json:"oldTargets,omitempty"`
+	NewTargets    []string  `json:"newTargets,omitempty"`
+	OldTTL        int64     `json:"oldTTL,omitempty"`
+	NewTTL        int64     `json:"newTTL,omitempty"`
+	DryRun        bool      `json:"dryRun"`
+	Result        string    `json:"result"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Sink stores audit entries, Write is called concurrently
+type Sink interface {
+	Write(ctx context.Context, e Entry) error
+	Close() error
+}
+
+type multiSink []Sink
+
+// Multi writes entries to every sink
+func Multi(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) Write(ctx context.Context, e Entry) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
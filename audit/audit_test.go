@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var res []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid line %q: %s", scanner.Text(), err)
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	line, _ := json.Marshal(Entry{Name: "www.example.com"})
+	// two entries fit into a file
+	sink, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		if err = sink.Write(context.Background(), Entry{Name: name + "ww.example.com"}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string][]string{path: {"g"}, path + ".1": {"e", "f"}, path + ".2": {"c", "d"}} {
+		entries := readEntries(t, file)
+		if len(entries) != len(want) {
+			t.Fatalf("%s has %d entries, want %d", file, len(entries), len(want))
+		}
+		for i, e := range entries {
+			if e.Name != want[i]+"ww.example.com" {
+				t.Errorf("%s entry %d = %s, want %s", file, i, e.Name, want[i])
+			}
+		}
+	}
+	if _, err = os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("backup over maxBackups is kept")
+	}
+	if err = sink.Write(context.Background(), Entry{}); err == nil {
+		t.Errorf("Write() after Close() error = nil")
+	}
+
+	// entries are appended after restart
+	sink, err = NewFileSink(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sink.Write(context.Background(), Entry{Name: "h"})
+	_ = sink.Close()
+	if entries := readEntries(t, path); len(entries) != 2 {
+		t.Errorf("entries after restart = %v", entries)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var got Entry
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(srv.URL, "secret", time.Second)
+	want := Entry{Name: "www.example.com", Action: "create", NewTargets: []string{"1.1.1.1"}, Result: ResultOK}
+	if err := sink.Write(context.Background(), want); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got.Name != want.Name || got.NewTargets[0] != "1.1.1.1" {
+		t.Errorf("posted entry = %+v, want %+v", got, want)
+	}
+
+	status = http.StatusInternalServerError
+	if err := Multi(sink, NewHTTPSink(srv.URL, "", time.Second)).Write(context.Background(), want); err == nil {
+		t.Errorf("Write() with failing server error = nil")
+	}
+}
+
+// flakySink fails the first failures writes, writes wait for block to be closed if it's set
+type flakySink struct {
+	mu       sync.Mutex
+	failures int
+	entries  []string
+	block    chan struct{}
+	closed   bool
+}
+
+func (s *flakySink) Write(_ context.Context, e Entry) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink is down")
+	}
+	s.entries = append(s.entries, e.Name)
+	return nil
+}
+
+func (s *flakySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestAsyncSink(t *testing.T) {
+	retryInterval = time.Millisecond
+	sink := &flakySink{failures: 3}
+	async := NewAsyncSink(sink, 10)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := async.Write(context.Background(), Entry{Name: name}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	// failed writes are retried in order
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		sink.mu.Lock()
+		n := len(sink.entries)
+		sink.mu.Unlock()
+		if n == 3 {
+			break
+		}
+	}
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sink.entries, []string{"a", "b", "c"}) || !sink.closed {
+		t.Errorf("entries = %v, closed = %v", sink.entries, sink.closed)
+	}
+	if err := async.Write(context.Background(), Entry{}); err == nil {
+		t.Errorf("Write() after Close() error = nil")
+	}
+
+	// a slow sink doesn't block writers
+	blocked := &flakySink{block: make(chan struct{})}
+	async = NewAsyncSink(blocked, 1)
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = async.Write(context.Background(), Entry{Name: "x"})
+	}
+	if !errors.Is(err, ErrBufferFull) {
+		t.Errorf("Write() to full buffer error = %v, want %v", err, ErrBufferFull)
+	}
+	close(blocked.block)
+	_ = async.Close()
+}
@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPSink posts every entry as JSON to url
+type HTTPSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewHTTPSink creates sink posting to url with timeout, token is sent as "Authorization: Bearer <token>" if set
+func NewHTTPSink(url, token string, timeout time.Duration) *HTTPSink {
+	return &HTTPSink{url: url, token: token, client: &http.Client{Timeout: timeout}}
+}
+
+// Write posts entry, any status other than 2xx is an error
+func (s *HTTPSink) Write(ctx context.Context, e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send audit entry: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to send audit entry: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close does nothing, requests aren't buffered
+func (s *HTTPSink) Close() error {
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+)
+
+const (
+	HeaderAuthorization = "Authorization"
+	HeaderTimestamp     = "X-EC-Webhook-Timestamp"
+	HeaderSignature     = "X-EC-Webhook-Signature"
+
+	bearerPrefix = "Bearer "
+)
+
+// hmacMaxSkew limits how old a signed request may be to prevent replays. Requests carry no nonce,
+// so a captured request can be replayed as is while its timestamp is within the window.
+var hmacMaxSkew = 5 * time.Minute
+
+// AuthRule describes authentication of a group of routes.
+// Routes are open if both files are empty, if both are set a request must pass both checks.
+type AuthRule struct {
+	// TokenFile contains shared token expected in 'Authorization: Bearer <token>' header
+	TokenFile string
+	// HMACKeyFile contains key used to verify X-EC-Webhook-Signature header, which is
+	// hex(HMAC-SHA256(key, timestamp + "\n" + method + "\n" + path + "\n" + query + "\n" + body))
+	// where query is the raw query string without "?"
+	HMACKeyFile string
+}
+
+func (r AuthRule) Enabled() bool {
+	return r.TokenFile != "" || r.HMACKeyFile != ""
+}
+
+// AuthConfig separates read-only routes (GET /, GET /records) from mutating ones
+// (POST /records, POST /adjustendpoints) and admin ones (/approvals), /healthz is always open
+type AuthConfig struct {
+	Read  AuthRule
+	Write AuthRule
+	// Admin protects admin routes, Write is used if it is empty
+	Admin AuthRule
+}
+
+// fileSecret is a secret read from file which is re-read once the file is changed
+type fileSecret struct {
+	path string
+
+	mu     sync.Mutex
+	stamp  string
+	secret []byte
+}
+
+func newFileSecret(path string) (*fileSecret, error) {
+	s := &fileSecret{path: path}
+	if _, err := s.get(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSecret) get() ([]byte, error) {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat secret file: %w", err)
+	}
+	stamp := fmt.Sprintf("%d:%d", fi.Size(), fi.ModTime().UnixNano())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stamp == s.stamp {
+		return s.secret, nil
+	}
+
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file: %w", err)
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, fmt.Errorf("secret file '%s' is empty", s.path)
+	}
+	s.secret, s.stamp = b, stamp
+	return s.secret, nil
+}
+
+// newAuthMiddleware returns middleware checking requests against rule, it passes everything if rule is empty
+func newAuthMiddleware(rule AuthRule) (func(http.Handler) http.Handler, error) {
+	if !rule.Enabled() {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+
+	var token, hmacKey *fileSecret
+	var err error
+	if rule.TokenFile != "" {
+		if token, err = newFileSecret(rule.TokenFile); err != nil {
+			return nil, fmt.Errorf("bearer token: %w", err)
+		}
+	}
+	if rule.HMACKeyFile != "" {
+		if hmacKey, err = newFileSecret(rule.HMACKeyFile); err != nil {
+			return nil, fmt.Errorf("HMAC key: %w", err)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := logWithReqInfo(r)
+
+			if token != nil {
+				if err := checkBearerToken(r, token); err != nil {
+					logger.WithField(log.ErrorKey, err).Warning("unauthorized request")
+					writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, err)
+					return
+				}
+			}
+			if hmacKey != nil {
+				if err := checkSignature(r, hmacKey); err != nil {
+					var maxBytesErr *http.MaxBytesError
+					if errors.As(err, &maxBytesErr) {
+						logger.WithField(log.ErrorKey, err).Warning("request body is too large")
+						writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodeBodyTooLarge, err)
+						return
+					}
+					logger.WithField(log.ErrorKey, err).Warning("unauthorized request")
+					writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func checkBearerToken(r *http.Request, token *fileSecret) error {
+	expected, err := token.get()
+	if err != nil {
+		return err
+	}
+	header := r.Header.Get(HeaderAuthorization)
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return errors.New("bearer token is required")
+	}
+	got := []byte(strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix)))
+	if subtle.ConstantTimeCompare(got, expected) != 1 {
+		return errors.New("invalid bearer token")
+	}
+	return nil
+}
+
+// checkSignature verifies request signature, the body is restored to be read by handlers afterwards
+func checkSignature(r *http.Request, hmacKey *fileSecret) error {
+	key, err := hmacKey.get()
+	if err != nil {
+		return err
+	}
+
+	ts := r.Header.Get(HeaderTimestamp)
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid '%s' header", HeaderTimestamp)
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > hmacMaxSkew || skew < -hmacMaxSkew {
+		return errors.New("request timestamp is out of allowed window")
+	}
+
+	got, err := hex.DecodeString(r.Header.Get(HeaderSignature))
+	if err != nil || len(got) == 0 {
+		return fmt.Errorf("invalid '%s' header", HeaderSignature)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if !hmac.Equal(got, signRequest(key, ts, r.Method, r.URL.Path, r.URL.RawQuery, body)) {
+		return errors.New("invalid request signature")
+	}
+	return nil
+}
+
+func signRequest(key []byte, timestamp, method, path, query string, body []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n" + query + "\n"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/internal/fakeapi"
+	"github.com/Edge-Center/external-dns-ec-webhook/provider"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	externaldns "sigs.k8s.io/external-dns/provider"
+	"sigs.k8s.io/external-dns/provider/webhook"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files of webhook protocol conformance tests")
+
+// exchange is a recorded request to webhook API and its response
+type exchange struct {
+	Method          string          `json:"method"`
+	Path            string          `json:"path"`
+	Accept          string          `json:"accept,omitempty"`
+	ContentType     string          `json:"content_type,omitempty"`
+	Body            json.RawMessage `json:"body,omitempty"`
+	Status          int             `json:"status"`
+	RespContentType string          `json:"resp_content_type,omitempty"`
+	RespBody        json.RawMessage `json:"resp_body,omitempty"`
+}
+
+// recorder wraps webhook API and records every exchange with it
+type recorder struct {
+	next http.Handler
+
+	mu        sync.Mutex
+	exchanges []exchange
+}
+
+var traceIDRe = regexp.MustCompile(`"trace_id":"[^"]*"`)
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	rw := httptest.NewRecorder()
+	rec.next.ServeHTTP(rw, r)
+
+	respBody := traceIDRe.ReplaceAll(rw.Body.Bytes(), []byte(`"trace_id":"redacted"`))
+	rec.mu.Lock()
+	rec.exchanges = append(rec.exchanges, exchange{
+		Method:          r.Method,
+		Path:            r.URL.Path,
+		Accept:          r.Header.Get(HeaderAccept),
+		ContentType:     r.Header.Get(HeaderContentType),
+		Body:            compactJSON(body),
+		Status:          rw.Code,
+		RespContentType: rw.Header().Get(HeaderContentType),
+		RespBody:        compactJSON(respBody),
+	})
+	rec.mu.Unlock()
+
+	for k, v := range rw.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rw.Code)
+	_, _ = w.Write(rw.Body.Bytes())
+}
+
+func (rec *recorder) take() []exchange {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	res := rec.exchanges
+	rec.exchanges = nil
+	return res
+}
+
+func compactJSON(b []byte) json.RawMessage {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	if err := json.Compact(buf, b); err != nil {
+		s, _ := json.Marshal(string(b))
+		return s
+	}
+	return buf.Bytes()
+}
+
+// assertGolden compares exchanges with testdata/conformance/<name>.json, run with -update to rewrite the file
+func assertGolden(t *testing.T, name string, exchanges []exchange) {
+	t.Helper()
+	got, err := json.MarshalIndent(exchanges, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", "conformance", name+".json")
+	if *updateGolden {
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run tests with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("exchanges differ from %s, run tests with -update if the change is intended\ngot:\n%s", path, got)
+	}
+}
+
+func record(content string) dns.ResourceRecord {
+	return dns.ResourceRecord{Content: []any{content}, Enabled: true}
+}
+
+// newConformance starts webhook API on top of fake EdgeCenter API and connects external-dns webhook client to it
+func newConformance(t *testing.T, opts ...provider.Option) (*fakeapi.Server, *recorder, *webhook.WebhookProvider) {
+	t.Helper()
+	fake := fakeapi.NewServer()
+	t.Cleanup(fake.Close)
+	fake.SetRRSet("example.com", "www.example.com", "A", fakeapi.RRSet{
+		TTL:     300,
+		Records: []dns.ResourceRecord{record("1.1.1.1"), record("2.2.2.2")},
+	})
+	fake.SetRRSet("example.com", "old.example.com", "CNAME", fakeapi.RRSet{
+		TTL:     300,
+		Records: []dns.ResourceRecord{record("www.example.com")},
+	})
+	fake.AddZone("example.org")
+
+	p, err := provider.NewProvider(fake.URL, "token", false, opts...)
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	api, err := InitAPI(p, ServerConfig{MaxBodyBytes: DefaultMaxBodyBytes})
+	if err != nil {
+		t.Fatalf("InitAPI() error = %v", err)
+	}
+	rec := &recorder{next: api}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+
+	client, err := webhook.NewWebhookProvider(srv.URL)
+	if err != nil {
+		t.Fatalf("NewWebhookProvider() error = %v", err)
+	}
+	return fake, rec, client
+}
+
+func TestConformance_negotiation(t *testing.T) {
+	_, rec, client := newConformance(t)
+
+	// the client drops trailing dots of filters, so both spellings of a zone end up the same
+	want := []string{"example.com", "example.com", "example.org", "example.org"}
+	df := client.GetDomainFilter().(*endpoint.DomainFilter)
+	if !slices.Equal(df.Filters, want) {
+		t.Errorf("GetDomainFilter() = %v, want %v", df.Filters, want)
+	}
+	for name, match := range map[string]bool{"www.example.com": true, "example.org.": true, "example.net": false} {
+		if df.Match(name) != match {
+			t.Errorf("GetDomainFilter().Match(%s) = %v, want %v", name, !match, match)
+		}
+	}
+	assertGolden(t, "negotiation", rec.take())
+}
+
+func TestConformance_negotiationAccept(t *testing.T) {
+	_, rec, _ := newConformance(t)
+	rec.take()
+
+	tests := []struct {
+		name   string
+		accept string
+		want   int
+	}{
+		{name: "versioned", accept: "application/external.dns.webhook+json;version=1", want: http.StatusOK},
+		{name: "unversioned", accept: "application/external.dns.webhook+json", want: http.StatusOK},
+		{name: "any", accept: "*/*", want: http.StatusOK},
+		{name: "multiple values", accept: "text/html, application/external.dns.webhook+json;version=2, application/*;q=0.5", want: http.StatusOK},
+		{name: "unsupported version", accept: "application/external.dns.webhook+json;version=2", want: http.StatusNotAcceptable},
+		{name: "unsupported media type", accept: "application/json", want: http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAccept, tt.accept)
+		w := httptest.NewRecorder()
+		rec.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: GET / status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	assertGolden(t, "negotiation-accept", rec.take())
+}
+
+func TestConformance_records(t *testing.T) {
+	_, rec, client := newConformance(t)
+	rec.take()
+
+	records, err := client.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Records() = %v", records)
+	}
+	assertGolden(t, "records", rec.take())
+}
+
+func TestConformance_applyChanges(t *testing.T) {
+	desired := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "1.1.1.1", "3.3.3.3"),
+		endpoint.NewEndpointWithTTL("api.example.org", "A", 60, "4.4.4.4"),
+	}
+	policies := []struct {
+		name   string
+		policy plan.Policy
+	}{
+		{name: "sync", policy: &plan.SyncPolicy{}},
+		{name: "upsert-only", policy: &plan.UpsertOnlyPolicy{}},
+		{name: "create-only", policy: &plan.CreateOnlyPolicy{}},
+	}
+	for _, tt := range policies {
+		t.Run(tt.name, func(t *testing.T) {
+			_, rec, client := newConformance(t)
+			ctx := context.Background()
+
+			current, err := client.Records(ctx)
+			if err != nil {
+				t.Fatalf("Records() error = %v", err)
+			}
+			pl := &plan.Plan{
+				Current:        current,
+				Desired:        desired,
+				Policies:       []plan.Policy{tt.policy},
+				ManagedRecords: []string{endpoint.RecordTypeA, endpoint.RecordTypeCNAME},
+			}
+			rec.take()
+
+			if err = client.ApplyChanges(ctx, pl.Calculate().Changes); err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+			if _, err = client.Records(ctx); err != nil {
+				t.Fatalf("Records() after apply error = %v", err)
+			}
+			assertGolden(t, "apply-"+tt.name, rec.take())
+		})
+	}
+}
+
+func TestConformance_applyChangesUpstreamError(t *testing.T) {
+	fake, rec, client := newConformance(t)
+	rec.take()
+
+	fake.InjectFault(fakeapi.Fault{Method: http.MethodPost, PathPrefix: "/v2/zones/example.org/", Status: http.StatusBadGateway})
+	err := client.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.example.org", "A", 60, "4.4.4.4")},
+	})
+	if err == nil {
+		t.Fatal("ApplyChanges() expected error")
+	}
+	assertGolden(t, "apply-upstream-error", rec.take())
+}
+
+// TestConformance_applyChangesSoftErrors checks that ExternalDNS sees failures of EdgeCenter API as soft errors
+// and retries them on the next sync instead of stopping
+func TestConformance_applyChangesSoftErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		upstream   int
+		wantStatus int
+	}{
+		{name: "rate limited", upstream: http.StatusTooManyRequests, wantStatus: http.StatusServiceUnavailable},
+		{name: "rejected", upstream: http.StatusBadRequest, wantStatus: http.StatusBadGateway},
+		{name: "unprocessable", upstream: http.StatusUnprocessableEntity, wantStatus: http.StatusBadGateway},
+		{name: "internal error", upstream: http.StatusInternalServerError, wantStatus: http.StatusBadGateway},
+		{name: "unavailable", upstream: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, rec, client := newConformance(t)
+			rec.take()
+
+			fake.InjectFault(fakeapi.Fault{Method: http.MethodPost, PathPrefix: "/v2/zones/example.org/", Status: tt.upstream})
+			err := client.ApplyChanges(context.Background(), &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.example.org", "A", 60, "4.4.4.4")},
+			})
+			if !errors.Is(err, externaldns.SoftError) {
+				t.Errorf("ApplyChanges() error = %v, want soft error", err)
+			}
+			if exchanges := rec.take(); len(exchanges) != 1 || exchanges[0].Status != tt.wantStatus {
+				t.Errorf("exchanges = %+v, want one with status %d", exchanges, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestConformance_applyChangesFrozen(t *testing.T) {
+	freeze, err := provider.NewFreeze([]provider.FreezeWindow{{Name: "release", Schedule: "* * * * *", Duration: "1m"}}, provider.FreezeModeRefuse, "")
+	if err != nil {
+		t.Fatalf("NewFreeze() error = %v", err)
+	}
+	_, rec, client := newConformance(t, provider.WithFreeze(freeze))
+	rec.take()
+
+	err = client.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.example.org", "A", 60, "4.4.4.4")},
+	})
+	if !errors.Is(err, externaldns.SoftError) {
+		t.Errorf("ApplyChanges() error = %v, want soft error", err)
+	}
+	assertGolden(t, "apply-frozen", rec.take())
+}
+
+func TestConformance_adjustEndpoints(t *testing.T) {
+	_, rec, client := newConformance(t)
+	rec.take()
+
+	adjusted, err := client.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("www.example.com", "TXT", 300, "\"heritage=external-dns\""),
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	if len(adjusted) != 1 {
+		t.Errorf("AdjustEndpoints() = %v", adjusted)
+	}
+	assertGolden(t, "adjustendpoints", rec.take())
+}
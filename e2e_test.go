@@ -0,0 +1,598 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/internal/fakeapi"
+	"github.com/Edge-Center/external-dns-ec-webhook/provider"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// newE2E starts webhook API backed by the real SDK talking to fake EdgeCenter API
+func newE2E(t *testing.T, opts ...provider.Option) (*fakeapi.Server, *httptest.Server) {
+	t.Helper()
+	fake := fakeapi.NewServer()
+	t.Cleanup(fake.Close)
+	fake.RequireAuth("APIKey token")
+
+	p, err := provider.NewProvider(fake.URL, "token", false, opts...)
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	api, err := InitAPI(p, ServerConfig{MaxBodyBytes: DefaultMaxBodyBytes})
+	if err != nil {
+		t.Fatalf("InitAPI() error = %v", err)
+	}
+	webhook := httptest.NewServer(api)
+	t.Cleanup(webhook.Close)
+	return fake, webhook
+}
+
+func getRecords(t *testing.T, url string) []*endpoint.Endpoint {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url+"/records", nil)
+	req.Header.Set(HeaderAccept, ContentTypeAppJson)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /records status = %d", resp.StatusCode)
+	}
+	records := make([]*endpoint.Endpoint, 0)
+	if err = json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func postChanges(t *testing.T, url string, changes *plan.Changes) *http.Response {
+	t.Helper()
+	b, _ := json.Marshal(changes)
+	req, _ := http.NewRequest(http.MethodPost, url+"/records", bytes.NewReader(b))
+	req.Header.Set(HeaderContentType, ContentTypeAppJson)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp
+}
+
+// sameEndpoints compares endpoints ignoring difference between nil and empty labels after decoding
+func sameEndpoints(got, want []*endpoint.Endpoint) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i].String() != want[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestE2E_recordsLifecycle(t *testing.T) {
+	fake, webhook := newE2E(t)
+	fake.AddZone("example.com")
+
+	resp := postChanges(t, webhook.URL, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2"),
+			endpoint.NewEndpointWithTTL("_sip._tcp.example.com", "SRV", 60, "10 5 5060 sip.example.com"),
+			endpoint.NewEndpointWithTTL("www.unknown.com", "A", 60, "3.3.3.3"),
+		},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("create status = %d", resp.StatusCode)
+	}
+
+	want := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("_sip._tcp.example.com", "SRV", 60, "10 5 5060 sip.example.com"),
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2"),
+	}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, want) {
+		t.Fatalf("records after create = %v, want %v", got, want)
+	}
+
+	resp = postChanges(t, webhook.URL, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("_sip._tcp.example.com", "SRV", 60, "10 5 5060 sip.example.com")},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("update status = %d", resp.StatusCode)
+	}
+
+	want = []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1")}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, want) {
+		t.Fatalf("records after update = %v, want %v", got, want)
+	}
+}
+
+func TestE2E_upstreamFailures(t *testing.T) {
+	fake, webhook := newE2E(t)
+	fake.AddZone("example.com")
+
+	fake.InjectFault(fakeapi.Fault{
+		Method:     http.MethodGet,
+		PathPrefix: "/v2/zones",
+		Status:     http.StatusTooManyRequests,
+	})
+	req, _ := http.NewRequest(http.MethodGet, webhook.URL+"/records", nil)
+	req.Header.Set(HeaderAccept, ContentTypeAppJson)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("GET /records status = %d, Retry-After = %q, want %d with Retry-After",
+			resp.StatusCode, resp.Header.Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+	fake.ClearFaults()
+
+	fake.InjectFault(fakeapi.Fault{
+		Method:     http.MethodPost,
+		PathPrefix: "/v2/zones/example.com/",
+		Status:     http.StatusServiceUnavailable,
+	})
+	resp = postChanges(t, webhook.URL, &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1")},
+	})
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("POST /records status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestE2E_zoneCreation(t *testing.T) {
+	fake, webhook := newE2E(t, provider.WithZoneCreation([]string{"example.com"}, 1))
+	fake.SetNameservers("ns1.edgecenter.test", "ns2.edgecenter.test")
+
+	resp := postChanges(t, webhook.URL, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.app.example.com", "A", 60, "1.1.1.1"),
+			endpoint.NewEndpointWithTTL("www.web.example.com", "A", 60, "2.2.2.2"),
+		},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("create status = %d", resp.StatusCode)
+	}
+
+	if got, want := fake.ZoneNames(), []string{"app.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("zones = %v, want %v", got, want)
+	}
+	want := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("app.example.com", "NS", 3600, "ns1.edgecenter.test", "ns2.edgecenter.test"),
+		endpoint.NewEndpointWithTTL("www.app.example.com", "A", 60, "1.1.1.1"),
+	}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+func TestE2E_idn(t *testing.T) {
+	fake, webhook := newE2E(t, provider.WithUnicodeNames())
+	fake.AddZone("xn--e1afmkfd.xn--p1ai") // пример.рф
+
+	resp := postChanges(t, webhook.URL, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.пример.рф", "A", 60, "1.1.1.1"),
+			endpoint.NewEndpointWithTTL("Алиас.Пример.РФ", "CNAME", 60, "www.пример.рф"),
+		},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("create status = %d", resp.StatusCode)
+	}
+	set, ok := fake.RRSet("xn--e1afmkfd.xn--p1ai", "xn--80aaxl6a.xn--e1afmkfd.xn--p1ai", "CNAME")
+	if !ok || set.Records[0].ContentToString() != "www.xn--e1afmkfd.xn--p1ai" {
+		t.Fatalf("CNAME is not stored in punycode: %+v", set)
+	}
+
+	want := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.пример.рф", "A", 60, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("алиас.пример.рф", "CNAME", 60, "www.пример.рф"),
+	}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, want) {
+		t.Fatalf("records after create = %v, want %v", got, want)
+	}
+
+	resp = postChanges(t, webhook.URL, &plan.Changes{
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("алиас.пример.рф", "CNAME", 60, "www.пример.рф")},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete status = %d", resp.StatusCode)
+	}
+	want = want[:1]
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, want) {
+		t.Fatalf("records after delete = %v, want %v", got, want)
+	}
+}
+
+func adjustEndpoints(t *testing.T, url string, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	t.Helper()
+	b, _ := json.Marshal(endpoints)
+	req, _ := http.NewRequest(http.MethodPost, url+"/adjustendpoints", bytes.NewReader(b))
+	req.Header.Set(HeaderContentType, ContentTypeAppJson)
+	req.Header.Set(HeaderAccept, ContentTypeAppJson)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /adjustendpoints status = %d", resp.StatusCode)
+	}
+	adjusted := make([]*endpoint.Endpoint, 0)
+	if err = json.NewDecoder(resp.Body).Decode(&adjusted); err != nil {
+		t.Fatal(err)
+	}
+	return adjusted
+}
+
+func TestE2E_disabledRecords(t *testing.T) {
+	disabledSet := fakeapi.RRSet{TTL: 60, Records: []dns.ResourceRecord{
+		{Content: []any{"1.1.1.1"}, Enabled: true},
+		{Content: []any{"2.2.2.2"}, Enabled: false},
+	}}
+	current := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2").
+		WithProviderSpecific(provider.DisabledTargetsProperty, `["2.2.2.2"]`)
+
+	t.Run("keep", func(t *testing.T) {
+		fake, webhook := newE2E(t)
+		fake.SetRRSet("example.com", "www.example.com", "A", disabledSet)
+
+		if got := getRecords(t, webhook.URL); !sameEndpoints(got, []*endpoint.Endpoint{current}) {
+			t.Fatalf("records = %v, want %v", got, current)
+		}
+		desired := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2", "3.3.3.3")
+		adjusted := adjustEndpoints(t, webhook.URL, []*endpoint.Endpoint{desired})
+		if v, _ := adjusted[0].GetProviderSpecificProperty(provider.DisabledTargetsProperty); v != `["2.2.2.2"]` {
+			t.Fatalf("adjusted endpoint has no disabled targets: %v", adjusted[0])
+		}
+
+		resp := postChanges(t, webhook.URL, &plan.Changes{UpdateOld: []*endpoint.Endpoint{current}, UpdateNew: adjusted})
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("update status = %d", resp.StatusCode)
+		}
+		set, _ := fake.RRSet("example.com", "www.example.com", "A")
+		enabled := map[string]bool{}
+		for _, rr := range set.Records {
+			enabled[rr.ContentToString()] = rr.Enabled
+		}
+		if want := map[string]bool{"1.1.1.1": true, "2.2.2.2": false, "3.3.3.3": true}; !reflect.DeepEqual(enabled, want) {
+			t.Errorf("records after update = %v, want %v", enabled, want)
+		}
+	})
+
+	t.Run("enable", func(t *testing.T) {
+		fake, webhook := newE2E(t, provider.WithDisabledPolicy(provider.DisabledPolicyEnable))
+		fake.SetRRSet("example.com", "www.example.com", "A", disabledSet)
+
+		getRecords(t, webhook.URL)
+		desired := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2")
+		adjusted := adjustEndpoints(t, webhook.URL, []*endpoint.Endpoint{desired})
+		if _, ok := adjusted[0].GetProviderSpecificProperty(provider.DisabledTargetsProperty); ok {
+			t.Fatalf("adjusted endpoint has disabled targets: %v", adjusted[0])
+		}
+
+		resp := postChanges(t, webhook.URL, &plan.Changes{UpdateOld: []*endpoint.Endpoint{current}, UpdateNew: adjusted})
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("update status = %d", resp.StatusCode)
+		}
+		want := []*endpoint.Endpoint{desired}
+		if got := getRecords(t, webhook.URL); !sameEndpoints(got, want) {
+			t.Errorf("records after update = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestE2E_metaRegistry(t *testing.T) {
+	fake, webhook := newE2E(t, provider.WithMetaRegistry("", "", ""))
+	fake.AddZone("example.com")
+	// TXT registry record written before the meta registry was enabled
+	fake.SetRRSet("example.com", "a-api.example.com", "TXT", fakeapi.RRSet{TTL: 300, Records: []dns.ResourceRecord{
+		{Content: []any{`"heritage=external-dns,external-dns/owner=k8s"`}, Enabled: true},
+	}})
+
+	labels := `"heritage=external-dns,external-dns/owner=k8s,external-dns/resource=service/default/web"`
+	txt := func(name, owned, value string) *endpoint.Endpoint {
+		e := endpoint.NewEndpoint(name, "TXT", value)
+		e.Labels[endpoint.OwnedRecordLabelKey] = owned
+		return e
+	}
+
+	resp := postChanges(t, webhook.URL, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1"),
+			txt("a-www.example.com", "www.example.com", labels),
+			endpoint.NewEndpointWithTTL("api.example.com", "A", 60, "2.2.2.2"),
+		},
+		UpdateOld: []*endpoint.Endpoint{txt("a-api.example.com", "api.example.com", `"heritage=external-dns,external-dns/owner=k8s"`)},
+		UpdateNew: []*endpoint.Endpoint{txt("a-api.example.com", "api.example.com", labels)},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("create status = %d", resp.StatusCode)
+	}
+	if _, ok := fake.RRSet("example.com", "a-www.example.com", "TXT"); ok {
+		t.Errorf("TXT registry record is written to DNS")
+	}
+	if _, ok := fake.RRSet("example.com", "a-api.example.com", "TXT"); ok {
+		t.Errorf("old TXT registry record is not deleted")
+	}
+
+	want := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("api.example.com", "A", 60, "2.2.2.2"),
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1"),
+		endpoint.NewEndpoint("a-api.example.com", "TXT", labels),
+		endpoint.NewEndpoint("a-www.example.com", "TXT", labels),
+	}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, want) {
+		t.Fatalf("records = %v, want %v", got, want)
+	}
+
+	resp = postChanges(t, webhook.URL, &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1"),
+			txt("a-www.example.com", "www.example.com", labels),
+		},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete status = %d", resp.StatusCode)
+	}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, []*endpoint.Endpoint{want[0], want[2]}) {
+		t.Fatalf("records after delete = %v", got)
+	}
+}
+
+func TestE2E_provenanceNotes(t *testing.T) {
+	fake, webhook := newE2E(t, provider.WithProvenanceNotes("prod"))
+	fake.SetRRSet("example.com", "www.example.com", "A", fakeapi.RRSet{TTL: 60, Records: []dns.ResourceRecord{
+		{Content: []any{"1.1.1.1"}, Enabled: true, Meta: map[string]any{"notes": []any{"added by hand"}}},
+	}})
+
+	updated := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2")
+	updated.Labels[endpoint.OwnerLabelKey] = "default"
+	updated.Labels[endpoint.ResourceLabelKey] = "service/web/web"
+	resp := postChanges(t, webhook.URL, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{updated},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("update status = %d", resp.StatusCode)
+	}
+
+	set, _ := fake.RRSet("example.com", "www.example.com", "A")
+	notes := map[string]any{}
+	for _, rr := range set.Records {
+		notes[rr.ContentToString()] = rr.Meta["notes"]
+	}
+	want := map[string]any{
+		"1.1.1.1": []any{"added by hand"},
+		"2.2.2.2": []any{"managed by external-dns, cluster prod, owner default, resource service/web/web"},
+	}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("notes = %v, want %v", notes, want)
+	}
+}
+
+func TestE2E_setIdentifiers(t *testing.T) {
+	fake, webhook := newE2E(t)
+	fake.AddZone("example.com")
+
+	eu := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1").WithSetIdentifier("eu")
+	us := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2").WithSetIdentifier("us")
+	for _, e := range []*endpoint.Endpoint{eu, us} {
+		if resp := postChanges(t, webhook.URL, &plan.Changes{Create: []*endpoint.Endpoint{e}}); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("create %s status = %d", e.SetIdentifier, resp.StatusCode)
+		}
+	}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, []*endpoint.Endpoint{eu, us}) {
+		t.Fatalf("records after create = %v", got)
+	}
+
+	euNew := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "3.3.3.3").WithSetIdentifier("eu")
+	resp := postChanges(t, webhook.URL, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{eu},
+		UpdateNew: []*endpoint.Endpoint{euNew},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("update status = %d", resp.StatusCode)
+	}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, []*endpoint.Endpoint{euNew, us}) {
+		t.Fatalf("records after update = %v", got)
+	}
+
+	if resp = postChanges(t, webhook.URL, &plan.Changes{Delete: []*endpoint.Endpoint{euNew}}); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete status = %d", resp.StatusCode)
+	}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, []*endpoint.Endpoint{us}) {
+		t.Fatalf("records after delete = %v", got)
+	}
+	if resp = postChanges(t, webhook.URL, &plan.Changes{Delete: []*endpoint.Endpoint{us}}); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete status = %d", resp.StatusCode)
+	}
+	if _, ok := fake.RRSet("example.com", "www.example.com", "A"); ok {
+		t.Errorf("rrset without records is not deleted")
+	}
+}
+
+func TestE2E_routing(t *testing.T) {
+	fake, webhook := newE2E(t)
+	fake.AddZone("example.com")
+
+	desired := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1").WithSetIdentifier("eu").
+			WithProviderSpecific(provider.WeightProperty, "10").
+			WithProviderSpecific(provider.ContinentsProperty, "eu"),
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "2.2.2.2").WithSetIdentifier("us").
+			WithProviderSpecific(provider.WeightProperty, "20").
+			WithProviderSpecific(provider.CountriesProperty, "us,ca"),
+	}
+	adjusted := adjustEndpoints(t, webhook.URL, desired)
+	if resp := postChanges(t, webhook.URL, &plan.Changes{Create: adjusted}); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("create status = %d", resp.StatusCode)
+	}
+
+	set, _ := fake.RRSet("example.com", "www.example.com", "A")
+	wantFilters := []dns.RecordFilter{dns.NewGeoDNSFilter(0, false), {Type: "weighted_shuffle"}, dns.NewFirstNFilter(1, false)}
+	if !reflect.DeepEqual(set.Filters, wantFilters) {
+		t.Errorf("filters = %v, want %v", set.Filters, wantFilters)
+	}
+
+	current := getRecords(t, webhook.URL)
+	if !sameEndpoints(current, adjusted) {
+		t.Fatalf("records = %v, want %v", current, adjusted)
+	}
+	changes := (&plan.Plan{
+		Current:        current,
+		Desired:        adjustEndpoints(t, webhook.URL, desired),
+		ManagedRecords: []string{endpoint.RecordTypeA},
+	}).Calculate().Changes
+	if changes.HasChanges() {
+		t.Fatalf("plan is not stable: %+v", changes)
+	}
+
+	// dropping weights keeps geo routing only
+	updated := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1").WithSetIdentifier("eu").
+		WithProviderSpecific(provider.ContinentsProperty, "EU")
+	resp := postChanges(t, webhook.URL, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{current[0]},
+		UpdateNew: []*endpoint.Endpoint{updated},
+		Delete:    []*endpoint.Endpoint{current[1]},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("update status = %d", resp.StatusCode)
+	}
+	set, _ = fake.RRSet("example.com", "www.example.com", "A")
+	if !reflect.DeepEqual(set.Filters, wantFilters[:1]) {
+		t.Errorf("filters after update = %v, want %v", set.Filters, wantFilters[:1])
+	}
+	if got := getRecords(t, webhook.URL); !sameEndpoints(got, []*endpoint.Endpoint{updated}) {
+		t.Errorf("records after update = %v", got)
+	}
+}
+
+func TestE2E_drift(t *testing.T) {
+	fake := fakeapi.NewServer()
+	t.Cleanup(fake.Close)
+	fake.AddZone("example.com")
+	p, err := provider.NewProvider(fake.URL, "token", false,
+		provider.WithDriftDetection(filepath.Join(t.TempDir(), "drift.json"), 10*time.Millisecond, true))
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	api, err := InitAPI(p, ServerConfig{MaxBodyBytes: DefaultMaxBodyBytes})
+	if err != nil {
+		t.Fatalf("InitAPI() error = %v", err)
+	}
+	webhook := httptest.NewServer(api)
+	t.Cleanup(webhook.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go p.WatchDrift(ctx)
+
+	created := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1")
+	if resp := postChanges(t, webhook.URL, &plan.Changes{Create: []*endpoint.Endpoint{created}}); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("create status = %d", resp.StatusCode)
+	}
+
+	// changed in the control panel
+	set, _ := fake.RRSet("example.com", "www.example.com", "A")
+	set.Records = []dns.ResourceRecord{{Content: []any{"9.9.9.9"}, Enabled: true}}
+	fake.SetRRSet("example.com", "www.example.com", "A", set)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !sameEndpoints(getRecords(t, webhook.URL), []*endpoint.Endpoint{created}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("drifted record isn't restored, records = %v", getRecords(t, webhook.URL))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err := http.Get(webhook.URL + "/debug/drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var report provider.DriftReport
+	if err = json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || report.Tracked != 1 {
+		t.Errorf("GET /debug/drift = %d %+v, want 200 with 1 tracked record", resp.StatusCode, report)
+	}
+
+	// drift detection is disabled by default
+	_, webhook = newE2E(t)
+	if resp, err = http.Get(webhook.URL + "/debug/drift"); err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /debug/drift without drift detection status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestE2E_approvals(t *testing.T) {
+	fake, webhook := newE2E(t, provider.WithApprovals([]string{"example.com"}, filepath.Join(t.TempDir(), "approvals.json"), time.Hour))
+	fake.AddZone("example.com")
+
+	created := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1")
+	if resp := postChanges(t, webhook.URL, &plan.Changes{Create: []*endpoint.Endpoint{created}}); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("create status = %d", resp.StatusCode)
+	}
+	deleted := &plan.Changes{Delete: getRecords(t, webhook.URL)}
+	if resp := postChanges(t, webhook.URL, deleted); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete status = %d", resp.StatusCode)
+	}
+	if !sameEndpoints(getRecords(t, webhook.URL), []*endpoint.Endpoint{created}) {
+		t.Fatalf("record is deleted without approval")
+	}
+
+	resp, err := http.Get(webhook.URL + "/approvals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var approvals []provider.Approval
+	if err = json.NewDecoder(resp.Body).Decode(&approvals); err != nil {
+		t.Fatal(err)
+	}
+	if len(approvals) != 1 || approvals[0].Status != provider.ApprovalPending || approvals[0].Action != "delete" {
+		t.Fatalf("GET /approvals = %+v, want 1 pending delete", approvals)
+	}
+
+	if resp, err = http.Post(webhook.URL+"/approvals/unknown/approve", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("approve unknown status = %d, want 404", resp.StatusCode)
+	}
+	if resp, err = http.Post(webhook.URL+"/approvals/"+approvals[0].ID+"/approve", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("approve status = %d", resp.StatusCode)
+	}
+
+	if resp := postChanges(t, webhook.URL, deleted); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("approved delete status = %d", resp.StatusCode)
+	}
+	if records := getRecords(t, webhook.URL); len(records) != 0 {
+		t.Errorf("records after approved delete = %v", records)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/provider"
+)
+
+const ContentTypeJson = "application/json"
+
+// Error codes returned in ErrorResponse.Code
+const (
+	ErrCodeBadRequest           = "bad_request"
+	ErrCodeValidation           = "validation_failed"
+	ErrCodeSkippedChanges       = "changes_skipped"
+	ErrCodeChangeFreeze         = "change_freeze"
+	ErrCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrCodeNotAcceptable        = "not_acceptable"
+	ErrCodeBodyTooLarge         = "body_too_large"
+	ErrCodeNotFound             = "not_found"
+	ErrCodeUnauthorized         = "unauthorized"
+	ErrCodeUpstream             = "upstream_error"
+	ErrCodeUpstreamUnavailable  = "upstream_unavailable"
+	ErrCodeUpstreamRateLimited  = "upstream_rate_limited"
+	ErrCodeInternal             = "internal_error"
+)
+
+// ErrorResponse is a body of every non-successful response of the webhook API
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// writeError writes status first and then JSON body describing the error
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, err error) {
+	resp := ErrorResponse{
+		Code:    code,
+		Message: http.StatusText(status),
+	}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	if traceID := r.Context().Value(log.TraceIDKey); traceID != nil {
+		resp.TraceID = fmt.Sprint(traceID)
+	}
+
+	w.Header().Set(HeaderContentType, ContentTypeJson)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logWithReqInfo(r).WithField(log.ErrorKey, err).Error("failed to write error response")
+	}
+}
+
+// writeDecodeError answers to request which body can't be decoded
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodeBodyTooLarge, err)
+	case errors.As(err, &typeErr):
+		writeError(w, r, http.StatusUnprocessableEntity, ErrCodeValidation, err)
+	default:
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err)
+	}
+}
+
+// retryAfter is a delay in seconds suggested to clients in Retry-After header of 503 responses
+const retryAfter = "60"
+
+// writeProviderError answers to request failed in provider, telling apart EdgeCenter API failures.
+// ExternalDNS treats only 500-510 statuses as soft errors and stops on any other, so every failure
+// of the provider is answered with a 5xx status and the reason is told by the code of the response.
+func writeProviderError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := classifyProviderError(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	writeError(w, r, status, code, err)
+}
+
+func classifyProviderError(err error) (int, string) {
+	apiErr := new(dns.APIError)
+	if errors.As(err, apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return http.StatusServiceUnavailable, ErrCodeUpstreamRateLimited
+		case apiErr.StatusCode == http.StatusBadGateway,
+			apiErr.StatusCode == http.StatusServiceUnavailable,
+			apiErr.StatusCode == http.StatusGatewayTimeout:
+			return http.StatusServiceUnavailable, ErrCodeUpstreamUnavailable
+		case apiErr.StatusCode == http.StatusBadRequest,
+			apiErr.StatusCode == http.StatusUnprocessableEntity:
+			// EdgeCenter rejected the content of records
+			return http.StatusBadGateway, ErrCodeValidation
+		default:
+			return http.StatusBadGateway, ErrCodeUpstream
+		}
+	}
+
+	var frozen *provider.FreezeError
+	if errors.As(err, &frozen) {
+		return http.StatusServiceUnavailable, ErrCodeChangeFreeze
+	}
+
+	var skipped *provider.SkippedChangesError
+	if errors.As(err, &skipped) {
+		return http.StatusInternalServerError, ErrCodeSkippedChanges
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable, ErrCodeUpstreamUnavailable
+	}
+	return http.StatusInternalServerError, ErrCodeInternal
+}
+
+// writeJSON encodes v before writing anything, so an encoding failure still results in a proper error response
+func writeJSON(w http.ResponseWriter, r *http.Request, contentType string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logWithReqInfo(r).WithField(log.ErrorKey, err).Error("failed to encode response")
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err)
+		return
+	}
+	w.Header().Set(HeaderContentType, contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(b); err != nil {
+		logWithReqInfo(r).WithField(log.ErrorKey, err).Error("failed to write response")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/provider"
+)
+
+func Test_classifyProviderError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "rate limited",
+			err:        fmt.Errorf("failed to create rrset: %w", dns.APIError{StatusCode: http.StatusTooManyRequests}),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   ErrCodeUpstreamRateLimited,
+		},
+		{
+			name:       "upstream unavailable",
+			err:        errors.Join(errors.New("other"), fmt.Errorf("wrapped: %w", dns.APIError{StatusCode: http.StatusServiceUnavailable})),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   ErrCodeUpstreamUnavailable,
+		},
+		{
+			name:       "upstream internal error",
+			err:        dns.APIError{StatusCode: http.StatusInternalServerError},
+			wantStatus: http.StatusBadGateway,
+			wantCode:   ErrCodeUpstream,
+		},
+		{
+			name:       "upstream rejected content",
+			err:        dns.APIError{StatusCode: http.StatusBadRequest},
+			wantStatus: http.StatusBadGateway,
+			wantCode:   ErrCodeValidation,
+		},
+		{
+			name:       "skipped changes",
+			err:        errors.Join(&provider.SkippedChangesError{Changes: []provider.SkippedChange{{Action: "create"}}}),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   ErrCodeSkippedChanges,
+		},
+		{
+			name: "change freeze wins over skipped changes",
+			err: errors.Join(
+				&provider.SkippedChangesError{Changes: []provider.SkippedChange{{Action: "create"}}},
+				&provider.FreezeError{Windows: []string{"release"}, Changes: 1},
+			),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   ErrCodeChangeFreeze,
+		},
+		{
+			name: "upstream error wins over skipped changes",
+			err: errors.Join(
+				dns.APIError{StatusCode: http.StatusServiceUnavailable},
+				&provider.SkippedChangesError{Changes: []provider.SkippedChange{{Action: "create"}}},
+			),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   ErrCodeUpstreamUnavailable,
+		},
+		{
+			name:       "timeout",
+			err:        fmt.Errorf("send request: %w", context.DeadlineExceeded),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   ErrCodeUpstreamUnavailable,
+		},
+		{
+			name:       "unknown",
+			err:        errors.New("test"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   ErrCodeInternal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := classifyProviderError(tt.err)
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Errorf("classifyProviderError() = %d %s, want %d %s", status, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestInitAPI_errorResponses(t *testing.T) {
+	api, err := InitAPI(nil, ServerConfig{})
+	if err != nil {
+		t.Fatalf("InitAPI() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    string
+	}{
+		{
+			name:        "malformed json",
+			path:        "/records",
+			contentType: ContentTypeAppJson,
+			body:        `{"Create": [`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    ErrCodeBadRequest,
+		},
+		{
+			name:        "wrong json shape",
+			path:        "/adjustendpoints",
+			contentType: ContentTypeAppJson,
+			body:        `{"dnsName": "test.example.com"}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    ErrCodeValidation,
+		},
+		{
+			name:       "missing content type",
+			path:       "/records",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   ErrCodeBadRequest,
+		},
+		{
+			name:        "unsupported content type",
+			path:        "/records",
+			contentType: "text/plain",
+			body:        `{}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantCode:    ErrCodeUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set(HeaderContentType, tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get(HeaderContentType); ct != ContentTypeJson {
+				t.Errorf("content type = %s, want %s", ct, ContentTypeJson)
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			if resp.Code != tt.wantCode || resp.Message == "" || resp.TraceID == "" {
+				t.Errorf("unexpected error response %+v", resp)
+			}
+		})
+	}
+}
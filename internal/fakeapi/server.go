@@ -0,0 +1,450 @@
+// Package fakeapi provides in-memory fake of EdgeCenter DNS API (/v2/zones) for tests,
+// so the whole path webhook -> provider -> SDK -> API can be exercised without network.
+package fakeapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+)
+
+// RRSet is stored RRSet, unlike dns.RRSet it keeps free-form meta
+type RRSet struct {
+	TTL     int                  `json:"ttl"`
+	Records []dns.ResourceRecord `json:"resource_records"`
+	Filters []dns.RecordFilter   `json:"filters"`
+	Meta    map[string]any       `json:"meta,omitempty"`
+}
+
+// Fault describes an injected failure, requests matching Method and PathPrefix get Status with Body
+type Fault struct {
+	// Method matches any method if empty
+	Method string
+	// PathPrefix is matched against request path, e.g. "/v2/zones/example.com", empty matches any
+	PathPrefix string
+	Status     int
+	Body       string
+	// Times limits how many requests fail, 0 means forever
+	Times int
+}
+
+// Request is a record of a request served by fake
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+type zone struct {
+	id     uint64
+	name   string
+	rrsets map[rrsetKey]*RRSet
+}
+
+type rrsetKey struct {
+	name       string
+	recordType string
+}
+
+// Server is httptest server with EdgeCenter DNS API state
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	zones       map[string]*zone
+	nextID      uint64
+	faults      []*Fault
+	authHeader  string
+	requests    []Request
+	nameservers []string
+}
+
+// NewServer starts fake API, it should be closed by caller
+func NewServer() *Server {
+	s := &Server{zones: make(map[string]*zone)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/zones", s.listZones)
+	mux.HandleFunc("POST /v2/zones", s.createZone)
+	mux.HandleFunc("GET /v2/zones/{zone}", s.getZone)
+	mux.HandleFunc("DELETE /v2/zones/{zone}", s.deleteZone)
+	mux.HandleFunc("GET /v2/zones/{zone}/{name}/{type}", s.getRRSet)
+	mux.HandleFunc("POST /v2/zones/{zone}/{name}/{type}", s.createRRSet)
+	mux.HandleFunc("PUT /v2/zones/{zone}/{name}/{type}", s.updateRRSet)
+	mux.HandleFunc("DELETE /v2/zones/{zone}/{name}/{type}", s.deleteRRSet)
+
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.Trim(name, "."))
+}
+
+// AddZone creates zone, it's a no-op if zone exists
+func (s *Server) AddZone(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addZone(name)
+}
+
+func (s *Server) addZone(name string) *zone {
+	name = normalize(name)
+	if z, ok := s.zones[name]; ok {
+		return z
+	}
+	s.nextID++
+	z := &zone{id: s.nextID, name: name, rrsets: make(map[rrsetKey]*RRSet)}
+	s.zones[name] = z
+	return z
+}
+
+// SetNameservers makes zones created through API get apex NS records with nameservers
+func (s *Server) SetNameservers(nameservers ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nameservers = nameservers
+}
+
+// ZoneNames returns sorted names of existing zones
+func (s *Server) ZoneNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.zones))
+	for n := range s.zones {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetRRSet puts RRSet into zone creating the zone if needed
+func (s *Server) SetRRSet(zoneName, name, recordType string, set RRSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z := s.addZone(zoneName)
+	z.rrsets[rrsetKey{name: normalize(name), recordType: strings.ToUpper(recordType)}] = &set
+}
+
+// RRSet returns copy of stored RRSet
+func (s *Server) RRSet(zoneName, name, recordType string) (RRSet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z, ok := s.zones[normalize(zoneName)]
+	if !ok {
+		return RRSet{}, false
+	}
+	set, ok := z.rrsets[rrsetKey{name: normalize(name), recordType: strings.ToUpper(recordType)}]
+	if !ok {
+		return RRSet{}, false
+	}
+	return *set, true
+}
+
+// RequireAuth makes fake answer 401 to requests without the exact Authorization header,
+// e.g. "APIKey <token>" or "Bearer <token>"
+func (s *Server) RequireAuth(header string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authHeader = header
+}
+
+// InjectFault adds failure to be returned for matching requests
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// RateLimit makes the next n requests fail with 429
+func (s *Server) RateLimit(n int) {
+	s.InjectFault(Fault{Status: http.StatusTooManyRequests, Body: `{"error":"too many requests"}`, Times: n})
+}
+
+// ClearFaults removes all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns log of served requests
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Body:   string(body),
+		})
+		if s.authHeader != "" && r.Header.Get("Authorization") != s.authHeader {
+			s.mu.Unlock()
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		fault := s.matchFault(r)
+		s.mu.Unlock()
+
+		if fault != nil {
+			if fault.Status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(fault.Status)
+			_, _ = w.Write([]byte(fault.Body))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// matchFault must be called under lock
+func (s *Server) matchFault(r *http.Request) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, f.PathPrefix) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) listZones(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filter := make(map[string]bool)
+	for _, n := range r.URL.Query()["name"] {
+		filter[normalize(n)] = true
+	}
+
+	res := dns.ListZones{Zones: make([]dns.Zone, 0)}
+	for _, z := range s.sortedZones() {
+		if len(filter) > 0 && !filter[z.name] {
+			continue
+		}
+		res.Zones = append(res.Zones, dns.Zone{Name: z.name})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) createZone(w http.ResponseWriter, r *http.Request) {
+	var req dns.AddZone
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || normalize(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "invalid zone name")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.zones[normalize(req.Name)]; ok {
+		writeError(w, http.StatusConflict, "zone already exists")
+		return
+	}
+	z := s.addZone(req.Name)
+	if len(s.nameservers) > 0 {
+		set := &RRSet{TTL: 3600}
+		for _, ns := range s.nameservers {
+			set.Records = append(set.Records, dns.ResourceRecord{Content: []any{ns}, Enabled: true})
+		}
+		z.rrsets[rrsetKey{name: z.name, recordType: "NS"}] = set
+	}
+	writeJSON(w, http.StatusOK, dns.CreateResponse{ID: z.id})
+}
+
+func (s *Server) getZone(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, ok := s.zones[normalize(r.PathValue("zone"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "zone not found")
+		return
+	}
+
+	res := dns.Zone{Name: z.name, Records: make([]dns.ZoneRecord, 0, len(z.rrsets))}
+	for _, k := range sortedKeys(z.rrsets) {
+		set := z.rrsets[k]
+		answers := make([]string, 0, len(set.Records))
+		for _, rr := range set.Records {
+			answers = append(answers, rr.ContentToString())
+		}
+		res.Records = append(res.Records, dns.ZoneRecord{
+			Name:         k.name,
+			Type:         k.recordType,
+			TTL:          uint(set.TTL),
+			ShortAnswers: answers,
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) deleteZone(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := normalize(r.PathValue("zone"))
+	if _, ok := s.zones[name]; !ok {
+		writeError(w, http.StatusNotFound, "zone not found")
+		return
+	}
+	delete(s.zones, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupZone must be called under lock
+func (s *Server) lookupZone(w http.ResponseWriter, r *http.Request) (*zone, rrsetKey, bool) {
+	z, ok := s.zones[normalize(r.PathValue("zone"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "zone not found")
+		return nil, rrsetKey{}, false
+	}
+	key := rrsetKey{name: normalize(r.PathValue("name")), recordType: strings.ToUpper(r.PathValue("type"))}
+	if key.name != z.name && !strings.HasSuffix(key.name, "."+z.name) {
+		writeError(w, http.StatusBadRequest, "record name is out of zone")
+		return nil, rrsetKey{}, false
+	}
+	return z, key, true
+}
+
+func (s *Server) getRRSet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, key, ok := s.lookupZone(w, r)
+	if !ok {
+		return
+	}
+	set, ok := z.rrsets[key]
+	if !ok {
+		writeError(w, http.StatusNotFound, "rrset not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, set)
+}
+
+func (s *Server) createRRSet(w http.ResponseWriter, r *http.Request) {
+	s.writeRRSet(w, r, false)
+}
+
+func (s *Server) updateRRSet(w http.ResponseWriter, r *http.Request) {
+	s.writeRRSet(w, r, true)
+}
+
+func (s *Server) writeRRSet(w http.ResponseWriter, r *http.Request, update bool) {
+	var set RRSet
+	if err := json.NewDecoder(r.Body).Decode(&set); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+		return
+	}
+	if len(set.Records) == 0 {
+		writeError(w, http.StatusBadRequest, "resource records are required")
+		return
+	}
+	for _, rr := range set.Records {
+		if len(rr.Content) == 0 {
+			writeError(w, http.StatusBadRequest, "record content is required")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, key, ok := s.lookupZone(w, r)
+	if !ok {
+		return
+	}
+	_, exists := z.rrsets[key]
+	switch {
+	case update && !exists:
+		writeError(w, http.StatusNotFound, "rrset not found")
+		return
+	case !update && exists:
+		writeError(w, http.StatusConflict, "rrset already exists")
+		return
+	}
+	z.rrsets[key] = &set
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) deleteRRSet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, key, ok := s.lookupZone(w, r)
+	if !ok {
+		return
+	}
+	if _, ok = z.rrsets[key]; !ok {
+		writeError(w, http.StatusNotFound, "rrset not found")
+		return
+	}
+	delete(z.rrsets, key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sortedZones must be called under lock
+func (s *Server) sortedZones() []*zone {
+	zones := make([]*zone, 0, len(s.zones))
+	for _, z := range s.zones {
+		zones = append(zones, z)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].name < zones[j].name })
+	return zones
+}
+
+func sortedKeys(m map[rrsetKey]*RRSet) []rrsetKey {
+	keys := make([]rrsetKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].recordType < keys[j].recordType
+	})
+	return keys
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, dns.APIError{Message: msg})
+}
@@ -0,0 +1,138 @@
+package fakeapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+)
+
+func newClient(t *testing.T, s *Server) *dns.Client {
+	t.Helper()
+	c := dns.NewClient(dns.PermanentAPIKeyAuth("token"))
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.BaseURL = u
+	return c
+}
+
+func TestServer_sdk(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.RequireAuth("APIKey token")
+	s.AddZone("example.com")
+	s.AddZone("example.org")
+
+	ctx := context.Background()
+	c := newClient(t, s)
+
+	zones, err := c.ZonesWithRecords(ctx, func(f *dns.ZonesFilter) { f.Names = []string{"example.com"} })
+	if err != nil {
+		t.Fatalf("ZonesWithRecords() error = %v", err)
+	}
+	if len(zones) != 1 || zones[0].Name != "example.com" {
+		t.Fatalf("ZonesWithRecords() = %+v", zones)
+	}
+
+	rr := dns.ResourceRecord{Enabled: true}
+	rr.SetContent("A", "1.1.1.1").AddMeta(dns.NewResourceMetaNotes("owner"))
+	err = c.AddZoneRRSet(ctx, "example.com", "www.example.com", "A", []dns.ResourceRecord{rr}, 60,
+		dns.WithFilters(dns.NewGeoDNSFilter(1, true)))
+	if err != nil {
+		t.Fatalf("AddZoneRRSet() error = %v", err)
+	}
+	rr2 := dns.ResourceRecord{Enabled: true}
+	rr2.SetContent("A", "2.2.2.2")
+	if err = c.AddZoneRRSet(ctx, "example.com", "www.example.com", "A", []dns.ResourceRecord{rr2}, 60); err != nil {
+		t.Fatalf("AddZoneRRSet() extend error = %v", err)
+	}
+
+	set, err := c.RRSet(ctx, "example.com", "www.example.com", "A")
+	if err != nil {
+		t.Fatalf("RRSet() error = %v", err)
+	}
+	if len(set.Records) != 2 {
+		t.Fatalf("RRSet() records = %+v", set.Records)
+	}
+	stored, _ := s.RRSet("example.com", "www.example.com", "A")
+	if !reflect.DeepEqual(stored.Records[1].Meta, map[string]any{"notes": []any{"owner"}}) {
+		t.Errorf("record meta is not kept: %+v", stored.Records[1].Meta)
+	}
+
+	if err = c.DeleteRRSetRecord(ctx, "example.com", "www.example.com", "A", "1.1.1.1"); err != nil {
+		t.Fatalf("DeleteRRSetRecord() error = %v", err)
+	}
+	zone, err := c.Zone(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("Zone() error = %v", err)
+	}
+	want := []dns.ZoneRecord{{Name: "www.example.com", Type: "A", TTL: 60, ShortAnswers: []string{"2.2.2.2"}}}
+	if !reflect.DeepEqual(zone.Records, want) {
+		t.Errorf("Zone() records = %+v, want %+v", zone.Records, want)
+	}
+
+	if err = c.DeleteRRSetRecord(ctx, "example.com", "www.example.com", "A", "2.2.2.2"); err != nil {
+		t.Fatalf("DeleteRRSetRecord() last record error = %v", err)
+	}
+	if _, ok := s.RRSet("example.com", "www.example.com", "A"); ok {
+		t.Error("rrset must be removed with its last record")
+	}
+
+	_, err = c.RRSet(ctx, "example.com", "www.example.com", "A")
+	apiErr := new(dns.APIError)
+	if !errors.As(err, apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("RRSet() error = %v, want 404", err)
+	}
+
+	if _, err = c.CreateZone(ctx, "new.example.net"); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+	if got := s.ZoneNames(); !reflect.DeepEqual(got, []string{"example.com", "example.org", "new.example.net"}) {
+		t.Errorf("ZoneNames() = %v", got)
+	}
+}
+
+func TestServer_faults(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+
+	ctx := context.Background()
+	c := newClient(t, s)
+
+	s.RateLimit(1)
+	_, err := c.Zones(ctx)
+	apiErr := new(dns.APIError)
+	if !errors.As(err, apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Zones() error = %v, want 429", err)
+	}
+	if _, err = c.Zones(ctx); err != nil {
+		t.Fatalf("Zones() after rate limit error = %v", err)
+	}
+
+	s.InjectFault(Fault{Method: http.MethodPut, PathPrefix: "/v2/zones/example.com", Status: http.StatusInternalServerError})
+	rr := dns.ResourceRecord{Enabled: true}
+	rr.SetContent("A", "1.1.1.1")
+	if err = c.AddZoneRRSet(ctx, "example.com", "www.example.com", "A", []dns.ResourceRecord{rr}, 60); err != nil {
+		t.Fatalf("create must not be affected by PUT fault: %v", err)
+	}
+	if err = c.AddZoneRRSet(ctx, "example.com", "www.example.com", "A", []dns.ResourceRecord{rr}, 60); err == nil {
+		t.Fatal("expected injected fault on update")
+	}
+	s.ClearFaults()
+
+	s.RequireAuth("APIKey other")
+	if _, err = c.Zones(ctx); !errors.As(err, apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Zones() error = %v, want 401", err)
+	}
+
+	if n := len(s.Requests()); n == 0 {
+		t.Error("requests are not logged")
+	}
+}
@@ -12,6 +12,7 @@ const (
 	ErrorKey   = "error"
 	DNSNameKey = "dns_name"
 	DryRunKey  = "dry_run"
+	AccountKey = "account"
 )
 
 func init() {
@@ -4,8 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	// freeze windows may use time zones missing in the image
+	_ "time/tzdata"
 
+	"github.com/Edge-Center/external-dns-ec-webhook/audit"
 	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/notify"
 	"github.com/Edge-Center/external-dns-ec-webhook/provider"
 )
 
@@ -30,7 +37,26 @@ Version %s
 
 `
 
-const ENV_SERVER_ADDR = "EC_WEBHOOK_SERVER_ADDR"
+const (
+	ENV_SERVER_ADDR        = "EC_WEBHOOK_SERVER_ADDR"
+	ENV_TLS_CERT_FILE      = "EC_WEBHOOK_TLS_CERT_FILE"
+	ENV_TLS_KEY_FILE       = "EC_WEBHOOK_TLS_KEY_FILE"
+	ENV_TLS_CLIENT_CA_FILE = "EC_WEBHOOK_TLS_CLIENT_CA_FILE"
+	ENV_TLS_MIN_VERSION    = "EC_WEBHOOK_TLS_MIN_VERSION"
+
+	ENV_READ_TOKEN_FILE     = "EC_WEBHOOK_READ_TOKEN_FILE"
+	ENV_READ_HMAC_KEY_FILE  = "EC_WEBHOOK_READ_HMAC_KEY_FILE"
+	ENV_WRITE_TOKEN_FILE    = "EC_WEBHOOK_WRITE_TOKEN_FILE"
+	ENV_WRITE_HMAC_KEY_FILE = "EC_WEBHOOK_WRITE_HMAC_KEY_FILE"
+	ENV_ADMIN_TOKEN_FILE    = "EC_WEBHOOK_ADMIN_TOKEN_FILE"
+	ENV_ADMIN_HMAC_KEY_FILE = "EC_WEBHOOK_ADMIN_HMAC_KEY_FILE"
+
+	ENV_READ_TIMEOUT     = "EC_WEBHOOK_READ_TIMEOUT"
+	ENV_WRITE_TIMEOUT    = "EC_WEBHOOK_WRITE_TIMEOUT"
+	ENV_IDLE_TIMEOUT     = "EC_WEBHOOK_IDLE_TIMEOUT"
+	ENV_SHUTDOWN_TIMEOUT = "EC_WEBHOOK_SHUTDOWN_TIMEOUT"
+	ENV_MAX_BODY_BYTES   = "EC_WEBHOOK_MAX_BODY_BYTES"
+)
 
 func main() {
 	if Version == "" {
@@ -41,12 +67,226 @@ func main() {
 	apiUrl := os.Getenv(provider.ENV_API_URL)
 	apiToken := os.Getenv(provider.ENV_API_TOKEN)
 	dryRun := os.Getenv(provider.ENV_DRY_RUN) == "true"
-	addr := os.Getenv(ENV_SERVER_ADDR)
+	serverCfg := ServerConfig{
+		Addr: os.Getenv(ENV_SERVER_ADDR),
+		TLS: TLSConfig{
+			CertFile:     os.Getenv(ENV_TLS_CERT_FILE),
+			KeyFile:      os.Getenv(ENV_TLS_KEY_FILE),
+			ClientCAFile: os.Getenv(ENV_TLS_CLIENT_CA_FILE),
+			MinVersion:   os.Getenv(ENV_TLS_MIN_VERSION),
+		},
+		Auth: AuthConfig{
+			Read: AuthRule{
+				TokenFile:   os.Getenv(ENV_READ_TOKEN_FILE),
+				HMACKeyFile: os.Getenv(ENV_READ_HMAC_KEY_FILE),
+			},
+			Write: AuthRule{
+				TokenFile:   os.Getenv(ENV_WRITE_TOKEN_FILE),
+				HMACKeyFile: os.Getenv(ENV_WRITE_HMAC_KEY_FILE),
+			},
+			Admin: AuthRule{
+				TokenFile:   os.Getenv(ENV_ADMIN_TOKEN_FILE),
+				HMACKeyFile: os.Getenv(ENV_ADMIN_HMAC_KEY_FILE),
+			},
+		},
+		ReadTimeout:     durationFromEnv(ENV_READ_TIMEOUT, DefaultReadTimeout),
+		WriteTimeout:    durationFromEnv(ENV_WRITE_TIMEOUT, DefaultWriteTimeout),
+		IdleTimeout:     durationFromEnv(ENV_IDLE_TIMEOUT, DefaultIdleTimeout),
+		ShutdownTimeout: durationFromEnv(ENV_SHUTDOWN_TIMEOUT, DefaultShutdownTimeout),
+		MaxBodyBytes:    intFromEnv(ENV_MAX_BODY_BYTES, DefaultMaxBodyBytes),
+	}
 
-	provider, err := provider.NewProvider(apiUrl, apiToken, dryRun)
+	provider, err := newProvider(apiUrl, apiToken, dryRun, providerOptions()...)
 	if err != nil {
 		log.Logger(context.Background()).Fatalf("failed to init provider: %s", err)
 	}
 
-	StartServer(provider, addr)
+	StartServer(provider, serverCfg)
+}
+
+// newProvider creates provider for accounts from EC_ACCOUNTS_FILE if it is set,
+// otherwise for the single account with EC_API_TOKEN or EC_API_TOKEN_FILE
+func newProvider(apiUrl, apiToken string, dryRun bool, opts ...provider.Option) (*provider.DnsProvider, error) {
+	accountsFile := os.Getenv(provider.ENV_ACCOUNTS_FILE)
+	if accountsFile == "" {
+		tokenFile := os.Getenv(provider.ENV_API_TOKEN_FILE)
+		if apiToken == "" && tokenFile == "" {
+			return nil, fmt.Errorf("empty API token, check env vars %s and %s", provider.ENV_API_TOKEN, provider.ENV_API_TOKEN_FILE)
+		}
+		return provider.NewMultiAccountProvider(apiUrl, []provider.Account{{
+			Alias:      provider.DefaultAccountAlias,
+			Token:      apiToken,
+			TokenFile:  tokenFile,
+			AuthScheme: os.Getenv(provider.ENV_API_AUTH_SCHEME),
+		}}, dryRun, opts...)
+	}
+	accounts, err := provider.LoadAccounts(accountsFile)
+	if err != nil {
+		return nil, err
+	}
+	return provider.NewMultiAccountProvider(apiUrl, accounts, dryRun, opts...)
+}
+
+// providerOptions reads optional provider features from env
+func providerOptions() []provider.Option {
+	var opts []provider.Option
+	skipPolicy, err := provider.ParseSkipPolicy(os.Getenv(provider.ENV_SKIP_POLICY))
+	if err != nil {
+		log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_SKIP_POLICY, err)
+	}
+	opts = append(opts, provider.WithSkipPolicy(skipPolicy))
+	disabledPolicy, err := provider.ParseDisabledPolicy(os.Getenv(provider.ENV_DISABLED_RECORDS_POLICY))
+	if err != nil {
+		log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_DISABLED_RECORDS_POLICY, err)
+	}
+	opts = append(opts, provider.WithDisabledPolicy(disabledPolicy))
+	opts = append(opts, provider.WithRRSetCacheMaxAge(durationFromEnv(provider.ENV_RRSET_CACHE_MAX_AGE, provider.DefaultRRSetCacheMaxAge)))
+	if os.Getenv(provider.ENV_RECORDS_UNICODE) == "true" {
+		opts = append(opts, provider.WithUnicodeNames())
+	}
+	switch registry := os.Getenv(provider.ENV_REGISTRY); registry {
+	case "", provider.RegistryTXT:
+	case provider.RegistryMeta:
+		opts = append(opts, provider.WithMetaRegistry(
+			os.Getenv(provider.ENV_REGISTRY_TXT_PREFIX),
+			os.Getenv(provider.ENV_REGISTRY_TXT_SUFFIX),
+			os.Getenv(provider.ENV_REGISTRY_TXT_WILDCARD_REPLACEMENT),
+		))
+	default:
+		log.Logger(context.Background()).Fatalf("invalid %s: unknown registry '%s', expected %s or %s",
+			provider.ENV_REGISTRY, registry, provider.RegistryTXT, provider.RegistryMeta)
+	}
+	if os.Getenv(provider.ENV_RECORD_NOTES) != "false" {
+		opts = append(opts, provider.WithProvenanceNotes(os.Getenv(provider.ENV_CLUSTER_NAME)))
+	}
+	if os.Getenv(provider.ENV_REVERSE_RECORDS) == "true" {
+		opts = append(opts, provider.WithReverseRecords())
+	}
+	if stateFile := os.Getenv(provider.ENV_DRIFT_STATE_FILE); stateFile != "" {
+		interval := durationFromEnv(provider.ENV_DRIFT_INTERVAL, provider.DefaultDriftInterval)
+		opts = append(opts, provider.WithDriftDetection(stateFile, interval, os.Getenv(provider.ENV_DRIFT_RESTORE) == "true"))
+	}
+	if sink := auditSink(); sink != nil {
+		opts = append(opts, provider.WithAuditSink(sink))
+	}
+	if targetsFile := os.Getenv(provider.ENV_NOTIFY_TARGETS_FILE); targetsFile != "" {
+		targets, err := notify.LoadTargets(targetsFile)
+		if err != nil {
+			log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_NOTIFY_TARGETS_FILE, err)
+		}
+		notifier, err := notify.NewNotifier(targets)
+		if err != nil {
+			log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_NOTIFY_TARGETS_FILE, err)
+		}
+		opts = append(opts, provider.WithNotifier(notifier))
+	}
+	if freezeFile := os.Getenv(provider.ENV_FREEZE_FILE); freezeFile != "" {
+		mode, err := provider.ParseFreezeMode(os.Getenv(provider.ENV_FREEZE_MODE))
+		if err != nil {
+			log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_FREEZE_MODE, err)
+		}
+		windows, err := provider.LoadFreezeWindows(freezeFile)
+		if err != nil {
+			log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_FREEZE_FILE, err)
+		}
+		freeze, err := provider.NewFreeze(windows, mode, os.Getenv(provider.ENV_FREEZE_OVERRIDE_FILE))
+		if err != nil {
+			log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_FREEZE_FILE, err)
+		}
+		opts = append(opts, provider.WithFreeze(freeze))
+	}
+	if zones := listFromEnv(provider.ENV_APPROVAL_ZONES); len(zones) > 0 {
+		stateFile := os.Getenv(provider.ENV_APPROVAL_STATE_FILE)
+		if stateFile == "" {
+			log.Logger(context.Background()).Fatalf("%s is required with %s", provider.ENV_APPROVAL_STATE_FILE, provider.ENV_APPROVAL_ZONES)
+		}
+		expiry := durationFromEnv(provider.ENV_APPROVAL_EXPIRY, provider.DefaultApprovalExpiry)
+		opts = append(opts, provider.WithApprovals(zones, stateFile, expiry))
+	}
+	if journalFile := os.Getenv(provider.ENV_ASYNC_JOURNAL_FILE); journalFile != "" {
+		journal, err := provider.OpenJournal(journalFile)
+		if err != nil {
+			log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_ASYNC_JOURNAL_FILE, err)
+		}
+		opts = append(opts, provider.WithJournal(journal))
+	}
+	if suffixes := listFromEnv(provider.ENV_ZONE_CREATION_SUFFIXES); len(suffixes) > 0 {
+		limit := intFromEnv(provider.ENV_ZONE_CREATION_LIMIT, provider.DefaultZoneCreationLimit)
+		opts = append(opts, provider.WithZoneCreation(suffixes, int(limit)))
+	}
+	return opts
+}
+
+// auditSink creates sinks for EC_AUDIT_FILE and EC_AUDIT_URL, nil if neither is set
+func auditSink() audit.Sink {
+	var sinks []audit.Sink
+	if path := os.Getenv(provider.ENV_AUDIT_FILE); path != "" {
+		sink, err := audit.NewFileSink(path,
+			intFromEnv(provider.ENV_AUDIT_FILE_MAX_BYTES, provider.DefaultAuditFileMaxBytes),
+			int(intFromEnv(provider.ENV_AUDIT_FILE_MAX_BACKUPS, provider.DefaultAuditFileMaxBackups)))
+		if err != nil {
+			log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_AUDIT_FILE, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if url := os.Getenv(provider.ENV_AUDIT_URL); url != "" {
+		var token string
+		if tokenFile := os.Getenv(provider.ENV_AUDIT_TOKEN_FILE); tokenFile != "" {
+			b, err := os.ReadFile(tokenFile)
+			if err != nil {
+				log.Logger(context.Background()).Fatalf("invalid %s: %s", provider.ENV_AUDIT_TOKEN_FILE, err)
+			}
+			token = strings.TrimSpace(string(b))
+		}
+		sinks = append(sinks, audit.NewHTTPSink(url, token, durationFromEnv(provider.ENV_AUDIT_TIMEOUT, provider.DefaultAuditTimeout)))
+	}
+	// every sink writes in background and retries failures on its own, so a slow sink doesn't delay others
+	size := int(intFromEnv(provider.ENV_AUDIT_BUFFER_SIZE, provider.DefaultAuditBufferSize))
+	for i, sink := range sinks {
+		sinks[i] = audit.NewAsyncSink(sink, size)
+	}
+	switch len(sinks) {
+	case 0:
+		return nil
+	case 1:
+		return sinks[0]
+	}
+	return audit.Multi(sinks...)
+}
+
+// listFromEnv reads comma separated list from env var
+func listFromEnv(name string) []string {
+	var res []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// durationFromEnv reads duration like "30s" from env var, def is used if var is not set
+func durationFromEnv(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Logger(context.Background()).Fatalf("invalid duration in %s: %s", name, err)
+	}
+	return d
+}
+
+// intFromEnv reads integer from env var, def is used if var is not set
+func intFromEnv(name string, def int64) int64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		log.Logger(context.Background()).Fatalf("invalid integer in %s: %s", name, err)
+	}
+	return i
 }
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const mediaTypeWebhook = "application/external.dns.webhook+json"
+
+// SupportedProtocolVersions are versions of external-dns webhook protocol served by the API
+var SupportedProtocolVersions = []string{"1"}
+
+var (
+	errNoMediaType          = errors.New("no media type")
+	errUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+// contentTypeForVersion builds media type of webhook protocol of the given version
+func contentTypeForVersion(version string) string {
+	return mediaTypeWebhook + ";version=" + version
+}
+
+// highestVersion returns the greatest of numeric versions
+func highestVersion(versions []string) string {
+	sorted := append([]string(nil), versions...)
+	sort.Slice(sorted, func(i, j int) bool { return versionLess(sorted[i], sorted[j]) })
+	return sorted[len(sorted)-1]
+}
+
+func versionLess(a, b string) bool {
+	ai, aErr := strconv.Atoi(a)
+	bi, bErr := strconv.Atoi(b)
+	if aErr != nil || bErr != nil {
+		return a < b
+	}
+	return ai < bi
+}
+
+func isSupportedVersion(version string) bool {
+	for _, v := range SupportedProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// parseContentType returns protocol version declared by Content-Type header
+func parseContentType(header string) (string, error) {
+	if strings.TrimSpace(header) == "" {
+		return "", errNoMediaType
+	}
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", errUnsupportedMediaType, err)
+	}
+	if mediaType != mediaTypeWebhook {
+		return "", fmt.Errorf("%w '%s'", errUnsupportedMediaType, mediaType)
+	}
+	version := params["version"]
+	if !isSupportedVersion(version) {
+		return "", fmt.Errorf("%w: protocol version '%s' is not supported", errUnsupportedMediaType, version)
+	}
+	return version, nil
+}
+
+// negotiateAccept chooses protocol version for response according to Accept header (RFC 9110, section 12.5.1).
+// Entry with the highest weight wins, between entries of the same weight the highest version is chosen.
+// Wildcards and webhook media type without version match the highest supported version.
+func negotiateAccept(header string) (string, error) {
+	if strings.TrimSpace(header) == "" {
+		return "", errNoMediaType
+	}
+
+	bestVersion, bestQ := "", 0.0
+	for _, item := range splitAccept(header) {
+		mediaType, params, err := mime.ParseMediaType(item)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		if q == 0 {
+			continue
+		}
+
+		var version string
+		switch mediaType {
+		case "*/*", "application/*":
+			version = highestVersion(SupportedProtocolVersions)
+		case mediaTypeWebhook:
+			version = params["version"]
+			if version == "" {
+				version = highestVersion(SupportedProtocolVersions)
+			}
+			if !isSupportedVersion(version) {
+				continue
+			}
+		default:
+			continue
+		}
+
+		if q > bestQ || (q == bestQ && versionLess(bestVersion, version)) {
+			bestVersion, bestQ = version, q
+		}
+	}
+
+	if bestVersion == "" {
+		return "", fmt.Errorf("%w: none of accepted media types is supported", errUnsupportedMediaType)
+	}
+	return bestVersion, nil
+}
+
+// splitAccept splits Accept header by commas which are not inside quoted strings
+func splitAccept(header string) []string {
+	items := make([]string, 0)
+	inQuotes, escaped, start := false, false, 0
+	for i, c := range header {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && inQuotes:
+			escaped = true
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == ',' && !inQuotes:
+			items = append(items, strings.TrimSpace(header[start:i]))
+			start = i + 1
+		}
+	}
+	items = append(items, strings.TrimSpace(header[start:]))
+	return items
+}
+
+// headerError tells which of media type headers failed validation
+type headerError struct {
+	header string
+	err    error
+}
+
+func (e *headerError) Error() string {
+	return fmt.Sprintf("'%s' header: %s", e.header, e.err)
+}
+
+func (e *headerError) Unwrap() error {
+	return e.err
+}
+
+// negotiateVersion validates media type headers of request and returns protocol version to respond with.
+// POST requests must declare a supported version in Content-Type, response version follows Accept if it's present.
+func negotiateVersion(r *http.Request) (string, error) {
+	accept := r.Header.Get(HeaderAccept)
+
+	if r.Method == http.MethodPost {
+		version, err := parseContentType(r.Header.Get(HeaderContentType))
+		if err != nil {
+			return "", &headerError{header: HeaderContentType, err: err}
+		}
+		if strings.TrimSpace(accept) == "" {
+			return version, nil
+		}
+		if version, err = negotiateAccept(accept); err != nil {
+			return "", &headerError{header: HeaderAccept, err: err}
+		}
+		return version, nil
+	}
+
+	version, err := negotiateAccept(accept)
+	if err != nil {
+		return "", &headerError{header: HeaderAccept, err: err}
+	}
+	return version, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_negotiateAccept(t *testing.T) {
+	defer func(v []string) { SupportedProtocolVersions = v }(SupportedProtocolVersions)
+	SupportedProtocolVersions = []string{"1", "2"}
+
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{name: "exact", header: "application/external.dns.webhook+json;version=1", want: "1"},
+		{name: "spacing", header: "application/external.dns.webhook+json; version=1", want: "1"},
+		{name: "case and quotes", header: `Application/External.DNS.Webhook+JSON; Version="2"`, want: "2"},
+		{name: "highest of several", header: "application/external.dns.webhook+json;version=1, application/external.dns.webhook+json;version=2", want: "2"},
+		{name: "weight wins", header: "application/external.dns.webhook+json;version=1;q=1, application/external.dns.webhook+json;version=2;q=0.5", want: "1"},
+		{name: "excluded by zero weight", header: "application/external.dns.webhook+json;version=2;q=0, application/external.dns.webhook+json;version=1", want: "1"},
+		{name: "unsupported version is skipped", header: "application/external.dns.webhook+json;version=3, application/external.dns.webhook+json;version=1", want: "1"},
+		{name: "any", header: "*/*", want: "2"},
+		{name: "application wildcard", header: "text/html, application/*;q=0.8", want: "2"},
+		{name: "without version", header: "application/external.dns.webhook+json", want: "2"},
+		{name: "only unsupported", header: "application/json, text/plain", wantErr: true},
+		{name: "empty", header: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := negotiateAccept(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("negotiateAccept() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("negotiateAccept() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseContentType(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr error
+	}{
+		{name: "exact", header: ContentTypeAppJson, want: "1"},
+		{name: "spacing", header: "application/external.dns.webhook+json ; version=1", want: "1"},
+		{name: "unsupported version", header: "application/external.dns.webhook+json;version=2", wantErr: errUnsupportedMediaType},
+		{name: "without version", header: "application/external.dns.webhook+json", wantErr: errUnsupportedMediaType},
+		{name: "other type", header: "application/json", wantErr: errUnsupportedMediaType},
+		{name: "empty", header: " ", wantErr: errNoMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseContentType(tt.header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseContentType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseContentType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitAPI_negotiation(t *testing.T) {
+	api, err := InitAPI(nil, ServerConfig{})
+	if err != nil {
+		t.Fatalf("InitAPI() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/adjustendpoints", nil)
+	req.Header.Set(HeaderContentType, "application/external.dns.webhook+json; version=1")
+	req.Header.Set(HeaderAccept, "application/json;q=0.9, */*;q=0.1")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	// empty body can't be decoded, but headers were accepted
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/records", nil)
+	req.Header.Set(HeaderAccept, "application/external.dns.webhook+json;version=7")
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotAcceptable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotAcceptable)
+	}
+}
@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "edgecenter_webhook"
+
+	AccountLabel   = "account"
+	OperationLabel = "operation"
+	StatusLabel    = "status"
+	ActionLabel    = "action"
+	ReasonLabel    = "reason"
+	WindowLabel    = "window"
+	ModeLabel      = "mode"
+
+	StatusOK         = "ok"
+	StatusError      = "error"
+	StatusSuperseded = "superseded"
+)
+
+// Registry holds all webhook metrics, it is served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	// APIRequests counts EdgeCenter API calls by account alias, SDK operation and response status
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Number of EdgeCenter DNS API calls.",
+	}, []string{AccountLabel, OperationLabel, StatusLabel})
+
+	// APIRequestDuration observes latency of EdgeCenter API calls by account alias and SDK operation
+	APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of EdgeCenter DNS API calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{AccountLabel, OperationLabel})
+
+	// AccountZones is the number of zones served through an account
+	AccountZones = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "account_zones",
+		Help:      "Number of zones managed through an EdgeCenter account.",
+	}, []string{AccountLabel})
+
+	// SkippedChanges counts changes which were not applied by action and reason
+	SkippedChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "skipped_changes_total",
+		Help:      "Number of changes skipped by ApplyChanges.",
+	}, []string{ActionLabel, ReasonLabel})
+
+	// TokenReloads counts reloads of account API tokens from files by result
+	TokenReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_token_reloads_total",
+		Help:      "Number of EdgeCenter API token reloads from file.",
+	}, []string{AccountLabel, StatusLabel})
+
+	// DriftChecks counts background comparisons of live records with applied ones by result
+	DriftChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drift_checks_total",
+		Help:      "Number of drift checks of applied records.",
+	}, []string{StatusLabel})
+
+	// DriftedRecords is the number of applied records found drifted by the last check by reason
+	DriftedRecords = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "drifted_records",
+		Help:      "Number of applied records changed out-of-band at the last drift check.",
+	}, []string{ReasonLabel})
+
+	// DriftRestores counts attempts to restore drifted records by result
+	DriftRestores = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drift_restores_total",
+		Help:      "Number of attempts to restore drifted records.",
+	}, []string{StatusLabel})
+
+	// AuditEntries counts audit entries of applied changes by result of writing them to the audit sink
+	AuditEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_entries_total",
+		Help:      "Number of audit entries written for applied changes.",
+	}, []string{StatusLabel})
+
+	// Notifications counts deliveries of applied changes summaries to notification targets by result
+	Notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Number of applied changes summaries delivered to notification targets.",
+	}, []string{StatusLabel})
+
+	// FrozenChanges counts changes refused or queued during freeze windows by window name and freeze mode
+	FrozenChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "frozen_changes_total",
+		Help:      "Number of changes refused or queued during freeze windows.",
+	}, []string{WindowLabel, ModeLabel})
+
+	// QueuedChanges is the number of changes queued until freeze windows end
+	QueuedChanges = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queued_changes",
+		Help:      "Number of changes queued until freeze windows end.",
+	})
+
+	// Approvals is the number of updates and deletes held for approval by status
+	Approvals = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "approvals",
+		Help:      "Number of updates and deletes held for approval.",
+	}, []string{StatusLabel})
+
+	// JournalDepth is the number of plans in the async apply journal, including the one being applied
+	JournalDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "journal_depth",
+		Help:      "Number of plans in the async apply journal.",
+	})
+
+	// JournalApplies counts plans from the async apply journal by status: ok, error or superseded by a newer plan
+	JournalApplies = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "journal_applies_total",
+		Help:      "Number of plans from the async apply journal by status.",
+	}, []string{StatusLabel})
+
+	// JournalApplyLag is the time from acknowledging a plan to finishing its apply
+	JournalApplyLag = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "journal_apply_lag_seconds",
+		Help:      "Time from acknowledging a plan to finishing its apply.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		APIRequests,
+		APIRequestDuration,
+		AccountZones,
+		TokenReloads,
+		SkippedChanges,
+		DriftChecks,
+		DriftedRecords,
+		DriftRestores,
+		AuditEntries,
+		Notifications,
+		FrozenChanges,
+		QueuedChanges,
+		Approvals,
+		JournalDepth,
+		JournalApplies,
+		JournalApplyLag,
+	)
+}
+
+// Handler serves metrics from Registry in Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveAPIRequest records a finished EdgeCenter API call started at start
+func ObserveAPIRequest(account, operation string, start time.Time, err error) {
+	APIRequestDuration.WithLabelValues(account, operation).Observe(time.Since(start).Seconds())
+	APIRequests.WithLabelValues(account, operation, status(err)).Inc()
+}
+
+// status is HTTP status code of API error, so rate limits and outages are distinguishable
+func status(err error) string {
+	if err == nil {
+		return StatusOK
+	}
+	apiErr := new(dns.APIError)
+	if errors.As(err, apiErr) {
+		return strconv.Itoa(apiErr.StatusCode)
+	}
+	return StatusError
+}
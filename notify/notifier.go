@@ -0,0 +1,258 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	HeaderTimestamp = "X-EC-Webhook-Timestamp"
+	HeaderSignature = "X-EC-Webhook-Signature"
+
+	DefaultRetries = 3
+	DefaultTimeout = 10 * time.Second
+)
+
+// retryInterval is the delay before the first retry, it doubles with every next one
+var retryInterval = time.Second
+
+// Target is a webhook receiving summaries
+type Target struct {
+	URL string `json:"url"`
+	// Template is a text/template executed with Summary to build the request body, JSON of Summary is posted if empty.
+	// The json function encodes a value as JSON, e.g. {"text": {{ json .Severity }}}
+	Template    string `json:"template,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	// SecretFile contains key signing requests with X-EC-Webhook-Signature header, which is
+	// hex(HMAC-SHA256(key, timestamp + "\n" + body)) where timestamp is X-EC-Webhook-Timestamp header
+	SecretFile string `json:"secretFile,omitempty"`
+	// Zones limits summaries to changes in these zones and their subzones
+	Zones []string `json:"zones,omitempty"`
+	// MinSeverity skips summaries less severe than info, warning or error
+	MinSeverity string `json:"minSeverity,omitempty"`
+	// Retries of failed deliveries, DefaultRetries if nil
+	Retries *int `json:"retries,omitempty"`
+	// Timeout of a single delivery like "10s", DefaultTimeout if empty
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// LoadTargets reads targets list from YAML or JSON file
+func LoadTargets(path string) ([]Target, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification targets file: %w", err)
+	}
+	targets := make([]Target, 0)
+	if err = yaml.UnmarshalStrict(b, &targets); err != nil {
+		return nil, fmt.Errorf("failed to parse notification targets file %s: %w", path, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no notification targets in %s", path)
+	}
+	return targets, nil
+}
+
+// target is a validated Target
+type target struct {
+	Target
+	template    *template.Template
+	secret      []byte
+	minSeverity int
+	retries     int
+	client      *http.Client
+}
+
+func newTarget(t Target) (*target, error) {
+	if t.URL == "" {
+		return nil, errors.New("empty url")
+	}
+	res := &target{Target: t, retries: DefaultRetries, client: &http.Client{Timeout: DefaultTimeout}}
+	if t.Template != "" {
+		tmpl, err := template.New(t.URL).Funcs(template.FuncMap{"json": toJSON}).Parse(t.Template)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid template: %w", t.URL, err)
+		}
+		res.template = tmpl
+	}
+	if res.ContentType == "" {
+		res.ContentType = "application/json"
+	}
+	if t.SecretFile != "" {
+		b, err := os.ReadFile(t.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to read secret: %w", t.URL, err)
+		}
+		res.secret = bytes.TrimSpace(b)
+	}
+	if t.MinSeverity != "" {
+		if res.minSeverity = severityLevel(strings.ToLower(t.MinSeverity)); res.minSeverity < 0 {
+			return nil, fmt.Errorf("%s: unknown severity '%s', expected %s", t.URL, t.MinSeverity, strings.Join(severities, ", "))
+		}
+	}
+	if t.Retries != nil {
+		if *t.Retries < 0 {
+			return nil, fmt.Errorf("%s: negative retries", t.URL)
+		}
+		res.retries = *t.Retries
+	}
+	if t.Timeout != "" {
+		timeout, err := time.ParseDuration(t.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid timeout: %w", t.URL, err)
+		}
+		res.client.Timeout = timeout
+	}
+	return res, nil
+}
+
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// Notifier delivers summaries to targets in background
+type Notifier struct {
+	targets []*target
+	wg      sync.WaitGroup
+	// stop cancels deliveries in progress once Wait gives up
+	stop   context.Context
+	cancel context.CancelFunc
+}
+
+// NewNotifier validates targets, reads their secrets and parses templates
+func NewNotifier(targets []Target) (*Notifier, error) {
+	n := &Notifier{}
+	n.stop, n.cancel = context.WithCancel(context.Background())
+	for i, t := range targets {
+		parsed, err := newTarget(t)
+		if err != nil {
+			return nil, fmt.Errorf("notification target %d: %w", i, err)
+		}
+		n.targets = append(n.targets, parsed)
+	}
+	return n, nil
+}
+
+// Notify starts delivery of summary to targets it passes filters of, deliveries aren't canceled with ctx
+func (n *Notifier) Notify(ctx context.Context, s Summary) {
+	ctx = context.WithoutCancel(ctx)
+	for _, t := range n.targets {
+		filtered := s.forZones(t.Zones)
+		if filtered.empty() || severityLevel(filtered.Severity) < t.minSeverity {
+			continue
+		}
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			defer context.AfterFunc(n.stop, cancel)()
+			if err := t.deliver(ctx, filtered); err != nil {
+				metrics.Notifications.WithLabelValues(metrics.StatusError).Inc()
+				log.Logger(ctx).WithField(log.ErrorKey, err).Errorf("failed to notify %s", t.URL)
+				return
+			}
+			metrics.Notifications.WithLabelValues(metrics.StatusOK).Inc()
+		}()
+	}
+}
+
+// Wait blocks until started deliveries finish, if ctx is done first the deliveries are canceled
+func (n *Notifier) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		return fmt.Errorf("notifications left undelivered: %w", ctx.Err())
+	}
+}
+
+// deliver posts summary retrying network errors, 429 and 5xx responses with exponential backoff
+func (t *target) deliver(ctx context.Context, s Summary) error {
+	body, err := t.body(s)
+	if err != nil {
+		return err
+	}
+	delay := retryInterval
+	for attempt := 0; ; attempt++ {
+		retry, err := t.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= t.retries {
+			return err
+		}
+		log.Logger(ctx).WithField(log.ErrorKey, err).Debugf("notification to %s failed, retrying in %s", t.URL, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+func (t *target) body(s Summary) ([]byte, error) {
+	if t.template == nil {
+		return json.Marshal(s)
+	}
+	var b bytes.Buffer
+	if err := t.template.Execute(&b, s); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// post sends body once, retry is true if the failure may be temporary
+func (t *target) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", t.ContentType)
+	if t.secret != nil {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, t.secret)
+		mac.Write([]byte(ts + "\n"))
+		mac.Write(body)
+		req.Header.Set(HeaderTimestamp, ts)
+		req.Header.Set(HeaderSignature, hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
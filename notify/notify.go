@@ -0,0 +1,165 @@
+// Package notify posts summaries of applied changes to HTTP webhooks, e.g. of an on-call chat
+package notify
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// severities are ordered from the least to the most severe
+var severities = []string{SeverityInfo, SeverityWarning, SeverityError}
+
+// Change is a single change of a record, Error is set for failed and skipped changes
+type Change struct {
+	Action        string   `json:"action"`
+	Zone          string   `json:"zone,omitempty"`
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	SetIdentifier string   `json:"setIdentifier,omitempty"`
+	Targets       []string `json:"targets,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// ZoneSummary lists changes of a zone
+type ZoneSummary struct {
+	Zone    string   `json:"zone"`
+	Created int      `json:"created"`
+	Updated int      `json:"updated"`
+	Deleted int      `json:"deleted"`
+	Failed  int      `json:"failed"`
+	Changes []Change `json:"changes"`
+}
+
+// Summary is the result of a single ApplyChanges
+type Summary struct {
+	Time     time.Time     `json:"time"`
+	TraceID  string        `json:"traceId,omitempty"`
+	DryRun   bool          `json:"dryRun"`
+	Severity string        `json:"severity"`
+	Created  int           `json:"created"`
+	Updated  int           `json:"updated"`
+	Deleted  int           `json:"deleted"`
+	Failed   int           `json:"failed"`
+	Zones    []ZoneSummary `json:"zones"`
+	Failures []Change      `json:"failures"`
+	Skipped  []Change      `json:"skipped"`
+	// Error is the error returned by ApplyChanges
+	Error string `json:"error,omitempty"`
+}
+
+// NewSummary groups changes by zone, counts them and sets severity: error if any change failed,
+// warning if any change was skipped, info otherwise
+func NewSummary(changes, skipped []Change, err error) Summary {
+	s := Summary{Time: time.Now().UTC(), Zones: make([]ZoneSummary, 0), Failures: make([]Change, 0), Skipped: skipped}
+	if s.Skipped == nil {
+		s.Skipped = make([]Change, 0)
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	byZone := make(map[string]*ZoneSummary)
+	for _, c := range changes {
+		z, ok := byZone[c.Zone]
+		if !ok {
+			z = &ZoneSummary{Zone: c.Zone}
+			byZone[c.Zone] = z
+		}
+		z.Changes = append(z.Changes, c)
+	}
+	for _, z := range byZone {
+		s.Zones = append(s.Zones, *z)
+	}
+	slices.SortFunc(s.Zones, func(a, b ZoneSummary) int { return strings.Compare(a.Zone, b.Zone) })
+	s.count()
+	return s
+}
+
+// count updates counters, failures and severity from changes of zones
+func (s *Summary) count() {
+	s.Created, s.Updated, s.Deleted, s.Failed = 0, 0, 0, 0
+	s.Failures = s.Failures[:0]
+	for i := range s.Zones {
+		z := &s.Zones[i]
+		z.Created, z.Updated, z.Deleted, z.Failed = 0, 0, 0, 0
+		for _, c := range z.Changes {
+			switch {
+			case c.Error != "":
+				z.Failed++
+				s.Failures = append(s.Failures, c)
+			case c.Action == "create":
+				z.Created++
+			case c.Action == "update":
+				z.Updated++
+			case c.Action == "delete":
+				z.Deleted++
+			}
+		}
+		s.Created += z.Created
+		s.Updated += z.Updated
+		s.Deleted += z.Deleted
+		s.Failed += z.Failed
+	}
+	switch {
+	case s.Failed > 0 || s.Error != "":
+		s.Severity = SeverityError
+	case len(s.Skipped) > 0:
+		s.Severity = SeverityWarning
+	default:
+		s.Severity = SeverityInfo
+	}
+}
+
+// empty is true if nothing was changed, skipped or failed
+func (s *Summary) empty() bool {
+	return len(s.Zones) == 0 && len(s.Skipped) == 0 && s.Error == ""
+}
+
+// forZones returns summary of changes in zones and their subzones, skipped changes are matched by record name.
+// Error of ApplyChanges isn't kept as it isn't specific to a zone.
+func (s Summary) forZones(zones []string) Summary {
+	if len(zones) == 0 {
+		return s
+	}
+	res := s
+	res.Zones, res.Skipped, res.Failures, res.Error = nil, nil, make([]Change, 0), ""
+	for _, z := range s.Zones {
+		if inZones(z.Zone, zones) {
+			res.Zones = append(res.Zones, z)
+		}
+	}
+	for _, c := range s.Skipped {
+		if inZones(c.Name, zones) {
+			res.Skipped = append(res.Skipped, c)
+		}
+	}
+	if res.Zones == nil {
+		res.Zones = make([]ZoneSummary, 0)
+	}
+	if res.Skipped == nil {
+		res.Skipped = make([]Change, 0)
+	}
+	res.count()
+	return res
+}
+
+func inZones(name string, zones []string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, z := range zones {
+		z = strings.ToLower(strings.TrimSuffix(z, "."))
+		if name == z || strings.HasSuffix(name, "."+z) {
+			return true
+		}
+	}
+	return false
+}
+
+func severityLevel(severity string) int {
+	return slices.Index(severities, severity)
+}
@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewSummary(t *testing.T) {
+	s := NewSummary([]Change{
+		{Action: "create", Zone: "b.com", Name: "www.b.com"},
+		{Action: "update", Zone: "a.com", Name: "www.a.com"},
+		{Action: "delete", Zone: "a.com", Name: "old.a.com"},
+		{Action: "create", Zone: "a.com", Name: "new.a.com", Error: "api is down"},
+	}, []Change{{Action: "create", Name: "www.c.com", Error: "no such zone"}}, nil)
+
+	if s.Created != 1 || s.Updated != 1 || s.Deleted != 1 || s.Failed != 1 || s.Severity != SeverityError {
+		t.Errorf("NewSummary() = %+v", s)
+	}
+	if len(s.Zones) != 2 || s.Zones[0].Zone != "a.com" || s.Zones[0].Failed != 1 || s.Zones[1].Created != 1 {
+		t.Errorf("zones = %+v", s.Zones)
+	}
+	if len(s.Failures) != 1 || s.Failures[0].Name != "new.a.com" {
+		t.Errorf("failures = %+v", s.Failures)
+	}
+
+	b := s.forZones([]string{"B.com."})
+	if b.Severity != SeverityInfo || b.Created != 1 || b.Failed != 0 || len(b.Zones) != 1 || len(b.Skipped) != 0 {
+		t.Errorf("forZones(b.com) = %+v", b)
+	}
+	if c := s.forZones([]string{"c.com"}); c.Severity != SeverityWarning || len(c.Zones) != 0 || c.empty() {
+		t.Errorf("forZones(c.com) = %+v", c)
+	}
+	if d := s.forZones([]string{"d.com"}); !d.empty() {
+		t.Errorf("forZones(d.com) = %+v, want empty", d)
+	}
+	// the original summary is intact
+	if s.Failed != 1 || len(s.Failures) != 1 || len(s.Skipped) != 1 {
+		t.Errorf("summary changed by forZones() = %+v", s)
+	}
+}
+
+type receiver struct {
+	mu       sync.Mutex
+	bodies   []string
+	failures int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	b, _ := io.ReadAll(r.Body)
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if ts := r.Header.Get(HeaderTimestamp); ts != "" {
+		mac := hmac.New(sha256.New, []byte("key"))
+		mac.Write([]byte(ts + "\n"))
+		mac.Write(b)
+		if r.Header.Get(HeaderSignature) != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	rc.bodies = append(rc.bodies, r.URL.Path+" "+string(b))
+}
+
+func TestNotifier(t *testing.T) {
+	retryInterval = time.Millisecond
+	rc := &receiver{failures: 2}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	noRetries := 0
+
+	n, err := NewNotifier([]Target{
+		{URL: srv.URL + "/all", Template: `{"text": {{ json (printf "%d created" .Created) }}}`, SecretFile: secretFile},
+		{URL: srv.URL + "/errors", MinSeverity: "ERROR", Template: "{{ .Severity }}"},
+		{URL: srv.URL + "/b", Zones: []string{"b.com"}, Template: "{{ range .Zones }}{{ .Zone }}{{ end }}", Retries: &noRetries},
+	})
+	if err != nil {
+		t.Fatalf("NewNotifier() error = %v", err)
+	}
+	n.Notify(context.Background(), NewSummary([]Change{{Action: "create", Zone: "a.com", Name: "www.a.com"}}, nil, nil))
+	if err = n.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	n.Notify(context.Background(), NewSummary(nil, nil, errors.New("failed")))
+	if err = n.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	// /b doesn't retry and isn't notified about changes in other zones, /all succeeds after 2 retries
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	want := map[string]bool{`/all {"text": "1 created"}`: true, `/all {"text": "0 created"}`: true, "/errors error": true}
+	if len(rc.bodies) != len(want) {
+		t.Fatalf("received %q, want %v", rc.bodies, want)
+	}
+	for _, b := range rc.bodies {
+		if !want[b] {
+			t.Errorf("unexpected notification %q", b)
+		}
+	}
+}
+
+func TestNotifier_WaitCancelsRetries(t *testing.T) {
+	retryInterval = time.Hour
+	defer func() { retryInterval = time.Millisecond }()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier([]Target{{URL: srv.URL}})
+	if err != nil {
+		t.Fatalf("NewNotifier() error = %v", err)
+	}
+	n.Notify(context.Background(), NewSummary(nil, nil, errors.New("failed")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = n.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want deadline exceeded", err)
+	}
+	// the delivery waiting for its retry is canceled, so it finishes right away
+	if err = n.Wait(context.Background()); err != nil {
+		t.Errorf("Wait() after cancel error = %v", err)
+	}
+}
+
+func TestNewNotifier_invalid(t *testing.T) {
+	negative := -1
+	for _, target := range []Target{
+		{},
+		{URL: "http://localhost", Template: "{{ .Missing"},
+		{URL: "http://localhost", MinSeverity: "critical"},
+		{URL: "http://localhost", Retries: &negative},
+		{URL: "http://localhost", Timeout: "soon"},
+		{URL: "http://localhost", SecretFile: "/nonexistent"},
+	} {
+		if _, err := NewNotifier([]Target{target}); err == nil {
+			t.Errorf("NewNotifier(%+v) error = nil", target)
+		}
+	}
+}
+
+func TestLoadTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	_ = os.WriteFile(path, []byte("- url: http://localhost\n  zones: [example.com]\n  minSeverity: warning\n  retries: 0\n"), 0o600)
+	targets, err := LoadTargets(path)
+	if err != nil {
+		t.Fatalf("LoadTargets() error = %v", err)
+	}
+	if len(targets) != 1 || targets[0].Zones[0] != "example.com" || targets[0].Retries == nil || *targets[0].Retries != 0 {
+		t.Errorf("LoadTargets() = %+v", targets)
+	}
+
+	_ = os.WriteFile(path, []byte("- url: http://localhost\n  unknown: true\n"), 0o600)
+	if _, err = LoadTargets(path); err == nil {
+		t.Errorf("LoadTargets() with unknown field error = nil")
+	}
+}
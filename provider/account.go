@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ENV_ACCOUNTS_FILE = "EC_ACCOUNTS_FILE"
+
+	// DefaultAccountAlias names the only account created from EC_API_TOKEN
+	DefaultAccountAlias = "default"
+)
+
+// Account is an EdgeCenter account and zones managed through it.
+// Alias is used in logs and metrics, so tokens never leak there.
+type Account struct {
+	Alias string `json:"alias"`
+	Token string `json:"token,omitempty"`
+	// TokenFile is watched for changes, so the token can be rotated without restart
+	TokenFile string `json:"tokenFile,omitempty"`
+	// AuthScheme is either apikey (default) or bearer
+	AuthScheme string `json:"authScheme,omitempty"`
+	// Zones limits zones served by the account, all zones visible with the token are served if empty
+	Zones []string `json:"zones,omitempty"`
+}
+
+// LoadAccounts reads accounts list from YAML or JSON file
+func LoadAccounts(path string) ([]Account, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accounts file: %w", err)
+	}
+	accounts := make([]Account, 0)
+	if err = yaml.UnmarshalStrict(b, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse accounts file %s: %w", path, err)
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no accounts in %s", path)
+	}
+	return accounts, nil
+}
+
+// validate checks that account is usable and returns its auth scheme and token
+func (a Account) validate() (scheme, token string, err error) {
+	if a.Alias == "" {
+		return "", "", errors.New("empty account alias")
+	}
+	scheme, err = parseAuthScheme(a.AuthScheme)
+	if err != nil {
+		return "", "", fmt.Errorf("account %s: %w", a.Alias, err)
+	}
+	token = a.Token
+	if a.TokenFile != "" {
+		token, err = readToken(a.TokenFile)
+		if err != nil {
+			return "", "", fmt.Errorf("account %s: %w", a.Alias, err)
+		}
+	}
+	if token == "" {
+		return "", "", fmt.Errorf("account %s: empty API token", a.Alias)
+	}
+	return scheme, token, nil
+}
+
+// account is a configured EdgeCenter account with its own client
+type account struct {
+	alias  string
+	client DnsClient
+	// rrsets are RRSets fetched by Records, they are dropped on writes through client
+	rrsets *rrsetCache
+	// zones is a set of zones served by account, nil means all zones visible with the token
+	zones map[string]struct{}
+}
+
+func newAccount(alias string, client DnsClient, zones []string) *account {
+	cache := newRRSetCache()
+	acc := &account{
+		alias:  alias,
+		client: &cachingClient{cache: cache, next: &instrumentedClient{account: alias, next: client}},
+		rrsets: cache,
+	}
+	if len(zones) > 0 {
+		acc.zones = make(map[string]struct{}, len(zones))
+		for _, z := range zones {
+			acc.zones[normalizeZone(z)] = struct{}{}
+		}
+	}
+	return acc
+}
+
+// serves reports whether zone is managed through the account
+func (a *account) serves(zone string) bool {
+	if a.zones == nil {
+		return true
+	}
+	_, ok := a.zones[normalizeZone(zone)]
+	return ok
+}
+
+// zonesWithRecords returns zones of the account limited to the configured ones
+func (a *account) zonesWithRecords(ctx context.Context) ([]dns.Zone, error) {
+	var names []string
+	for z := range a.zones {
+		names = append(names, z)
+	}
+	sort.Strings(names)
+	zones, err := a.client.ZonesWithRecords(ctx, func(zone *dns.ZonesFilter) {
+		zone.Names = names
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := zones[:0]
+	for _, z := range zones {
+		if a.serves(z.Name) {
+			res = append(res, z)
+		}
+	}
+	return res, nil
+}
+
+// accountZone is a zone with the account owning it
+type accountZone struct {
+	dns.Zone
+	account *account
+}
+
+// accountZones returns union of zones of all accounts.
+// Zone visible to several accounts belongs to the first configured one.
+// Zones of available accounts are returned even if some accounts failed, along with the joined error.
+func (p *DnsProvider) accountZones(ctx context.Context) ([]accountZone, error) {
+	logger := log.Logger(ctx)
+
+	owners := make(map[string]string)
+	res := make([]accountZone, 0)
+	var errs []error
+	for _, acc := range p.accounts {
+		zones, err := acc.zonesWithRecords(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", acc.alias, err))
+			continue
+		}
+		count := 0
+		for _, z := range zones {
+			name := normalizeZone(z.Name)
+			if owner, ok := owners[name]; ok {
+				logger.WithField(log.AccountKey, acc.alias).
+					Warningf("zone %s is skipped, it is already served by account %s", z.Name, owner)
+				continue
+			}
+			owners[name] = acc.alias
+			res = append(res, accountZone{Zone: z, account: acc})
+			count++
+		}
+		metrics.AccountZones.WithLabelValues(acc.alias).Set(float64(count))
+	}
+	return res, errors.Join(errs...)
+}
+
+// instrumentedClient records metrics of API calls labelled by account alias
+type instrumentedClient struct {
+	account string
+	next    DnsClient
+}
+
+func (c *instrumentedClient) AddZoneRRSet(ctx context.Context,
+	zone, recordName, recordType string,
+	values []dns.ResourceRecord, ttl int, opts ...dns.AddZoneOpt) (err error) {
+	defer func(start time.Time) { metrics.ObserveAPIRequest(c.account, "AddZoneRRSet", start, err) }(time.Now())
+	return c.next.AddZoneRRSet(ctx, zone, recordName, recordType, values, ttl, opts...)
+}
+
+func (c *instrumentedClient) ZonesWithRecords(ctx context.Context, filters ...func(zone *dns.ZonesFilter)) (zones []dns.Zone, err error) {
+	defer func(start time.Time) { metrics.ObserveAPIRequest(c.account, "ZonesWithRecords", start, err) }(time.Now())
+	return c.next.ZonesWithRecords(ctx, filters...)
+}
+
+func (c *instrumentedClient) DeleteRRSet(ctx context.Context, zone, name, recordType string) (err error) {
+	defer func(start time.Time) { metrics.ObserveAPIRequest(c.account, "DeleteRRSet", start, err) }(time.Now())
+	return c.next.DeleteRRSet(ctx, zone, name, recordType)
+}
+
+func (c *instrumentedClient) CreateZone(ctx context.Context, name string) (id uint64, err error) {
+	defer func(start time.Time) { metrics.ObserveAPIRequest(c.account, "CreateZone", start, err) }(time.Now())
+	return c.next.CreateZone(ctx, name)
+}
+
+func (c *instrumentedClient) RRSet(ctx context.Context, zone, name, recordType string) (set dns.RRSet, err error) {
+	defer func(start time.Time) { metrics.ObserveAPIRequest(c.account, "RRSet", start, err) }(time.Now())
+	return c.next.RRSet(ctx, zone, name, recordType)
+}
+
+func (c *instrumentedClient) UpdateRRSet(ctx context.Context, zone, name, recordType string, record dns.RRSet) (err error) {
+	defer func(start time.Time) { metrics.ObserveAPIRequest(c.account, "UpdateRRSet", start, err) }(time.Now())
+	return c.next.UpdateRRSet(ctx, zone, name, recordType, record)
+}
+
+func (c *instrumentedClient) DeleteRRSetRecord(ctx context.Context, zone, name, recordType string, contents ...string) (err error) {
+	defer func(start time.Time) { metrics.ObserveAPIRequest(c.account, "DeleteRRSetRecord", start, err) }(time.Now())
+	return c.next.DeleteRRSetRecord(ctx, zone, name, recordType, contents...)
+}
@@ -0,0 +1,250 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_LoadAccounts(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    []Account
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			content: `
+- alias: main
+  token: secret
+- alias: legacy
+  tokenFile: /var/run/secrets/legacy
+  zones: [example.com, example.org.]
+`,
+			want: []Account{
+				{Alias: "main", Token: "secret"},
+				{Alias: "legacy", TokenFile: "/var/run/secrets/legacy", Zones: []string{"example.com", "example.org."}},
+			},
+		},
+		{
+			name:    "json",
+			content: `[{"alias": "main", "token": "secret"}]`,
+			want:    []Account{{Alias: "main", Token: "secret"}},
+		},
+		{
+			name:    "empty",
+			content: `[]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown_field",
+			content: `[{"alias": "main", "apiToken": "secret"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadAccounts(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadAccounts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadAccounts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_NewMultiAccountProvider(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		accounts []Account
+		wantErr  bool
+	}{
+		{name: "token", accounts: []Account{{Alias: "a", Token: "secret"}}},
+		{name: "token_file", accounts: []Account{{Alias: "a", TokenFile: tokenFile}}},
+		{name: "no_accounts", wantErr: true},
+		{name: "no_alias", accounts: []Account{{Token: "secret"}}, wantErr: true},
+		{name: "no_token", accounts: []Account{{Alias: "a"}}, wantErr: true},
+		{name: "missing_token_file", accounts: []Account{{Alias: "a", TokenFile: tokenFile + ".missing"}}, wantErr: true},
+		{name: "duplicate_alias", accounts: []Account{{Alias: "a", Token: "x"}, {Alias: "a", Token: "y"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewMultiAccountProvider("", tt.accounts, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewMultiAccountProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(p.accounts) != len(tt.accounts) {
+				t.Errorf("NewMultiAccountProvider() accounts = %d, want %d", len(p.accounts), len(tt.accounts))
+			}
+		})
+	}
+}
+
+// zonesClient serves static zones and records calls made through it
+type zonesClient struct {
+	zones []dns.Zone
+	// failZone fails creation of the zone with this name
+	failZone string
+
+	mu      sync.Mutex
+	created []string
+	filters []string
+	calls   int
+}
+
+func (c *zonesClient) AddZoneRRSet(_ context.Context, zone, recordName, recordType string, _ []dns.ResourceRecord, _ int, _ ...dns.AddZoneOpt) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.created = append(c.created, zone+" "+recordName+" "+recordType)
+	return nil
+}
+
+func (c *zonesClient) ZonesWithRecords(_ context.Context, filters ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+	f := dns.ZonesFilter{}
+	for _, op := range filters {
+		op(&f)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filters = f.Names
+	c.calls++
+	return append([]dns.Zone(nil), c.zones...), nil
+}
+
+func (c *zonesClient) DeleteRRSetRecord(context.Context, string, string, string, ...string) error {
+	return nil
+}
+
+func (c *zonesClient) DeleteRRSet(context.Context, string, string, string) error {
+	return nil
+}
+
+func (c *zonesClient) RRSet(context.Context, string, string, string) (dns.RRSet, error) {
+	return dns.RRSet{}, dns.APIError{StatusCode: http.StatusNotFound, Message: "rrset not found"}
+}
+
+func (c *zonesClient) UpdateRRSet(context.Context, string, string, string, dns.RRSet) error {
+	return nil
+}
+
+func (c *zonesClient) CreateZone(_ context.Context, name string) (uint64, error) {
+	if name == c.failZone {
+		return 0, dns.APIError{StatusCode: http.StatusBadRequest, Message: "zone is not allowed"}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.zones = append(c.zones, dns.Zone{Name: name})
+	return uint64(len(c.zones)), nil
+}
+
+func Test_dnsProvider_multiAccount(t *testing.T) {
+	one := &zonesClient{zones: []dns.Zone{
+		{Name: "a.com", Records: []dns.ZoneRecord{{Name: "www.a.com", Type: "A", TTL: 60, ShortAnswers: []string{"1.1.1.1"}}}},
+		{Name: "c.com", Records: []dns.ZoneRecord{{Name: "www.c.com", Type: "A", TTL: 60, ShortAnswers: []string{"3.3.3.3"}}}},
+	}}
+	two := &zonesClient{zones: []dns.Zone{
+		{Name: "a.com", Records: []dns.ZoneRecord{{Name: "www.a.com", Type: "A", TTL: 60, ShortAnswers: []string{"9.9.9.9"}}}},
+		{Name: "b.com", Records: []dns.ZoneRecord{{Name: "www.b.com", Type: "A", TTL: 60, ShortAnswers: []string{"2.2.2.2"}}}},
+	}}
+	p := &DnsProvider{accounts: []*account{
+		newAccount("one", one, []string{"A.com."}),
+		newAccount("two", two, nil),
+	}}
+	ctx := context.Background()
+
+	df := p.GetDomainFilter(ctx)
+	wantFilters := endpoint.NewDomainFilter([]string{"a.com", "a.com.", "b.com", "b.com."}).Filters
+	if !reflect.DeepEqual(df.Filters, wantFilters) {
+		t.Errorf("GetDomainFilter() = %v, want %v", df.Filters, wantFilters)
+	}
+	if !reflect.DeepEqual(one.filters, []string{"a.com"}) || two.filters != nil {
+		t.Errorf("zones filters = %v, %v", one.filters, two.filters)
+	}
+
+	records, err := p.Records(ctx)
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	got := make([]string, 0, len(records))
+	for _, r := range records {
+		got = append(got, r.String())
+	}
+	want := []string{
+		endpoint.NewEndpointWithTTL("www.a.com", "A", 60, "1.1.1.1").String(),
+		endpoint.NewEndpointWithTTL("www.b.com", "A", 60, "2.2.2.2").String(),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Records() = %v, want %v", got, want)
+	}
+
+	err = p.ApplyChanges(ctx, &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("new.a.com", "A", 60, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("new.b.com", "A", 60, "2.2.2.2"),
+		endpoint.NewEndpointWithTTL("new.c.com", "A", 60, "3.3.3.3"),
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	sort.Strings(one.created)
+	sort.Strings(two.created)
+	if !reflect.DeepEqual(one.created, []string{"a.com new.a.com A"}) {
+		t.Errorf("account one created %v", one.created)
+	}
+	if !reflect.DeepEqual(two.created, []string{"b.com new.b.com A"}) {
+		t.Errorf("account two created %v", two.created)
+	}
+}
+
+func Test_instrumentedClient(t *testing.T) {
+	c := newAccount("metrics-test", &zonesClient{}, nil).client
+	if _, err := c.ZonesWithRecords(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "edgecenter_webhook_api_requests_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels[metrics.AccountLabel] == "metrics-test" &&
+				labels[metrics.OperationLabel] == "ZonesWithRecords" &&
+				labels[metrics.StatusLabel] == metrics.StatusOK {
+				if m.GetCounter().GetValue() != 1 {
+					t.Errorf("api_requests_total = %v, want 1", m.GetCounter().GetValue())
+				}
+				return
+			}
+		}
+	}
+	t.Error("api_requests_total is not labelled with account alias")
+}
@@ -0,0 +1,285 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	ENV_APPROVAL_ZONES      = "EC_APPROVAL_ZONES"
+	ENV_APPROVAL_STATE_FILE = "EC_APPROVAL_STATE_FILE"
+	ENV_APPROVAL_EXPIRY     = "EC_APPROVAL_EXPIRY"
+
+	DefaultApprovalExpiry = 24 * time.Hour
+)
+
+// ApprovalStatus is a decision on a held change
+type ApprovalStatus string
+
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalRejected ApprovalStatus = "rejected"
+)
+
+// ErrApprovalNotFound is returned for unknown approval IDs
+var ErrApprovalNotFound = errors.New("approval not found")
+
+// Approval is an update or delete held until it is approved
+type Approval struct {
+	// ID is derived from the change, so the same change planned again gets the same ID
+	ID        string             `json:"id"`
+	Action    string             `json:"action"`
+	Old       *endpoint.Endpoint `json:"old"`
+	New       *endpoint.Endpoint `json:"new,omitempty"`
+	Status    ApprovalStatus     `json:"status"`
+	CreatedAt time.Time          `json:"createdAt"`
+	// LastSeen is the last time ExternalDNS asked for the change
+	LastSeen  time.Time  `json:"lastSeen"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+}
+
+// approvalID hashes the change. Targets are sorted as their order varies between plans, TTL of the current record
+// is left out so the live TTL changing doesn't turn a pending approval into a new one.
+func approvalID(action string, old, desired *endpoint.Endpoint) string {
+	h := sha256.New()
+	current := approvalEndpoint(old)
+	current.RecordTTL = 0
+	h.Write([]byte(action + "\n" + current.String()))
+	if desired != nil {
+		h.Write([]byte("\n" + approvalEndpoint(desired).String()))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// approvalEndpoint is a copy of e with sorted targets
+func approvalEndpoint(e *endpoint.Endpoint) *endpoint.Endpoint {
+	res := e.DeepCopy()
+	sort.Strings(res.Targets)
+	return res
+}
+
+// approvalState is the persisted form of the approval queue
+type approvalState struct {
+	Approvals []*Approval `json:"approvals"`
+}
+
+// approvalQueue holds updates and deletes of records in zones until they are approved
+type approvalQueue struct {
+	zones     []string
+	stateFile string
+	expiry    time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	items map[string]*Approval
+}
+
+// WithApprovals holds updates and deletes of records in zones and their subzones until they are approved
+// with DecideApproval. Held changes are persisted to stateFile, changes ExternalDNS hasn't planned again for expiry are dropped.
+func WithApprovals(zones []string, stateFile string, expiry time.Duration) Option {
+	return func(p *DnsProvider) {
+		q := &approvalQueue{stateFile: stateFile, expiry: expiry, now: time.Now, items: make(map[string]*Approval)}
+		for _, z := range zones {
+			q.zones = append(q.zones, normalizeZone(z))
+		}
+		if err := q.load(); err != nil {
+			log.Logger(context.Background()).WithField(log.ErrorKey, err).Warning("failed to load approvals, held changes are pending again")
+		}
+		p.approvals = q
+	}
+}
+
+func (q *approvalQueue) load() error {
+	b, err := os.ReadFile(q.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state approvalState
+	if err = json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", q.stateFile, err)
+	}
+	for _, a := range state.Approvals {
+		q.items[a.ID] = a
+	}
+	q.updateMetrics()
+	return nil
+}
+
+func (q *approvalQueue) save() error {
+	b, err := json.Marshal(approvalState{Approvals: q.list()})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(q.stateFile, b)
+}
+
+// list returns approvals from the oldest
+func (q *approvalQueue) list() []*Approval {
+	res := make([]*Approval, 0, len(q.items))
+	for _, a := range q.items {
+		res = append(res, a)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(res[j].CreatedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+func (q *approvalQueue) updateMetrics() {
+	counts := map[ApprovalStatus]int{ApprovalPending: 0, ApprovalApproved: 0, ApprovalRejected: 0}
+	for _, a := range q.items {
+		counts[a.Status]++
+	}
+	for status, n := range counts {
+		metrics.Approvals.WithLabelValues(string(status)).Set(float64(n))
+	}
+}
+
+// hold removes updates and deletes of records in approval zones from changes unless they are approved.
+// It returns IDs of approved changes left in changes, they are dropped from the queue by done once applied.
+func (q *approvalQueue) hold(ctx context.Context, changes *plan.Changes) (*plan.Changes, []string) {
+	if q == nil {
+		return changes, nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+
+	var approved []string
+	held, changed := 0, false
+	// check returns true if the change is held
+	check := func(action string, old, desired *endpoint.Endpoint) bool {
+		changed = true
+		id := approvalID(action, old, desired)
+		a, ok := q.items[id]
+		if !ok {
+			a = &Approval{ID: id, Action: action, Old: old, New: desired, Status: ApprovalPending, CreatedAt: now}
+			q.items[id] = a
+			log.Logger(ctx).WithField(log.DNSNameKey, old.DNSName).Infof("%s %s waits for approval %s", action, old.RecordType, id)
+		}
+		a.LastSeen = now
+		if a.Status == ApprovalApproved {
+			approved = append(approved, id)
+			return false
+		}
+		held++
+		return true
+	}
+
+	res := &plan.Changes{Create: changes.Create}
+	heldOld := make(map[*endpoint.Endpoint]bool)
+	for _, e := range changes.UpdateNew {
+		old := currentRecord(e, changes.UpdateOld)
+		if old != nil && inZones(e.DNSName, q.zones) && check(actionUpdate, old, e) {
+			heldOld[old] = true
+			continue
+		}
+		res.UpdateNew = append(res.UpdateNew, e)
+	}
+	for _, e := range changes.UpdateOld {
+		if !heldOld[e] {
+			res.UpdateOld = append(res.UpdateOld, e)
+		}
+	}
+	for _, e := range changes.Delete {
+		if inZones(e.DNSName, q.zones) && check(actionDelete, e, nil) {
+			continue
+		}
+		res.Delete = append(res.Delete, e)
+	}
+
+	for id, a := range q.items {
+		if now.Sub(a.LastSeen) > q.expiry {
+			delete(q.items, id)
+			changed = true
+		}
+	}
+	if held > 0 {
+		log.Logger(ctx).Warningf("%d change(s) held for approval", held)
+	}
+	if !changed {
+		return res, approved
+	}
+	q.updateMetrics()
+	if err := q.save(); err != nil {
+		log.Logger(ctx).WithField(log.ErrorKey, err).Error("failed to save approvals")
+	}
+	return res, approved
+}
+
+// done drops approved changes from the queue once they are applied
+func (q *approvalQueue) done(ctx context.Context, approved []string, ok bool) {
+	if q == nil || len(approved) == 0 || !ok {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, id := range approved {
+		delete(q.items, id)
+	}
+	q.updateMetrics()
+	if err := q.save(); err != nil {
+		log.Logger(ctx).WithField(log.ErrorKey, err).Error("failed to save approvals")
+	}
+}
+
+// Approvals returns held changes from the oldest, false if approvals are disabled
+func (p *DnsProvider) Approvals() ([]Approval, bool) {
+	if p.approvals == nil {
+		return nil, false
+	}
+	p.approvals.mu.Lock()
+	defer p.approvals.mu.Unlock()
+	res := make([]Approval, 0, len(p.approvals.items))
+	for _, a := range p.approvals.list() {
+		res = append(res, *a)
+	}
+	return res, true
+}
+
+// DecideApproval approves or rejects a held change, approved change is applied by the next ApplyChanges
+// planning it. Rejected change stays held until ExternalDNS stops planning it.
+func (p *DnsProvider) DecideApproval(ctx context.Context, id string, approve bool) (Approval, error) {
+	if p.approvals == nil {
+		return Approval{}, ErrApprovalNotFound
+	}
+	q := p.approvals
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	a, ok := q.items[id]
+	if !ok {
+		return Approval{}, ErrApprovalNotFound
+	}
+	a.Status = ApprovalRejected
+	if approve {
+		a.Status = ApprovalApproved
+	}
+	now := q.now()
+	a.DecidedAt = &now
+	log.Logger(ctx).WithField(log.DNSNameKey, a.Old.DNSName).Infof("%s %s is %s", a.Action, a.Old.RecordType, a.Status)
+	q.updateMetrics()
+	if err := q.save(); err != nil {
+		return Approval{}, fmt.Errorf("failed to save approvals: %w", err)
+	}
+	return *a, nil
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_approvalQueue_hold(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "approvals.json")
+	p := &DnsProvider{}
+	WithApprovals([]string{"Prod.example.com."}, stateFile, time.Hour)(p)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	p.approvals.now = func() time.Time { return now }
+
+	changes := &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("new.prod.example.com", "A", "1.1.1.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("www.prod.example.com", "A", "1.1.1.1"), endpoint.NewEndpoint("www.dev.example.com", "A", "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("www.prod.example.com", "A", "2.2.2.2"), endpoint.NewEndpoint("www.dev.example.com", "A", "2.2.2.2")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("old.prod.example.com", "A", "1.1.1.1")},
+	}
+	res, approved := p.approvals.hold(context.Background(), changes)
+	if len(res.Create) != 1 || len(res.UpdateOld) != 1 || len(res.UpdateNew) != 1 || res.UpdateNew[0].DNSName != "www.dev.example.com" || len(res.Delete) != 0 || len(approved) != 0 {
+		t.Fatalf("hold() = %+v, %v, want prod update and delete held", res, approved)
+	}
+	approvals, _ := p.Approvals()
+	if len(approvals) != 2 {
+		t.Fatalf("Approvals() = %+v, want 2", approvals)
+	}
+
+	// planned again, IDs are stable
+	p.approvals.hold(context.Background(), changes)
+	if approvals, _ = p.Approvals(); len(approvals) != 2 {
+		t.Fatalf("Approvals() after replan = %+v, want 2", approvals)
+	}
+
+	var deleteID, updateID string
+	for _, a := range approvals {
+		if a.Action == actionDelete {
+			deleteID = a.ID
+		} else {
+			updateID = a.ID
+		}
+	}
+	if _, err := p.DecideApproval(context.Background(), deleteID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DecideApproval(context.Background(), updateID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DecideApproval(context.Background(), "unknown", true); !errors.Is(err, ErrApprovalNotFound) {
+		t.Errorf("DecideApproval(unknown) error = %v, want ErrApprovalNotFound", err)
+	}
+
+	// decisions survive restart
+	restarted := &DnsProvider{}
+	WithApprovals([]string{"prod.example.com"}, stateFile, time.Hour)(restarted)
+	restarted.approvals.now = p.approvals.now
+	res, approved = restarted.approvals.hold(context.Background(), changes)
+	if len(res.Delete) != 1 || len(res.UpdateNew) != 1 || len(approved) != 1 || approved[0] != deleteID {
+		t.Fatalf("hold() after decisions = %+v, %v, want approved delete and rejected update held", res, approved)
+	}
+	restarted.approvals.done(context.Background(), approved, false)
+	if approvals, _ = restarted.Approvals(); len(approvals) != 2 {
+		t.Errorf("Approvals() after failed apply = %+v, want 2", approvals)
+	}
+	restarted.approvals.done(context.Background(), approved, true)
+	if approvals, _ = restarted.Approvals(); len(approvals) != 1 || approvals[0].Status != ApprovalRejected {
+		t.Errorf("Approvals() after apply = %+v, want rejected update", approvals)
+	}
+
+	// not planned anymore
+	now = now.Add(2 * time.Hour)
+	restarted.approvals.hold(context.Background(), &plan.Changes{})
+	if approvals, _ = restarted.Approvals(); len(approvals) != 0 {
+		t.Errorf("Approvals() after expiry = %+v, want none", approvals)
+	}
+}
+
+func Test_approvalID(t *testing.T) {
+	old := endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "1.1.1.1", "2.2.2.2")
+	desired := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "3.3.3.3", "1.1.1.1")
+	id := approvalID(actionUpdate, old, desired)
+
+	reordered := approvalID(actionUpdate,
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 600, "2.2.2.2", "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "3.3.3.3"))
+	if reordered != id {
+		t.Errorf("approvalID() of reordered targets and another live TTL = %s, want %s", reordered, id)
+	}
+	if old.Targets[0] != "1.1.1.1" || desired.Targets[0] != "3.3.3.3" || old.RecordTTL != 300 {
+		t.Errorf("approvalID() changed endpoints %v, %v", old, desired)
+	}
+	retimed := endpoint.NewEndpointWithTTL("www.example.com", "A", 120, "1.1.1.1", "3.3.3.3")
+	if approvalID(actionUpdate, old, retimed) == id {
+		t.Error("approvalID() of another desired TTL is the same")
+	}
+	if approvalID(actionDelete, old, nil) == id {
+		t.Error("approvalID() of delete is the same as of update")
+	}
+}
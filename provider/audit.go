@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/audit"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	ENV_AUDIT_FILE             = "EC_AUDIT_FILE"
+	ENV_AUDIT_FILE_MAX_BYTES   = "EC_AUDIT_FILE_MAX_BYTES"
+	ENV_AUDIT_FILE_MAX_BACKUPS = "EC_AUDIT_FILE_MAX_BACKUPS"
+	ENV_AUDIT_URL              = "EC_AUDIT_URL"
+	ENV_AUDIT_TOKEN_FILE       = "EC_AUDIT_TOKEN_FILE"
+	ENV_AUDIT_TIMEOUT          = "EC_AUDIT_TIMEOUT"
+	ENV_AUDIT_BUFFER_SIZE      = "EC_AUDIT_BUFFER_SIZE"
+
+	DefaultAuditFileMaxBytes   = 100 << 20
+	DefaultAuditFileMaxBackups = 5
+	DefaultAuditTimeout        = 10 * time.Second
+	DefaultAuditBufferSize     = 1000
+)
+
+// WithAuditSink makes ApplyChanges write an audit entry for every create, update and delete of records
+func WithAuditSink(sink audit.Sink) Option {
+	return func(p *DnsProvider) {
+		p.audit = sink
+	}
+}
+
+// auditEntries collects entries of a single ApplyChanges for the notifier
+type auditEntries struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (a *auditEntries) add(e audit.Entry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, e)
+}
+
+// auditChange writes entry for change of e in zone to the audit sink and adds it to entries,
+// old is the current record of an update. Failures to write are logged, the change itself is already applied.
+func (p *DnsProvider) auditChange(ctx context.Context, entries *auditEntries, acc *account, zone, action string, old, e *endpoint.Endpoint, err error) {
+	if p.audit == nil && p.notifier == nil {
+		return
+	}
+	entry := p.newAuditEntry(ctx, acc, zone, action, e.DNSName, e.RecordType, e.SetIdentifier, err)
+	if action == actionDelete {
+		entry.OldTargets, entry.OldTTL = e.Targets, int64(e.RecordTTL)
+	} else {
+		entry.NewTargets, entry.NewTTL = e.Targets, int64(e.RecordTTL)
+	}
+	if old != nil {
+		entry.OldTargets, entry.OldTTL = old.Targets, int64(old.RecordTTL)
+	}
+	entries.add(entry)
+	p.writeAudit(ctx, entry)
+}
+
+func (p *DnsProvider) newAuditEntry(ctx context.Context, acc *account, zone, action, name, recordType, setIdentifier string, err error) audit.Entry {
+	entry := audit.Entry{
+		Time:          time.Now().UTC(),
+		Zone:          zone,
+		Name:          name,
+		Type:          recordType,
+		SetIdentifier: setIdentifier,
+		Action:        action,
+		DryRun:        p.dryRun,
+		Result:        audit.ResultOK,
+	}
+	// account is unknown for refused changes of names without zone
+	if acc != nil {
+		entry.Account = acc.alias
+	}
+	if traceID := ctx.Value(log.TraceIDKey); traceID != nil {
+		entry.TraceID = fmt.Sprint(traceID)
+	}
+	if err != nil {
+		entry.Result, entry.Error = audit.ResultError, err.Error()
+	}
+	return entry
+}
+
+// auditRefused audits changes refused during freeze windows as failed with err, so they reach the audit sink
+// and the notifier like any other change that wasn't applied. It returns false if none of them is notified.
+func (p *DnsProvider) auditRefused(ctx context.Context, entries *auditEntries, zones *zoneIndex, refused *plan.Changes, err error) bool {
+	fresh := p.freeze.unreported(refused)
+	auditRefused := func(action string, old, e *endpoint.Endpoint, notified []*endpoint.Endpoint) {
+		zone, acc, _ := zones.lookup(e.DNSName, e.RecordType)
+		to := entries
+		if !slices.Contains(notified, e) {
+			to = &auditEntries{}
+		}
+		p.auditChange(ctx, to, acc, zone, action, old, e, err)
+	}
+	for _, e := range refused.Create {
+		auditRefused(actionCreate, nil, e, fresh.Create)
+	}
+	for _, e := range refused.UpdateNew {
+		auditRefused(actionUpdate, currentRecord(e, refused.UpdateOld), e, fresh.UpdateNew)
+	}
+	for _, e := range refused.Delete {
+		auditRefused(actionDelete, nil, e, fresh.Delete)
+	}
+	return len(fresh.Create)+len(fresh.UpdateNew)+len(fresh.Delete) > 0
+}
+
+// writeAudit passes entry to the audit sink. The sink created from env writes in background,
+// so only entries it can't queue are counted as failed here.
+func (p *DnsProvider) writeAudit(ctx context.Context, entry audit.Entry) {
+	if p.audit == nil {
+		return
+	}
+	if err := p.audit.Write(ctx, entry); err != nil {
+		metrics.AuditEntries.WithLabelValues(metrics.StatusError).Inc()
+		log.Logger(ctx).WithField(log.DNSNameKey, entry.Name).WithField(log.ErrorKey, err).Error("failed to write audit entry")
+	}
+}
+
+// CloseAudit writes entries queued for the audit sink and closes it, it gives up when ctx is done
+func (p *DnsProvider) CloseAudit(ctx context.Context) error {
+	if p.audit == nil {
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- p.audit.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("audit entries left unwritten: %w", ctx.Err())
+	}
+}
+
+// currentRecord returns the record of existing matching RRSet and SetIdentifier of update
+func currentRecord(update *endpoint.Endpoint, existing []*endpoint.Endpoint) *endpoint.Endpoint {
+	var res *endpoint.Endpoint
+	for _, ex := range existing {
+		if sameRecordSet(ex, update) {
+			res = ex
+		}
+	}
+	return res
+}
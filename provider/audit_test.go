@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/audit"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+type sinkMock struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (s *sinkMock) Write(_ context.Context, e audit.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *sinkMock) Close() error {
+	return nil
+}
+
+func Test_dnsProvider_ApplyChanges_audit(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		sink := &sinkMock{}
+		client := &clientMock{
+			zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+				return []dns.Zone{{Name: "example.com"}}, nil
+			},
+			addZoneRRSet: func(_ context.Context, _, name, _ string, _ []dns.ResourceRecord, _ int, _ ...dns.AddZoneOpt) error {
+				if name == "new.example.com" {
+					return errors.New("api is down")
+				}
+				return nil
+			},
+			deleteRRSetRecord: func(context.Context, string, string, string, ...string) error {
+				return nil
+			},
+		}
+		p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}, dryRun: dryRun}
+		WithAuditSink(sink)(p)
+
+		ctx := log.Trace(context.Background())
+		_ = p.ApplyChanges(ctx, &plan.Changes{
+			Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.example.com", "A", 60, "1.1.1.1")},
+			UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1"), endpoint.NewEndpoint("same.example.com", "A", "1.1.1.1")},
+			UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "2.2.2.2"), endpoint.NewEndpoint("same.example.com", "A", "1.1.1.1")},
+			Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("old.example.com", "CNAME", "www.example.com")},
+		})
+
+		entries := sink.entries
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Action < entries[j].Action })
+		if len(entries) != 3 {
+			t.Fatalf("dry run %v: entries = %+v, want create, delete and update", dryRun, entries)
+		}
+		create, del, update := entries[0], entries[1], entries[2]
+		wantCreateResult := audit.ResultError
+		if dryRun {
+			wantCreateResult = audit.ResultOK
+		}
+		if create.Action != actionCreate || create.Name != "new.example.com" || create.Result != wantCreateResult || create.NewTTL != 60 {
+			t.Errorf("dry run %v: create entry = %+v", dryRun, create)
+		}
+		if del.Action != actionDelete || del.Zone != "example.com" || len(del.OldTargets) != 1 || del.NewTargets != nil || del.Result != audit.ResultOK {
+			t.Errorf("dry run %v: delete entry = %+v", dryRun, del)
+		}
+		if update.Action != actionUpdate || update.OldTargets[0] != "1.1.1.1" || update.NewTargets[0] != "2.2.2.2" ||
+			update.OldTTL != 60 || update.NewTTL != 300 || update.Account != DefaultAccountAlias {
+			t.Errorf("dry run %v: update entry = %+v", dryRun, update)
+		}
+		for _, e := range entries {
+			if e.DryRun != dryRun || e.TraceID == "" {
+				t.Errorf("dry run %v: entry = %+v", dryRun, e)
+			}
+		}
+	}
+}
+
+func Test_dnsProvider_ApplyChanges_auditZonesAndOwnership(t *testing.T) {
+	sink := &sinkMock{}
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return nil, nil
+		},
+		createZone: func(context.Context, string) (uint64, error) {
+			return 1, nil
+		},
+		addZoneRRSet: func(context.Context, string, string, string, []dns.ResourceRecord, int, ...dns.AddZoneOpt) error {
+			return nil
+		},
+		rrSet: func(context.Context, string, string, string) (dns.RRSet, error) {
+			return dns.RRSet{TTL: 60, Records: []dns.ResourceRecord{identifierRecord("1.1.1.1", "", true)}}, nil
+		},
+		updateRRSet: func(context.Context, string, string, string, dns.RRSet) error {
+			return errors.New("api is down")
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	WithAuditSink(sink)(p)
+	WithZoneCreation([]string{"example.com"}, 1)(p)
+	WithMetaRegistry("", "", "")(p)
+
+	owner := `"heritage=external-dns,external-dns/owner=k8s"`
+	_ = p.ApplyChanges(log.Trace(context.Background()), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.app.example.com", "A", 60, "1.1.1.1"),
+		registryTXT("a-www.app.example.com", "www.app.example.com", owner),
+	}})
+
+	entries := sink.entries
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Action < entries[j].Action })
+	if len(entries) != 3 {
+		t.Fatalf("entries = %+v, want create, create-zone and update-owner", entries)
+	}
+	if z := entries[1]; z.Action != actionCreateZone || z.Zone != "app.example.com" || z.Name != "app.example.com" || z.Result != audit.ResultOK {
+		t.Errorf("zone entry = %+v", z)
+	}
+	if o := entries[2]; o.Action != actionUpdateOwner || o.Name != "www.app.example.com" || o.Type != "A" || o.Result != audit.ResultError || o.TraceID == "" {
+		t.Errorf("ownership entry = %+v", o)
+	}
+}
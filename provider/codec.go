@@ -0,0 +1,288 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	RecordTypePTR = "PTR"
+	RecordTypeCAA = "CAA"
+)
+
+// recordCodec converts targets of a record type between external-dns and EdgeCenter API forms
+type recordCodec struct {
+	// parse validates target and converts it to content of API resource record
+	parse func(target string) ([]any, error)
+	// format converts short answer returned by API to target
+	format func(answer string) (string, error)
+}
+
+// codecs are record types supported by the provider
+var codecs = map[string]recordCodec{
+	endpoint.RecordTypeA:     {parse: parseIPv4, format: formatIP},
+	endpoint.RecordTypeAAAA:  {parse: parseIPv6, format: formatIP},
+	endpoint.RecordTypeCNAME: {parse: parseHostnameContent, format: formatHostname},
+	endpoint.RecordTypeNS:    {parse: parseHostnameContent, format: formatHostname},
+	RecordTypePTR:            {parse: parseHostnameContent, format: formatHostname},
+	endpoint.RecordTypeTXT:   {parse: parseTXT, format: formatTXT},
+	endpoint.RecordTypeMX:    {parse: parseMX, format: formatMX},
+	endpoint.RecordTypeSRV:   {parse: parseSRV, format: formatSRV},
+	RecordTypeCAA:            {parse: parseCAA, format: formatCAA},
+}
+
+// supportedRecordType reports whether records of recordType are managed by the provider
+func supportedRecordType(recordType string) bool {
+	_, ok := codecs[recordType]
+	return ok
+}
+
+// recordContent parses target into content of API resource record
+func recordContent(recordType, target string) ([]any, error) {
+	if c, ok := codecs[recordType]; ok {
+		content, err := c.parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s target '%s': %w", recordType, target, err)
+		}
+		return content, nil
+	}
+	content := dns.ContentFromValue(recordType, target)
+	if len(content) == 0 {
+		return nil, fmt.Errorf("invalid %s target '%s'", recordType, target)
+	}
+	return content, nil
+}
+
+// resourceRecords converts targets to enabled API resource records
+func resourceRecords(recordType string, targets endpoint.Targets) ([]dns.ResourceRecord, error) {
+	res := make([]dns.ResourceRecord, 0, len(targets))
+	for _, t := range targets {
+		content, err := recordContent(recordType, t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, dns.ResourceRecord{Content: content, Enabled: true})
+	}
+	return res, nil
+}
+
+// contentStrings converts targets to the form the SDK matches against existing records on delete
+func contentStrings(recordType string, targets endpoint.Targets) []string {
+	res := make([]string, 0, len(targets))
+	for _, t := range targets {
+		content, err := recordContent(recordType, t)
+		if err != nil {
+			res = append(res, t)
+			continue
+		}
+		res = append(res, dns.ResourceRecord{Content: content}.ContentToString())
+	}
+	return res
+}
+
+// validateEndpoint checks that every target and routing property of e can be written to API
+func validateEndpoint(e *endpoint.Endpoint) error {
+	for _, t := range e.Targets {
+		if _, err := recordContent(e.RecordType, t); err != nil {
+			return err
+		}
+	}
+	return validateRouting(e)
+}
+
+// formatAnswer converts API short answer to target, answers which can't be parsed are returned as is
+func formatAnswer(recordType, answer string) string {
+	c, ok := codecs[recordType]
+	if !ok {
+		return answer
+	}
+	target, err := c.format(answer)
+	if err != nil {
+		return answer
+	}
+	return target
+}
+
+func parseIPv4(target string) ([]any, error) {
+	ip := net.ParseIP(target)
+	if ip == nil || ip.To4() == nil || strings.Contains(target, ":") {
+		return nil, errors.New("not an IPv4 address")
+	}
+	return []any{ip.String()}, nil
+}
+
+func parseIPv6(target string) ([]any, error) {
+	ip := net.ParseIP(target)
+	if ip == nil || !strings.Contains(target, ":") {
+		return nil, errors.New("not an IPv6 address")
+	}
+	return []any{ip.String()}, nil
+}
+
+func formatIP(answer string) (string, error) {
+	ip := net.ParseIP(answer)
+	if ip == nil {
+		return "", errors.New("not an IP address")
+	}
+	return ip.String(), nil
+}
+
+// parseHostname validates DNS name and converts it to punycode without trailing dot
+func parseHostname(name string) (string, error) {
+	name = toASCII(strings.TrimSuffix(name, "."))
+	if name == "" || len(name) > 253 {
+		return "", errors.New("invalid length of name")
+	}
+	if strings.ContainsAny(name, " \t\"") {
+		return "", errors.New("name contains whitespace or quotes")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return "", errors.New("invalid length of label")
+		}
+	}
+	return name, nil
+}
+
+func parseHostnameContent(target string) ([]any, error) {
+	name, err := parseHostname(target)
+	if err != nil {
+		return nil, err
+	}
+	return []any{name}, nil
+}
+
+func formatHostname(answer string) (string, error) {
+	return strings.TrimSuffix(answer, "."), nil
+}
+
+func parseTXT(target string) ([]any, error) {
+	if target == "" {
+		return nil, errors.New("empty text")
+	}
+	return []any{target}, nil
+}
+
+func formatTXT(answer string) (string, error) {
+	return answer, nil
+}
+
+func parseUint(s string, bitSize int, what string) (int64, error) {
+	v, err := strconv.ParseUint(s, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s'", what, s)
+	}
+	return int64(v), nil
+}
+
+// parseMX parses "<preference> <exchange>"
+func parseMX(target string) ([]any, error) {
+	fields := strings.Fields(target)
+	if len(fields) != 2 {
+		return nil, errors.New("expected '<preference> <exchange>'")
+	}
+	pref, err := parseUint(fields[0], 16, "preference")
+	if err != nil {
+		return nil, err
+	}
+	host, err := parseHostname(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid exchange: %w", err)
+	}
+	return []any{pref, host}, nil
+}
+
+func formatMX(answer string) (string, error) {
+	fields := strings.Fields(answer)
+	if len(fields) != 2 {
+		return "", errors.New("unexpected MX answer")
+	}
+	return fields[0] + " " + strings.TrimSuffix(fields[1], "."), nil
+}
+
+// parseSRV parses "<priority> <weight> <port> <target>"
+func parseSRV(target string) ([]any, error) {
+	fields := strings.Fields(target)
+	if len(fields) != 4 {
+		return nil, errors.New("expected '<priority> <weight> <port> <target>'")
+	}
+	content := make([]any, 0, 4)
+	for i, what := range []string{"priority", "weight", "port"} {
+		v, err := parseUint(fields[i], 16, what)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, v)
+	}
+	// "." means the service is not available at this domain
+	host := "."
+	if fields[3] != "." {
+		var err error
+		if host, err = parseHostname(fields[3]); err != nil {
+			return nil, fmt.Errorf("invalid target: %w", err)
+		}
+	}
+	return append(content, host), nil
+}
+
+func formatSRV(answer string) (string, error) {
+	fields := strings.Fields(answer)
+	if len(fields) != 4 {
+		return "", errors.New("unexpected SRV answer")
+	}
+	if fields[3] != "." {
+		fields[3] = strings.TrimSuffix(fields[3], ".")
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// splitCAA splits "<flags> <tag> <value>" where value can be quoted and contain spaces
+func splitCAA(s string) (flags, tag, value string, err error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return "", "", "", errors.New(`expected '<flags> <tag> "<value>"'`)
+	}
+	value = strings.TrimSpace(s)
+	for _, f := range fields[:2] {
+		value = strings.TrimSpace(strings.TrimPrefix(value, f))
+	}
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	return fields[0], fields[1], value, nil
+}
+
+// parseCAA parses `<flags> <tag> "<value>"`, API gets value without quotes
+func parseCAA(target string) ([]any, error) {
+	flags, tag, value, err := splitCAA(target)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseUint(flags, 8, "flags")
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range tag {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return nil, fmt.Errorf("invalid tag '%s'", tag)
+		}
+	}
+	if value == "" {
+		return nil, errors.New("empty value")
+	}
+	return []any{f, strings.ToLower(tag), value}, nil
+}
+
+func formatCAA(answer string) (string, error) {
+	flags, tag, value, err := splitCAA(answer)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %q", flags, strings.ToLower(tag), value), nil
+}
@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_recordContent(t *testing.T) {
+	tests := []struct {
+		recordType string
+		target     string
+		want       []any
+		wantErr    bool
+	}{
+		{recordType: "A", target: "1.2.3.4", want: []any{"1.2.3.4"}},
+		{recordType: "A", target: "::ffff:1.2.3.4", wantErr: true},
+		{recordType: "A", target: "www.example.com", wantErr: true},
+		{recordType: "AAAA", target: "2001:DB8::1", want: []any{"2001:db8::1"}},
+		{recordType: "AAAA", target: "1.2.3.4", wantErr: true},
+		{recordType: "CNAME", target: "www.example.com.", want: []any{"www.example.com"}},
+		{recordType: "CNAME", target: "www.пример.рф", want: []any{"www.xn--e1afmkfd.xn--p1ai"}},
+		{recordType: "CNAME", target: "www..example.com", wantErr: true},
+		{recordType: "CNAME", target: "", wantErr: true},
+		{recordType: "NS", target: "ns1.edgecenter.ru", want: []any{"ns1.edgecenter.ru"}},
+		{recordType: "NS", target: "ns1 edgecenter.ru", wantErr: true},
+		{recordType: "PTR", target: "www.example.com", want: []any{"www.example.com"}},
+		{recordType: "PTR", target: "1.2.3.4 www.example.com", wantErr: true},
+		{recordType: "TXT", target: "v=spf1 -all", want: []any{"v=spf1 -all"}},
+		{recordType: "TXT", target: "", wantErr: true},
+		{recordType: "MX", target: "10 mail.example.com.", want: []any{int64(10), "mail.example.com"}},
+		{recordType: "MX", target: "mail.example.com", wantErr: true},
+		{recordType: "MX", target: "70000 mail.example.com", wantErr: true},
+		{recordType: "SRV", target: "10 5 5060 sip.example.com", want: []any{int64(10), int64(5), int64(5060), "sip.example.com"}},
+		{recordType: "SRV", target: "0 0 0 .", want: []any{int64(0), int64(0), int64(0), "."}},
+		{recordType: "SRV", target: "10 5 sip.example.com", wantErr: true},
+		{recordType: "SRV", target: "10 5 port sip.example.com", wantErr: true},
+		{recordType: "CAA", target: `0 issue "letsencrypt.org"`, want: []any{int64(0), "issue", "letsencrypt.org"}},
+		{recordType: "CAA", target: `128 IODEF "mailto:security@example.com"`, want: []any{int64(128), "iodef", "mailto:security@example.com"}},
+		{recordType: "CAA", target: `0 issue "ca.example.net; account=230123"`, want: []any{int64(0), "issue", "ca.example.net; account=230123"}},
+		{recordType: "CAA", target: "0 issue", wantErr: true},
+		{recordType: "CAA", target: `256 issue "letsencrypt.org"`, wantErr: true},
+		{recordType: "CAA", target: `0 is-sue "letsencrypt.org"`, wantErr: true},
+		{recordType: "CAA", target: `0 issue ""`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.recordType+" "+tt.target, func(t *testing.T) {
+			got, err := recordContent(tt.recordType, tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("recordContent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recordContent() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formatAnswer(t *testing.T) {
+	tests := []struct {
+		recordType string
+		answer     string
+		want       string
+	}{
+		{recordType: "A", answer: "1.2.3.4", want: "1.2.3.4"},
+		{recordType: "AAAA", answer: "2001:0db8:0000::0001", want: "2001:db8::1"},
+		{recordType: "CNAME", answer: "www.example.com.", want: "www.example.com"},
+		{recordType: "NS", answer: "ns1.edgecenter.ru.", want: "ns1.edgecenter.ru"},
+		{recordType: "PTR", answer: "www.example.com.", want: "www.example.com"},
+		{recordType: "TXT", answer: "v=spf1 -all", want: "v=spf1 -all"},
+		{recordType: "MX", answer: "10 mail.example.com.", want: "10 mail.example.com"},
+		{recordType: "SRV", answer: "10 5 5060 sip.example.com.", want: "10 5 5060 sip.example.com"},
+		{recordType: "SRV", answer: "0 0 0 .", want: "0 0 0 ."},
+		{recordType: "CAA", answer: "0 issue letsencrypt.org", want: `0 issue "letsencrypt.org"`},
+		{recordType: "CAA", answer: `0 ISSUE "letsencrypt.org"`, want: `0 issue "letsencrypt.org"`},
+		{recordType: "MX", answer: "broken", want: "broken"},
+		{recordType: "HINFO", answer: "x86 linux", want: "x86 linux"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.recordType+" "+tt.answer, func(t *testing.T) {
+			if got := formatAnswer(tt.recordType, tt.answer); got != tt.want {
+				t.Errorf("formatAnswer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_codec_roundTrip checks that a target written to API is read back as the same target
+func Test_codec_roundTrip(t *testing.T) {
+	targets := map[string]string{
+		"A":     "1.2.3.4",
+		"AAAA":  "2001:db8::1",
+		"CNAME": "www.example.com",
+		"NS":    "ns1.edgecenter.ru",
+		"PTR":   "www.example.com",
+		"TXT":   "v=spf1 -all",
+		"MX":    "10 mail.example.com",
+		"SRV":   "10 5 5060 sip.example.com",
+		"CAA":   `0 issue "letsencrypt.org"`,
+	}
+	for recordType := range codecs {
+		target, ok := targets[recordType]
+		if !ok {
+			t.Errorf("no round trip case for %s", recordType)
+			continue
+		}
+		content, err := recordContent(recordType, target)
+		if err != nil {
+			t.Errorf("recordContent(%s) error = %v", recordType, err)
+			continue
+		}
+		answer := dns.ResourceRecord{Content: content}.ContentToString()
+		if got := formatAnswer(recordType, answer); got != target {
+			t.Errorf("%s round trip = %q, want %q", recordType, got, target)
+		}
+	}
+}
+
+func Test_dnsProvider_AdjustEndpoints(t *testing.T) {
+	p := &DnsProvider{}
+	valid := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("example.com", "MX", "10 mail.example.com"),
+		endpoint.NewEndpoint("example.com", "CAA", `0 issue "letsencrypt.org"`),
+		endpoint.NewEndpoint("_sip._tcp.example.com", "SRV", "10 5 5060 sip.example.com"),
+		endpoint.NewEndpoint("4.3.2.1.in-addr.arpa", "PTR", "www.example.com"),
+		endpoint.NewEndpoint("www.пример.рф", "CNAME", "пример.рф"),
+	}
+	invalid := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com", "A", "2001:db8::1"),
+		endpoint.NewEndpoint("example.com", "MX", "mail.example.com"),
+	}
+	txt := endpoint.NewEndpoint("example.com", "TXT", "text")
+
+	got, err := p.AdjustEndpoints(append(append([]*endpoint.Endpoint{}, valid...), append(invalid, txt)...))
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	if want := append(append([]*endpoint.Endpoint{}, valid...), invalid...); !reflect.DeepEqual(got, want) {
+		t.Errorf("AdjustEndpoints() = %v, want %v", got, want)
+	}
+}
+
+func Test_dnsProvider_invalidTargetKeepsCurrentRecord(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+	deleteRecord := func(_ context.Context, _, name, recordType string, _ ...string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = append(deleted, name+" "+recordType)
+		return nil
+	}
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com", Records: []dns.ZoneRecord{
+				{Name: "www.example.com", Type: "A", TTL: 300, ShortAnswers: []string{"1.1.1.1"}},
+			}}}, nil
+		},
+		deleteRRSetRecord: deleteRecord,
+		deleteRRSet: func(ctx context.Context, zone, name, recordType string) error {
+			return deleteRecord(ctx, zone, name, recordType)
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	ctx := context.Background()
+
+	current, err := p.Records(ctx)
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	desired, err := p.AdjustEndpoints([]*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "2001:db8::1")})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	pl := &plan.Plan{Current: current, Desired: desired, Policies: []plan.Policy{&plan.SyncPolicy{}}, ManagedRecords: []string{"A"}}
+	changes := pl.Calculate().Changes
+	if len(changes.Delete) != 0 {
+		t.Fatalf("plan deletes %v", changes.Delete)
+	}
+	if err = p.ApplyChanges(ctx, changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(deleted) != 0 {
+		t.Errorf("deleted records = %v", deleted)
+	}
+}
+
+func Test_dnsProvider_ApplyChanges_invalidTarget(t *testing.T) {
+	var mu sync.Mutex
+	var added []string
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com"}}, nil
+		},
+		addZoneRRSet: func(_ context.Context, _, name, recordType string, values []dns.ResourceRecord, _ int, _ ...dns.AddZoneOpt) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, v := range values {
+				added = append(added, name+" "+recordType+" "+v.ContentToString())
+			}
+			return nil
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}, skipPolicy: SkipPolicyFail}
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpoint("example.com", "MX", "10 mail.example.com"),
+		endpoint.NewEndpoint("example.com", "CAA", `0 issue "letsencrypt.org"`),
+		endpoint.NewEndpoint("bad.example.com", "MX", "mail.example.com"),
+	}})
+
+	var skippedErr *SkippedChangesError
+	if !errors.As(err, &skippedErr) || len(skippedErr.Changes) != 1 || skippedErr.Changes[0].Reason != skipReasonInvalidTarget {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]bool{"example.com MX 10 mail.example.com": true, "example.com CAA 0 issue letsencrypt.org": true}
+	if len(added) != len(want) || !want[added[0]] || !want[added[1]] {
+		t.Errorf("added records = %v", added)
+	}
+}
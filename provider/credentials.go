@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+)
+
+const (
+	ENV_API_TOKEN_FILE  = "EC_API_TOKEN_FILE"
+	ENV_API_AUTH_SCHEME = "EC_API_AUTH_SCHEME"
+
+	// AuthSchemeAPIKey sends token as "Authorization: APIKey <token>", it is the default
+	AuthSchemeAPIKey = "apikey"
+	// AuthSchemeBearer sends token as "Authorization: Bearer <token>"
+	AuthSchemeBearer = "bearer"
+)
+
+// tokenReloadInterval is how often token files are checked for rotation
+var tokenReloadInterval = 30 * time.Second
+
+func parseAuthScheme(scheme string) (string, error) {
+	switch strings.ToLower(scheme) {
+	case "", AuthSchemeAPIKey:
+		return AuthSchemeAPIKey, nil
+	case AuthSchemeBearer:
+		return AuthSchemeBearer, nil
+	}
+	return "", fmt.Errorf("unknown auth scheme '%s', expected %s or %s", scheme, AuthSchemeAPIKey, AuthSchemeBearer)
+}
+
+// tokenRotator replaces token used by a client
+type tokenRotator interface {
+	rotate(token string)
+}
+
+// swappableAuth is an authorizer of dns.Client which token can be replaced at any time.
+// The SDK builds Authorization header once per request, so a swap never affects requests in flight.
+// It is generic only because the SDK doesn't export type of the header.
+type swappableAuth[T any] struct {
+	build func(token string) func() T
+	auth  atomic.Pointer[func() T]
+}
+
+func newSwappableAuth[T any](build func(token string) func() T, token string) *swappableAuth[T] {
+	a := &swappableAuth[T]{build: build}
+	a.rotate(token)
+	return a
+}
+
+func (a *swappableAuth[T]) authorizer() T {
+	return (*a.auth.Load())()
+}
+
+func (a *swappableAuth[T]) rotate(token string) {
+	auth := a.build(token)
+	a.auth.Store(&auth)
+}
+
+// newClient creates API client authorized with token according to scheme
+func newClient(scheme, token string) (*dns.Client, tokenRotator) {
+	build := dns.PermanentAPIKeyAuth
+	if scheme == AuthSchemeBearer {
+		build = dns.BearerAuth
+	}
+	auth := newSwappableAuth(build, token)
+	return dns.NewClient(auth.authorizer), auth
+}
+
+// tokenFile is an account token kept in file, the client gets a new token once the file is changed
+type tokenFile struct {
+	alias   string
+	path    string
+	rotator tokenRotator
+	stamp   string
+}
+
+func fileStamp(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", fi.Size(), fi.ModTime().UnixNano()), nil
+}
+
+func readToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file '%s' is empty", path)
+	}
+	return token, nil
+}
+
+// reload passes token to the client if the file is changed.
+// Previous token is kept on any error, so a half-written secret doesn't break the client.
+func (f *tokenFile) reload() (bool, error) {
+	stamp, err := fileStamp(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat token file: %w", err)
+	}
+	if stamp == f.stamp {
+		return false, nil
+	}
+	token, err := readToken(f.path)
+	if err != nil {
+		return false, err
+	}
+	f.rotator.rotate(token)
+	f.stamp = stamp
+	return true, nil
+}
+
+// WatchTokens polls token files of accounts and rotates tokens of their clients until ctx is done
+func (p *DnsProvider) WatchTokens(ctx context.Context) {
+	if len(p.tokenFiles) == 0 {
+		return
+	}
+	ticker := time.NewTicker(tokenReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.reloadTokens(ctx)
+		}
+	}
+}
+
+func (p *DnsProvider) reloadTokens(ctx context.Context) {
+	for _, f := range p.tokenFiles {
+		logger := log.Logger(ctx).WithField(log.AccountKey, f.alias)
+		reloaded, err := f.reload()
+		if err != nil {
+			metrics.TokenReloads.WithLabelValues(f.alias, metrics.StatusError).Inc()
+			logger.WithField(log.ErrorKey, err).Error("failed to reload API token, keep using previous one")
+			continue
+		}
+		if reloaded {
+			metrics.TokenReloads.WithLabelValues(f.alias, metrics.StatusOK).Inc()
+			logger.Info("API token reloaded")
+		}
+	}
+}
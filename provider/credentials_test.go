@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func Test_parseAuthScheme(t *testing.T) {
+	tests := []struct {
+		scheme  string
+		want    string
+		wantErr bool
+	}{
+		{scheme: "", want: AuthSchemeAPIKey},
+		{scheme: "APIKey", want: AuthSchemeAPIKey},
+		{scheme: "Bearer", want: AuthSchemeBearer},
+		{scheme: "basic", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scheme, func(t *testing.T) {
+			got, err := parseAuthScheme(tt.scheme)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAuthScheme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseAuthScheme() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// authRecorder is an API returning no zones which records Authorization headers,
+// requests are held until release is closed if it is set
+type authRecorder struct {
+	mu      sync.Mutex
+	headers []string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (a *authRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	started, release := a.started, a.release
+	a.mu.Unlock()
+	if release != nil {
+		started <- struct{}{}
+		<-release
+	}
+	a.mu.Lock()
+	a.headers = append(a.headers, r.Header.Get("Authorization"))
+	a.mu.Unlock()
+	_, _ = w.Write([]byte(`{"zones":[]}`))
+}
+
+func (a *authRecorder) hold(started, release chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.started, a.release = started, release
+}
+
+func (a *authRecorder) last() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.headers[len(a.headers)-1]
+}
+
+func Test_tokenRotation(t *testing.T) {
+	api := &authRecorder{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "token")
+	write := func(token string) {
+		if err := os.WriteFile(path, []byte(token), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("old\n")
+
+	p, err := NewMultiAccountProvider(srv.URL, []Account{{Alias: "main", TokenFile: path, AuthScheme: "bearer"}}, false)
+	if err != nil {
+		t.Fatalf("NewMultiAccountProvider() error = %v", err)
+	}
+	ctx := context.Background()
+	if _, err = p.Records(ctx); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if got := api.last(); got != "Bearer old" {
+		t.Errorf("Authorization = %s, want Bearer old", got)
+	}
+
+	// request in flight completes with the token it was started with
+	started, release := make(chan struct{}), make(chan struct{})
+	api.hold(started, release)
+	done := make(chan error)
+	go func() {
+		_, err := p.Records(ctx)
+		done <- err
+	}()
+	<-started
+	write("rotated\n")
+	p.reloadTokens(ctx)
+	close(release)
+	if err = <-done; err != nil {
+		t.Fatalf("Records() in flight error = %v", err)
+	}
+	if got := api.last(); got != "Bearer old" {
+		t.Errorf("Authorization in flight = %s, want Bearer old", got)
+	}
+	api.hold(nil, nil)
+
+	if _, err = p.Records(ctx); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if got := api.last(); got != "Bearer rotated" {
+		t.Errorf("Authorization after rotation = %s, want Bearer rotated", got)
+	}
+
+	// empty file is ignored, previous token is used
+	write("")
+	p.reloadTokens(ctx)
+	if _, err = p.Records(ctx); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if got := api.last(); got != "Bearer rotated" {
+		t.Errorf("Authorization after empty file = %s, want Bearer rotated", got)
+	}
+}
@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule matches minutes of a standard 5 field cron expression "minute hour day-of-month month day-of-week"
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set for "*" days, otherwise either of day fields matches like in cron
+	domAny, dowAny bool
+}
+
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var (
+	cronMinute = cronField{min: 0, max: 59}
+	cronHour   = cronField{min: 0, max: 23}
+	cronDom    = cronField{min: 1, max: 31}
+	cronMonth  = cronField{min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	// 7 is Sunday as well as 0
+	cronDow = cronField{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// parseCron parses lists, ranges, steps and names of months and days of week, e.g. "0 18 * * fri" or "*/15 9-17 * * 1-5"
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression '%s': expected 5 fields, got %d", spec, len(fields))
+	}
+	var c cronSchedule
+	var err error
+	for i, dst := range []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow} {
+		f := []cronField{cronMinute, cronHour, cronDom, cronMonth, cronDow}[i]
+		if *dst, err = f.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", spec, err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = fields[2] == "*", fields[4] == "*"
+	return &c, nil
+}
+
+func (f cronField) parse(s string) (uint64, error) {
+	var res uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in '%s'", item)
+			}
+			rng = item[:i]
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range '%s'", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			res |= 1 << v
+		}
+	}
+	return res, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value '%s' is out of range %d-%d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (c *cronSchedule) matches(t time.Time) bool {
+	if c.minute&(1<<t.Minute()) == 0 || c.hour&(1<<t.Hour()) == 0 || c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom, dow := c.dom&(1<<t.Day()) != 0, c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// lastStart returns the latest matching minute within d before t, false if there is none
+func (c *cronSchedule) lastStart(t time.Time, d time.Duration) (time.Time, bool) {
+	start := t.Truncate(time.Minute)
+	for m := start; t.Sub(m) < d; m = m.Add(-time.Minute) {
+		if c.matches(m) {
+			return m, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,205 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	ENV_DISABLED_RECORDS_POLICY = "EC_DISABLED_RECORDS_POLICY"
+
+	// DisabledTargetsProperty is ProviderSpecific property listing targets which are disabled in EdgeCenter,
+	// e.g. from the control panel, as JSON array, as TXT and CAA targets may contain commas
+	DisabledTargetsProperty = "webhook/edgecenter-disabled"
+)
+
+// DisabledPolicy defines whether disabled targets which are still desired may be enabled again
+type DisabledPolicy string
+
+const (
+	// DisabledPolicyKeep leaves disabled targets disabled, they are reported as unchanged to external-dns
+	DisabledPolicyKeep DisabledPolicy = "keep"
+	// DisabledPolicyEnable enables disabled targets which are desired by external-dns
+	DisabledPolicyEnable DisabledPolicy = "enable"
+)
+
+// ParseDisabledPolicy parses policy name, empty name means DisabledPolicyKeep
+func ParseDisabledPolicy(s string) (DisabledPolicy, error) {
+	switch DisabledPolicy(strings.ToLower(s)) {
+	case "", DisabledPolicyKeep:
+		return DisabledPolicyKeep, nil
+	case DisabledPolicyEnable:
+		return DisabledPolicyEnable, nil
+	}
+	return "", fmt.Errorf("unknown disabled records policy '%s', expected %s or %s", s, DisabledPolicyKeep, DisabledPolicyEnable)
+}
+
+// WithDisabledPolicy sets whether disabled targets may be enabled again
+func WithDisabledPolicy(policy DisabledPolicy) Option {
+	return func(p *DnsProvider) {
+		p.disabledPolicy = policy
+	}
+}
+
+// rrsetKey identifies RRSet, or records of one SetIdentifier in it when setIdentifier is set
+type rrsetKey struct {
+	name          string
+	recordType    string
+	setIdentifier string
+}
+
+func newRRSetKey(name, recordType string) rrsetKey {
+	return rrsetKey{name: normalizeZone(name), recordType: recordType}
+}
+
+func (k rrsetKey) withSetIdentifier(setIdentifier string) rrsetKey {
+	k.setIdentifier = setIdentifier
+	return k
+}
+
+// disabledTargets are disabled targets of RRSets seen by the last Records call
+type disabledTargets map[rrsetKey][]string
+
+// rrsetSnapshot is what the last Records call learned from RRSets beyond short answers of zone records
+type rrsetSnapshot struct {
+	disabled disabledTargets
+	// shared are RRSets having records of endpoints with SetIdentifier
+	shared map[rrsetKey]sharedRRSet
+}
+
+// sharedRRSet is RRSet with records of several endpoints distinguished by SetIdentifier
+type sharedRRSet struct {
+	ttl            endpoint.TTL
+	setIdentifiers []string
+}
+
+func newRRSetSnapshot(rrsets map[rrsetKey]dns.RRSet) *rrsetSnapshot {
+	shared := make(map[rrsetKey]sharedRRSet)
+	for key, set := range rrsets {
+		if !hasSetIdentifiers(set) {
+			continue
+		}
+		s := sharedRRSet{ttl: endpoint.TTL(set.TTL)}
+		for _, g := range groupBySetIdentifier(set) {
+			s.setIdentifiers = append(s.setIdentifiers, g.setIdentifier)
+		}
+		shared[key] = s
+	}
+	return &rrsetSnapshot{disabled: findDisabledTargets(rrsets), shared: shared}
+}
+
+// findDisabledTargets returns disabled targets of rrsets by SetIdentifier of records
+func findDisabledTargets(rrsets map[rrsetKey]dns.RRSet) disabledTargets {
+	res := make(disabledTargets)
+	for key, set := range rrsets {
+		for _, rr := range set.Records {
+			if !rr.Enabled {
+				k := key.withSetIdentifier(recordSetIdentifier(rr))
+				res[k] = append(res[k], formatAnswer(key.recordType, rr.ContentToString()))
+			}
+		}
+	}
+	for _, disabled := range res {
+		sort.Strings(disabled)
+	}
+	return res
+}
+
+// markDisabled adds disabled targets missing from e and sets DisabledTargetsProperty
+func markDisabled(e *endpoint.Endpoint, disabled []string) {
+	if len(disabled) == 0 {
+		return
+	}
+	for _, d := range disabled {
+		if !containsTarget(e.RecordType, e.Targets, d) {
+			e.Targets = append(e.Targets, d)
+		}
+	}
+	e.SetProviderSpecificProperty(DisabledTargetsProperty, encodeTargets(disabled))
+}
+
+// disabledOf returns targets listed in DisabledTargetsProperty of e
+func disabledOf(e *endpoint.Endpoint) []string {
+	v, ok := e.GetProviderSpecificProperty(DisabledTargetsProperty)
+	if !ok || v == "" {
+		return nil
+	}
+	var targets []string
+	if err := json.Unmarshal([]byte(v), &targets); err != nil {
+		return nil
+	}
+	return targets
+}
+
+// encodeTargets encodes targets for DisabledTargetsProperty
+func encodeTargets(targets []string) string {
+	b, _ := json.Marshal(targets)
+	return string(b)
+}
+
+func containsTarget(recordType string, targets []string, target string) bool {
+	for _, t := range targets {
+		if sameTarget(recordType, t, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// adjustDisabled copies DisabledTargetsProperty of current records to desired endpoint e,
+// so the plan doesn't see a change for desired targets kept disabled
+func adjustDisabled(e *endpoint.Endpoint, current disabledTargets) {
+	var disabled []string
+	for _, d := range current[newRRSetKey(toASCII(e.DNSName), e.RecordType).withSetIdentifier(e.SetIdentifier)] {
+		if containsTarget(e.RecordType, e.Targets, d) {
+			disabled = append(disabled, d)
+		}
+	}
+	if len(disabled) > 0 {
+		e.SetProviderSpecificProperty(DisabledTargetsProperty, encodeTargets(disabled))
+	}
+}
+
+// targetsToEnable returns targets of update which are disabled in existing
+func targetsToEnable(update *endpoint.Endpoint, existing []*endpoint.Endpoint) []string {
+	var res []string
+	for _, ex := range existing {
+		if !sameRecordSet(ex, update) {
+			continue
+		}
+		for _, d := range disabledOf(ex) {
+			if containsTarget(update.RecordType, update.Targets, d) && !containsTarget(update.RecordType, disabledOf(update), d) {
+				res = append(res, d)
+			}
+		}
+	}
+	return res
+}
+
+// enableTargets enables records of RRSet matching targets keeping the rest of RRSet as is
+func (p *DnsProvider) enableTargets(ctx context.Context, acc *account, zone string, e *endpoint.Endpoint, targets []string) error {
+	set, err := acc.client.RRSet(ctx, zone, e.DNSName, e.RecordType)
+	if err != nil {
+		return fmt.Errorf("failed to get rrset to enable records: %w", err)
+	}
+	changed := false
+	for i, rr := range set.Records {
+		if !rr.Enabled && recordSetIdentifier(rr) == e.SetIdentifier && containsTarget(e.RecordType, targets, formatAnswer(e.RecordType, rr.ContentToString())) {
+			set.Records[i].Enabled = true
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err = acc.client.UpdateRRSet(ctx, zone, e.DNSName, e.RecordType, set); err != nil {
+		return fmt.Errorf("failed to enable rrset records: %w", err)
+	}
+	return nil
+}
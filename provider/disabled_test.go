@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func Test_ParseDisabledPolicy(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    DisabledPolicy
+		wantErr bool
+	}{
+		{s: "", want: DisabledPolicyKeep},
+		{s: "keep", want: DisabledPolicyKeep},
+		{s: "Enable", want: DisabledPolicyEnable},
+		{s: "delete", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseDisabledPolicy(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDisabledPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDisabledPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dnsProvider_Records_disabled(t *testing.T) {
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com", Records: []dns.ZoneRecord{
+				// short answers of disabled records may be missing
+				{Name: "example.com", Type: "MX", TTL: 300, ShortAnswers: []string{"10 mx1.example.com."}},
+				{Name: "www.example.com", Type: "A", TTL: 300, ShortAnswers: []string{"1.1.1.1"}},
+			}}}, nil
+		},
+		rrSet: func(_ context.Context, _, name, recordType string) (dns.RRSet, error) {
+			if recordType != "MX" {
+				return dns.RRSet{Records: []dns.ResourceRecord{{Content: []any{"1.1.1.1"}, Enabled: true}}}, nil
+			}
+			return dns.RRSet{Records: []dns.ResourceRecord{
+				{Content: []any{float64(10), "mx1.example.com."}, Enabled: true},
+				{Content: []any{float64(20), "mx2.example.com."}, Enabled: false},
+			}}, nil
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+
+	got, err := p.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	want := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("example.com", "MX", 300, "10 mx1.example.com", "20 mx2.example.com").
+			WithProviderSpecific(DisabledTargetsProperty, `["20 mx2.example.com"]`),
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "1.1.1.1"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Records() = %v, want %v", got, want)
+	}
+
+	desired := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("example.com", "MX", "10 mx1.example.com", "20 mx2.example.com"),
+		endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1"),
+	}
+	adjusted, err := p.AdjustEndpoints(desired)
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	if v, _ := adjusted[0].GetProviderSpecificProperty(DisabledTargetsProperty); v != `["20 mx2.example.com"]` {
+		t.Errorf("AdjustEndpoints() disabled targets = %q", v)
+	}
+	if len(adjusted[1].ProviderSpecific) != 0 {
+		t.Errorf("AdjustEndpoints() marked enabled record %v", adjusted[1])
+	}
+}
+
+func Test_disabledOf_commas(t *testing.T) {
+	e := endpoint.NewEndpoint("example.com", "TXT", "v=spf1 a,mx ~all")
+	disabled := []string{`"a,b"`, `"c"`}
+	markDisabled(e, disabled)
+	if got := disabledOf(e); !reflect.DeepEqual(got, disabled) {
+		t.Errorf("disabledOf() = %q, want %q", got, disabled)
+	}
+}
+
+func Test_targetsToEnable(t *testing.T) {
+	old := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1", "2.2.2.2", "3.3.3.3").
+		WithProviderSpecific(DisabledTargetsProperty, `["2.2.2.2","3.3.3.3"]`)
+	update := endpoint.NewEndpoint("WWW.example.com", "A", "1.1.1.1", "2.2.2.2", "3.3.3.3").
+		WithProviderSpecific(DisabledTargetsProperty, `["3.3.3.3"]`)
+
+	if got := targetsToEnable(update, []*endpoint.Endpoint{old}); !reflect.DeepEqual(got, []string{"2.2.2.2"}) {
+		t.Errorf("targetsToEnable() = %v", got)
+	}
+}
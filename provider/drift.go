@@ -0,0 +1,401 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	ENV_DRIFT_STATE_FILE = "EC_DRIFT_STATE_FILE"
+	ENV_DRIFT_INTERVAL   = "EC_DRIFT_INTERVAL"
+	ENV_DRIFT_RESTORE    = "EC_DRIFT_RESTORE"
+
+	DefaultDriftInterval = 5 * time.Minute
+)
+
+const (
+	// DriftChanged is a record whose targets, TTL or properties differ from the applied ones
+	DriftChanged = "changed"
+	// DriftDeleted is an applied record which is missing
+	DriftDeleted = "deleted"
+)
+
+// DriftedRecord is an applied record changed out-of-band, e.g. in the control panel
+type DriftedRecord struct {
+	Reason   string             `json:"reason"`
+	Expected *endpoint.Endpoint `json:"expected"`
+	Actual   *endpoint.Endpoint `json:"actual,omitempty"`
+}
+
+// DriftReport is the result of a drift check
+type DriftReport struct {
+	CheckedAt time.Time       `json:"checkedAt"`
+	Tracked   int             `json:"tracked"`
+	Drifted   []DriftedRecord `json:"drifted"`
+	Restored  bool            `json:"restored"`
+}
+
+// driftState is the persisted form of applied records
+type driftState struct {
+	Endpoints []*endpoint.Endpoint `json:"endpoints"`
+}
+
+// driftDetector remembers records applied by ApplyChanges and compares them with live ones
+type driftDetector struct {
+	stateFile string
+	interval  time.Duration
+	restore   bool
+
+	mu      sync.Mutex
+	applied map[rrsetKey]*endpoint.Endpoint
+	// applying is the number of ApplyChanges in progress, generation changes when they finish,
+	// checks overlapping with them are discarded as live records may be half applied
+	applying   int
+	generation uint64
+	report     *DriftReport
+}
+
+// WithDriftDetection makes WatchDrift compare live records with records applied by ApplyChanges every interval.
+// Applied records are persisted to stateFile, so they survive restarts. With restore drifted records
+// are changed back to the applied state.
+func WithDriftDetection(stateFile string, interval time.Duration, restore bool) Option {
+	return func(p *DnsProvider) {
+		d := &driftDetector{stateFile: stateFile, interval: interval, restore: restore, applied: make(map[rrsetKey]*endpoint.Endpoint)}
+		if err := d.load(); err != nil {
+			log.Logger(context.Background()).WithField(log.ErrorKey, err).Warning("failed to load drift state, applied records are tracked from scratch")
+		}
+		p.drift = d
+	}
+}
+
+func driftKey(e *endpoint.Endpoint) rrsetKey {
+	return newRRSetKey(e.DNSName, e.RecordType).withSetIdentifier(e.SetIdentifier)
+}
+
+func (d *driftDetector) load() error {
+	b, err := os.ReadFile(d.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state driftState
+	if err = json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", d.stateFile, err)
+	}
+	for _, e := range state.Endpoints {
+		d.applied[driftKey(e)] = e
+	}
+	return nil
+}
+
+// save writes applied records to the state file
+func (d *driftDetector) save() error {
+	state := driftState{Endpoints: make([]*endpoint.Endpoint, 0, len(d.applied))}
+	for _, e := range d.applied {
+		state.Endpoints = append(state.Endpoints, e)
+	}
+	sortEndpoints(state.Endpoints)
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(d.stateFile, b)
+}
+
+// writeFileAtomic writes b to a temporary file and renames it, so the file is never half written
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func sortEndpoints(endpoints []*endpoint.Endpoint) {
+	sort.Slice(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if a.DNSName != b.DNSName {
+			return a.DNSName < b.DNSName
+		}
+		if a.RecordType != b.RecordType {
+			return a.RecordType < b.RecordType
+		}
+		return a.SetIdentifier < b.SetIdentifier
+	})
+}
+
+// begin marks ApplyChanges in progress
+func (d *driftDetector) begin() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.applying++
+}
+
+// end finishes ApplyChanges, applied changes are remembered unless they are a dry run.
+// Skipped changes and TXT records, which are registry records or dropped by AdjustEndpoints, aren't tracked.
+// Failed changes leave their records half applied, so those records aren't tracked until they are applied again.
+func (d *driftDetector) end(ctx context.Context, changes *plan.Changes, skipped *skippedChanges, results *changeResults, dryRun bool) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.applying--
+	d.generation++
+	if dryRun {
+		return
+	}
+
+	tracked := func(e *endpoint.Endpoint) bool {
+		if e.RecordType == endpoint.RecordTypeTXT {
+			return false
+		}
+		for _, s := range skipped.changes {
+			if newRRSetKey(s.DNSName, s.RecordType).withSetIdentifier(s.SetIdentifier) == driftKey(e) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, e := range slices.Concat(changes.Create, changes.UpdateOld, changes.UpdateNew, changes.Delete) {
+		if results.hasFailed(e) {
+			delete(d.applied, driftKey(e))
+		}
+	}
+	for _, e := range slices.Concat(changes.UpdateOld, changes.Delete) {
+		if tracked(e) {
+			delete(d.applied, driftKey(e))
+		}
+	}
+	for _, e := range slices.Concat(changes.Create, changes.UpdateNew) {
+		if tracked(e) && !results.hasFailed(e) {
+			d.applied[driftKey(e)] = e
+		}
+	}
+	if err := d.save(); err != nil {
+		log.Logger(ctx).WithField(log.ErrorKey, err).Error("failed to save drift state")
+	}
+}
+
+// WatchDrift checks drift of applied records every interval until ctx is done, it does nothing without drift detection
+func (p *DnsProvider) WatchDrift(ctx context.Context) {
+	if p.drift == nil {
+		return
+	}
+	ticker := time.NewTicker(p.drift.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkDrift(log.Trace(ctx))
+		}
+	}
+}
+
+// DriftReport returns the result of the last drift check, false if drift detection is disabled
+func (p *DnsProvider) DriftReport() (DriftReport, bool) {
+	if p.drift == nil {
+		return DriftReport{}, false
+	}
+	p.drift.mu.Lock()
+	defer p.drift.mu.Unlock()
+	if p.drift.report == nil {
+		return DriftReport{Drifted: []DriftedRecord{}}, true
+	}
+	return *p.drift.report, true
+}
+
+// checkDrift compares live records with applied ones, reports drifted records and restores them if enabled
+func (p *DnsProvider) checkDrift(ctx context.Context) {
+	logger := log.Logger(ctx)
+	d := p.drift
+
+	d.mu.Lock()
+	generation, applying := d.generation, d.applying
+	applied := make([]*endpoint.Endpoint, 0, len(d.applied))
+	for _, e := range d.applied {
+		applied = append(applied, e)
+	}
+	d.mu.Unlock()
+	if applying > 0 {
+		logger.Debug("drift check skipped, changes are being applied")
+		return
+	}
+
+	// Records would replace the snapshot and the zone index ApplyChanges in progress relies on
+	live, _, _, err := p.records(ctx)
+	if err != nil {
+		metrics.DriftChecks.WithLabelValues(metrics.StatusError).Inc()
+		logger.WithField(log.ErrorKey, err).Error("drift check failed")
+		return
+	}
+	report := &DriftReport{CheckedAt: time.Now(), Tracked: len(applied), Drifted: findDrift(applied, live)}
+
+	d.mu.Lock()
+	if d.generation != generation || d.applying > 0 {
+		d.mu.Unlock()
+		logger.Debug("drift check discarded, changes were applied meanwhile")
+		return
+	}
+	d.report = report
+	d.mu.Unlock()
+
+	metrics.DriftChecks.WithLabelValues(metrics.StatusOK).Inc()
+	counts := map[string]int{DriftChanged: 0, DriftDeleted: 0}
+	for _, r := range report.Drifted {
+		counts[r.Reason]++
+		logger.WithField(log.DNSNameKey, r.Expected.DNSName).
+			WithField("record_type", r.Expected.RecordType).
+			WithField("set_identifier", r.Expected.SetIdentifier).
+			WithField("expected", r.Expected.Targets).
+			WithField("actual", actualTargets(r.Actual)).
+			Warningf("record drifted - %s", r.Reason)
+	}
+	for reason, n := range counts {
+		metrics.DriftedRecords.WithLabelValues(reason).Set(float64(n))
+	}
+	if len(report.Drifted) == 0 || !d.restore {
+		return
+	}
+	restorable := p.restorableDrift(report.Drifted)
+	if len(restorable) < len(report.Drifted) {
+		logger.Warningf("%d drifted record(s) differ only in disabled targets, they are enabled only with %s disabled policy",
+			len(report.Drifted)-len(restorable), DisabledPolicyEnable)
+	}
+	if len(restorable) == 0 {
+		return
+	}
+
+	if err = p.applyChanges(ctx, restoreChanges(restorable)); err != nil {
+		metrics.DriftRestores.WithLabelValues(metrics.StatusError).Inc()
+		logger.WithField(log.ErrorKey, err).Error("failed to restore drifted records")
+		return
+	}
+	metrics.DriftRestores.WithLabelValues(metrics.StatusOK).Inc()
+	logger.Infof("%d drifted record(s) restored", len(restorable))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.report == report {
+		d.report.Restored = true
+	}
+}
+
+func actualTargets(e *endpoint.Endpoint) endpoint.Targets {
+	if e == nil {
+		return nil
+	}
+	return e.Targets
+}
+
+// findDrift returns applied records which are missing or differ from live records
+func findDrift(applied, live []*endpoint.Endpoint) []DriftedRecord {
+	liveByKey := make(map[rrsetKey]*endpoint.Endpoint, len(live))
+	for _, e := range live {
+		e = endpointToASCII(e)
+		liveByKey[driftKey(e)] = e
+	}
+	sortEndpoints(applied)
+
+	res := make([]DriftedRecord, 0)
+	for _, expected := range applied {
+		actual := liveByKey[driftKey(expected)]
+		switch {
+		case actual == nil:
+			res = append(res, DriftedRecord{Reason: DriftDeleted, Expected: expected})
+		case !sameRecord(expected, actual):
+			res = append(res, DriftedRecord{Reason: DriftChanged, Expected: expected, Actual: actual})
+		}
+	}
+	return res
+}
+
+// sameRecord compares targets, TTL if it's configured and ProviderSpecific properties of records
+func sameRecord(expected, actual *endpoint.Endpoint) bool {
+	if expected.RecordTTL.IsConfigured() && expected.RecordTTL != actual.RecordTTL {
+		return false
+	}
+	if len(findDiff(expected, actual)) > 0 || len(findDiff(actual, expected)) > 0 {
+		return false
+	}
+	return maps.Equal(properties(expected), properties(actual))
+}
+
+func properties(e *endpoint.Endpoint) map[string]string {
+	res := make(map[string]string, len(e.ProviderSpecific))
+	for _, p := range e.ProviderSpecific {
+		res[p.Name] = p.Value
+	}
+	return res
+}
+
+// restorableDrift returns drifted records ApplyChanges can bring back. Disabled targets are enabled only
+// with DisabledPolicyEnable, so otherwise records differing only in them are reported but not restored,
+// restoring them would change nothing and repeat on every check.
+func (p *DnsProvider) restorableDrift(drifted []DriftedRecord) []DriftedRecord {
+	if p.disabledPolicy == DisabledPolicyEnable {
+		return drifted
+	}
+	res := make([]DriftedRecord, 0, len(drifted))
+	for _, r := range drifted {
+		if r.Reason == DriftChanged && sameRecord(withoutDisabled(r.Expected), withoutDisabled(r.Actual)) {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+func withoutDisabled(e *endpoint.Endpoint) *endpoint.Endpoint {
+	e = e.DeepCopy()
+	e.DeleteProviderSpecificProperty(DisabledTargetsProperty)
+	return e
+}
+
+// restoreChanges returns changes bringing drifted records back to the applied state
+func restoreChanges(drifted []DriftedRecord) *plan.Changes {
+	changes := &plan.Changes{}
+	for _, r := range drifted {
+		switch r.Reason {
+		case DriftDeleted:
+			changes.Create = append(changes.Create, r.Expected)
+		case DriftChanged:
+			changes.UpdateOld = append(changes.UpdateOld, r.Actual)
+			changes.UpdateNew = append(changes.UpdateNew, r.Expected)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,231 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_findDrift(t *testing.T) {
+	same := endpoint.NewEndpointWithTTL("a.example.com", "A", 60, "1.1.1.1", "2.2.2.2")
+	changed := endpoint.NewEndpointWithTTL("b.example.com", "A", 60, "1.1.1.1")
+	ttl := endpoint.NewEndpointWithTTL("c.example.com", "A", 60, "1.1.1.1")
+	props := endpoint.NewEndpoint("d.example.com", "A", "1.1.1.1").WithSetIdentifier("eu").WithProviderSpecific(WeightProperty, "10")
+	deleted := endpoint.NewEndpoint("e.example.com", "A", "1.1.1.1")
+	idn := endpoint.NewEndpoint(toASCII("пример.com"), "A", "1.1.1.1")
+
+	live := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.example.com", "A", 300, "2.2.2.2", "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("b.example.com", "A", 60, "1.1.1.1", "3.3.3.3"),
+		endpoint.NewEndpointWithTTL("c.example.com", "A", 300, "1.1.1.1"),
+		endpoint.NewEndpoint("d.example.com", "A", "1.1.1.1").WithSetIdentifier("eu").WithProviderSpecific(WeightProperty, "20"),
+		endpoint.NewEndpoint("e.example.com", "A", "1.1.1.1").WithSetIdentifier("us"),
+		endpoint.NewEndpoint("пример.com", "A", "1.1.1.1"),
+		endpoint.NewEndpoint("unmanaged.example.com", "A", "1.1.1.1"),
+	}
+	same.RecordTTL = 0
+
+	got := findDrift([]*endpoint.Endpoint{deleted, props, ttl, changed, same, idn}, live)
+	want := []DriftedRecord{
+		{Reason: DriftChanged, Expected: changed, Actual: live[1]},
+		{Reason: DriftChanged, Expected: ttl, Actual: live[2]},
+		{Reason: DriftChanged, Expected: props, Actual: live[3]},
+		{Reason: DriftDeleted, Expected: deleted},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findDrift() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_restoreChanges(t *testing.T) {
+	expected := endpoint.NewEndpoint("a.example.com", "A", "1.1.1.1")
+	actual := endpoint.NewEndpoint("a.example.com", "A", "2.2.2.2")
+	deleted := endpoint.NewEndpoint("b.example.com", "A", "1.1.1.1")
+
+	got := restoreChanges([]DriftedRecord{
+		{Reason: DriftChanged, Expected: expected, Actual: actual},
+		{Reason: DriftDeleted, Expected: deleted},
+	})
+	want := &plan.Changes{
+		Create:    []*endpoint.Endpoint{deleted},
+		UpdateOld: []*endpoint.Endpoint{actual},
+		UpdateNew: []*endpoint.Endpoint{expected},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restoreChanges() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_driftDetector_end(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "drift.json")
+	p := &DnsProvider{}
+	WithDriftDetection(stateFile, DefaultDriftInterval, false)(p)
+	d := p.drift
+
+	old := endpoint.NewEndpoint("old.example.com", "A", "1.1.1.1")
+	d.begin()
+	d.end(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{old}}, &skippedChanges{}, &changeResults{}, false)
+
+	created := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1").WithSetIdentifier("eu")
+	skipped := &skippedChanges{changes: []SkippedChange{
+		{DNSName: "skipped.example.com", RecordType: "A"},
+		{DNSName: "www.example.com", RecordType: "A", SetIdentifier: "ap"},
+	}}
+	d.begin()
+	d.end(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			created,
+			endpoint.NewEndpoint("www.example.com", "TXT", `"heritage=external-dns"`),
+			endpoint.NewEndpoint("skipped.example.com", "A", "1.1.1.1"),
+			endpoint.NewEndpoint("www.example.com", "A", "4.4.4.4").WithSetIdentifier("ap"),
+		},
+		Delete: []*endpoint.Endpoint{old},
+	}, skipped, &changeResults{}, false)
+	// other SetIdentifiers of the skipped RRSet are tracked
+	if want := map[rrsetKey]*endpoint.Endpoint{driftKey(created): created}; !reflect.DeepEqual(d.applied, want) {
+		t.Errorf("applied = %v, want %v", d.applied, want)
+	}
+
+	// dry run changes aren't tracked
+	d.begin()
+	d.end(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{old}}, &skippedChanges{}, &changeResults{}, true)
+
+	// records of failed changes are forgotten, the rest of changes is tracked
+	failedCreate := endpoint.NewEndpoint("failed.example.com", "A", "1.1.1.1")
+	failedUpdate := endpoint.NewEndpoint("www.example.com", "A", "3.3.3.3").WithSetIdentifier("eu")
+	tracked := endpoint.NewEndpoint("www.example.com", "A", "2.2.2.2").WithSetIdentifier("us")
+	failed := &changeResults{}
+	failed.add(actionCreate, failedCreate, errors.New("api is down"))
+	failed.add(actionUpdate, failedUpdate, errors.New("api is down"))
+	d.begin()
+	d.end(context.Background(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{failedCreate, tracked},
+		UpdateOld: []*endpoint.Endpoint{created},
+		UpdateNew: []*endpoint.Endpoint{failedUpdate},
+	}, &skippedChanges{}, failed, false)
+
+	if d.applying != 0 || d.generation != 4 {
+		t.Errorf("applying = %d, generation = %d, want 0, 4", d.applying, d.generation)
+	}
+	want := map[rrsetKey]*endpoint.Endpoint{driftKey(tracked): tracked}
+	if !reflect.DeepEqual(d.applied, want) {
+		t.Errorf("applied = %v, want %v", d.applied, want)
+	}
+
+	// applied records survive restart
+	restarted := &DnsProvider{}
+	WithDriftDetection(stateFile, DefaultDriftInterval, false)(restarted)
+	if len(restarted.drift.applied) != 1 || restarted.drift.applied[driftKey(tracked)].String() != tracked.String() {
+		t.Errorf("loaded applied = %v, want %v", restarted.drift.applied, want)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(stateFile))
+	if len(entries) != 1 {
+		t.Errorf("state dir has %d files, want only state file", len(entries))
+	}
+}
+
+func Test_dnsProvider_DriftReport(t *testing.T) {
+	if _, ok := (&DnsProvider{}).DriftReport(); ok {
+		t.Errorf("DriftReport() without drift detection ok = true")
+	}
+	p := &DnsProvider{}
+	WithDriftDetection(filepath.Join(t.TempDir(), "drift.json"), DefaultDriftInterval, false)(p)
+	report, ok := p.DriftReport()
+	if !ok || report.Drifted == nil {
+		t.Errorf("DriftReport() = %+v, %v, want empty report", report, ok)
+	}
+}
+
+func Test_dnsProvider_checkDrift_keepsSnapshot(t *testing.T) {
+	client := &zonesClient{zones: []dns.Zone{
+		{Name: "example.com", Records: []dns.ZoneRecord{{Name: "www.example.com", Type: "A", TTL: 60, ShortAnswers: []string{"2.2.2.2"}}}},
+	}}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	WithDriftDetection(filepath.Join(t.TempDir(), "drift.json"), DefaultDriftInterval, false)(p)
+	p.drift.applied[driftKey(endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1"))] = endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")
+	snapshot, index := &rrsetSnapshot{}, newZoneIndex(nil)
+	p.snapshot.Store(snapshot)
+	p.index.Store(index)
+
+	p.checkDrift(context.Background())
+	if report, _ := p.DriftReport(); len(report.Drifted) != 1 {
+		t.Errorf("DriftReport() = %+v, want one drifted record", report)
+	}
+	if p.snapshot.Load() != snapshot || p.index.Load() != index {
+		t.Error("checkDrift() replaced the snapshot or the zone index of ApplyChanges")
+	}
+}
+
+func Test_dnsProvider_checkDrift_restoresTTL(t *testing.T) {
+	var mu sync.Mutex
+	ttl := 300
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return []dns.Zone{{Name: "example.com", Records: []dns.ZoneRecord{
+				{Name: "www.example.com", Type: "A", TTL: uint(ttl), ShortAnswers: []string{"1.1.1.1"}},
+			}}}, nil
+		},
+		rrSet: func(context.Context, string, string, string) (dns.RRSet, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return dns.RRSet{TTL: ttl, Records: []dns.ResourceRecord{{Content: []any{"1.1.1.1"}, Enabled: true}}}, nil
+		},
+		updateRRSet: func(_ context.Context, _, _, _ string, set dns.RRSet) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ttl = set.TTL
+			return nil
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	WithDriftDetection(filepath.Join(t.TempDir(), "drift.json"), DefaultDriftInterval, true)(p)
+	applied := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1")
+	p.drift.applied[driftKey(applied)] = applied
+
+	p.checkDrift(context.Background())
+	if report, _ := p.DriftReport(); len(report.Drifted) != 1 || !report.Restored {
+		t.Errorf("DriftReport() = %+v, want one restored record", report)
+	}
+	mu.Lock()
+	if ttl != 60 {
+		t.Errorf("live TTL = %d, want 60", ttl)
+	}
+	mu.Unlock()
+
+	p.checkDrift(context.Background())
+	if report, _ := p.DriftReport(); len(report.Drifted) != 0 {
+		t.Errorf("DriftReport() after restore = %+v, want no drift", report)
+	}
+}
+
+func Test_dnsProvider_restorableDrift(t *testing.T) {
+	expected := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2")
+	disabled := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2").
+		WithProviderSpecific(DisabledTargetsProperty, `["2.2.2.2"]`)
+	retimed := endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "1.1.1.1", "2.2.2.2").
+		WithProviderSpecific(DisabledTargetsProperty, `["2.2.2.2"]`)
+	drifted := []DriftedRecord{
+		{Reason: DriftChanged, Expected: expected, Actual: disabled},
+		{Reason: DriftChanged, Expected: expected, Actual: retimed},
+		{Reason: DriftDeleted, Expected: expected},
+	}
+
+	keep := &DnsProvider{disabledPolicy: DisabledPolicyKeep}
+	if got := keep.restorableDrift(drifted); !reflect.DeepEqual(got, drifted[1:]) {
+		t.Errorf("restorableDrift() with keep policy = %+v, want %+v", got, drifted[1:])
+	}
+	enable := &DnsProvider{disabledPolicy: DisabledPolicyEnable}
+	if got := enable.restorableDrift(drifted); !reflect.DeepEqual(got, drifted) {
+		t.Errorf("restorableDrift() with enable policy = %+v, want %+v", got, drifted)
+	}
+}
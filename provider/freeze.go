@@ -0,0 +1,310 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ENV_FREEZE_FILE          = "EC_FREEZE_FILE"
+	ENV_FREEZE_MODE          = "EC_FREEZE_MODE"
+	ENV_FREEZE_OVERRIDE_FILE = "EC_FREEZE_OVERRIDE_FILE"
+)
+
+// FreezeMode defines what happens to changes of records during a freeze window
+type FreezeMode string
+
+const (
+	// FreezeModeRefuse fails ApplyChanges with FreezeError after applying changes outside of freeze windows
+	FreezeModeRefuse FreezeMode = "refuse"
+	// FreezeModeQueue keeps frozen changes and applies them when windows end, ApplyChanges succeeds
+	FreezeModeQueue FreezeMode = "queue"
+)
+
+// freezeCheckInterval is how often queued changes are checked, windows start at minutes
+const freezeCheckInterval = time.Minute
+
+// ParseFreezeMode parses mode name, empty name means FreezeModeRefuse
+func ParseFreezeMode(s string) (FreezeMode, error) {
+	switch FreezeMode(strings.ToLower(s)) {
+	case "", FreezeModeRefuse:
+		return FreezeModeRefuse, nil
+	case FreezeModeQueue:
+		return FreezeModeQueue, nil
+	}
+	return "", fmt.Errorf("unknown freeze mode '%s', expected %s or %s", s, FreezeModeRefuse, FreezeModeQueue)
+}
+
+// FreezeWindow is a recurring period when records must not be changed
+type FreezeWindow struct {
+	Name string `json:"name"`
+	// Schedule is a cron expression "minute hour day-of-month month day-of-week" of window starts
+	Schedule string `json:"schedule"`
+	// Duration of the window like "64h"
+	Duration string `json:"duration"`
+	// TimeZone of Schedule like "Europe/Moscow", UTC if empty
+	TimeZone string `json:"timeZone,omitempty"`
+	// Zones limits the window to records in these zones and their subzones, all records are frozen if empty
+	Zones []string `json:"zones,omitempty"`
+}
+
+// LoadFreezeWindows reads freeze windows list from YAML or JSON file
+func LoadFreezeWindows(path string) ([]FreezeWindow, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read freeze windows file: %w", err)
+	}
+	windows := make([]FreezeWindow, 0)
+	if err = yaml.UnmarshalStrict(b, &windows); err != nil {
+		return nil, fmt.Errorf("failed to parse freeze windows file %s: %w", path, err)
+	}
+	return windows, nil
+}
+
+// freezeWindow is a parsed FreezeWindow
+type freezeWindow struct {
+	name     string
+	schedule *cronSchedule
+	duration time.Duration
+	location *time.Location
+	zones    []string
+}
+
+func (w *freezeWindow) active(t time.Time) bool {
+	_, ok := w.schedule.lastStart(t.In(w.location), w.duration)
+	return ok
+}
+
+// covers is true if the window freezes record name
+func (w *freezeWindow) covers(name string) bool {
+	if len(w.zones) == 0 {
+		return true
+	}
+	return inZones(name, w.zones)
+}
+
+// Freeze holds changes of records during freeze windows
+type Freeze struct {
+	windows      []*freezeWindow
+	mode         FreezeMode
+	overrideFile string
+	now          func() time.Time
+
+	mu sync.Mutex
+	// queued are the frozen changes of the latest ApplyChanges in FreezeModeQueue
+	queued *plan.Changes
+	// reported are starts of window occurrences refused changes were notified during, by refusedKey
+	reported map[string]time.Time
+}
+
+// NewFreeze parses windows, while overrideFile exists windows are ignored, e.g. to fix an incident during a freeze
+func NewFreeze(windows []FreezeWindow, mode FreezeMode, overrideFile string) (*Freeze, error) {
+	f := &Freeze{mode: mode, overrideFile: overrideFile, now: time.Now}
+	for i, w := range windows {
+		if w.Name == "" {
+			w.Name = fmt.Sprintf("window %d", i)
+		}
+		schedule, err := parseCron(w.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("freeze %s: %w", w.Name, err)
+		}
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("freeze %s: invalid duration '%s'", w.Name, w.Duration)
+		}
+		location, err := time.LoadLocation(w.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("freeze %s: %w", w.Name, err)
+		}
+		zones := make([]string, 0, len(w.Zones))
+		for _, z := range w.Zones {
+			zones = append(zones, normalizeZone(z))
+		}
+		f.windows = append(f.windows, &freezeWindow{name: w.Name, schedule: schedule, duration: duration, location: location, zones: zones})
+	}
+	return f, nil
+}
+
+// WithFreeze makes ApplyChanges hold changes of records during freeze windows, Records is served as usual
+func WithFreeze(f *Freeze) Option {
+	return func(p *DnsProvider) {
+		p.freeze = f
+	}
+}
+
+// FreezeError lists changes refused during freeze windows
+type FreezeError struct {
+	Windows []string
+	Changes int
+}
+
+func (e *FreezeError) Error() string {
+	return fmt.Sprintf("%d change(s) refused during freeze window(s) %s", e.Changes, strings.Join(e.Windows, ", "))
+}
+
+// overridden is true while the override file exists
+func (f *Freeze) overridden() bool {
+	if f.overrideFile == "" {
+		return false
+	}
+	_, err := os.Stat(f.overrideFile)
+	return err == nil
+}
+
+// hold splits changes into changes applied now and frozen ones. Frozen changes are refused with FreezeError
+// and returned as refused or replace queued changes, as ExternalDNS plans them again from the same records
+// until they are applied.
+func (f *Freeze) hold(ctx context.Context, changes *plan.Changes) (*plan.Changes, *plan.Changes, error) {
+	if f == nil {
+		return changes, &plan.Changes{}, nil
+	}
+	logger := log.Logger(ctx)
+	var active []*freezeWindow
+	now := f.now()
+	for _, w := range f.windows {
+		if w.active(now) {
+			active = append(active, w)
+		}
+	}
+	if len(active) > 0 && f.overridden() {
+		logger.Warningf("freeze windows are overridden by %s", f.overrideFile)
+		active = nil
+	}
+
+	// refused or queued changes by window, UpdateOld isn't counted as it is a half of update
+	frozenBy := make(map[string]int)
+	res, held := &plan.Changes{}, &plan.Changes{}
+	split := func(endpoints []*endpoint.Endpoint, applied, frozen *[]*endpoint.Endpoint, counted bool) {
+	next:
+		for _, e := range endpoints {
+			for _, w := range active {
+				if w.covers(e.DNSName) {
+					*frozen = append(*frozen, e)
+					if counted {
+						frozenBy[w.name]++
+					}
+					continue next
+				}
+			}
+			*applied = append(*applied, e)
+		}
+	}
+	split(changes.Create, &res.Create, &held.Create, true)
+	split(changes.UpdateOld, &res.UpdateOld, &held.UpdateOld, false)
+	split(changes.UpdateNew, &res.UpdateNew, &held.UpdateNew, true)
+	split(changes.Delete, &res.Delete, &held.Delete, true)
+	for name, n := range frozenBy {
+		metrics.FrozenChanges.WithLabelValues(name, string(f.mode)).Add(float64(n))
+	}
+
+	count := len(held.Create) + len(held.UpdateNew) + len(held.Delete)
+	if f.mode == FreezeModeQueue {
+		f.mu.Lock()
+		f.queued = held
+		f.mu.Unlock()
+		metrics.QueuedChanges.Set(float64(count))
+		if count > 0 {
+			logger.Warningf("%d change(s) queued until freeze windows end", count)
+		}
+		return res, &plan.Changes{}, nil
+	}
+	if count == 0 {
+		return res, &plan.Changes{}, nil
+	}
+	err := &FreezeError{Changes: count}
+	for _, w := range active {
+		if frozenBy[w.name] > 0 {
+			err.Windows = append(err.Windows, w.name)
+		}
+	}
+	logger.WithField(log.ErrorKey, err).Warning("changes refused")
+	return res, held, err
+}
+
+// unreported returns refused changes which weren't reported during the current occurrences of their windows,
+// as ExternalDNS plans refused changes again every interval. Changes no longer refused are forgotten.
+func (f *Freeze) unreported(refused *plan.Changes) *plan.Changes {
+	res := &plan.Changes{UpdateOld: refused.UpdateOld}
+	if f == nil {
+		return res
+	}
+	now := f.now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reported := make(map[string]time.Time)
+	filter := func(action string, endpoints []*endpoint.Endpoint, fresh *[]*endpoint.Endpoint) {
+		for _, e := range endpoints {
+			name, start := f.occurrence(e.DNSName, now)
+			key := refusedKey(name, action, e)
+			if prev, ok := f.reported[key]; !ok || !prev.Equal(start) {
+				*fresh = append(*fresh, e)
+			}
+			reported[key] = start
+		}
+	}
+	filter(actionCreate, refused.Create, &res.Create)
+	filter(actionUpdate, refused.UpdateNew, &res.UpdateNew)
+	filter(actionDelete, refused.Delete, &res.Delete)
+	f.reported = reported
+	return res
+}
+
+// occurrence returns name and start of the first active window freezing record name
+func (f *Freeze) occurrence(name string, t time.Time) (string, time.Time) {
+	for _, w := range f.windows {
+		if start, ok := w.schedule.lastStart(t.In(w.location), w.duration); ok && w.covers(name) {
+			return w.name, start
+		}
+	}
+	return "", time.Time{}
+}
+
+// refusedKey identifies a change refused during window, targets order doesn't matter
+func refusedKey(window, action string, e *endpoint.Endpoint) string {
+	targets := slices.Clone(e.Targets)
+	slices.Sort(targets)
+	return window + "\n" + journalChangeKey(action, e) + " " + strings.Join(targets, ",")
+}
+
+// WatchFreeze applies changes queued during freeze windows once they end, it does nothing without FreezeModeQueue
+func (p *DnsProvider) WatchFreeze(ctx context.Context) {
+	if p.freeze == nil || p.freeze.mode != FreezeModeQueue {
+		return
+	}
+	ticker := time.NewTicker(freezeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.applyQueued(log.Trace(ctx))
+		}
+	}
+}
+
+// applyQueued applies queued changes, changes still frozen are queued again by ApplyChanges
+func (p *DnsProvider) applyQueued(ctx context.Context) {
+	p.freeze.mu.Lock()
+	queued := p.freeze.queued
+	p.freeze.mu.Unlock()
+	if queued == nil || !queued.HasChanges() {
+		return
+	}
+	if err := p.applyChanges(ctx, queued); err != nil && !errors.Is(err, context.Canceled) {
+		log.Logger(ctx).WithField(log.ErrorKey, err).Error("failed to apply queued changes")
+	}
+}
@@ -0,0 +1,241 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/audit"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_parseCron(t *testing.T) {
+	// Friday
+	friday := time.Date(2025, 1, 3, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec    string
+		t       time.Time
+		want    bool
+		wantErr bool
+	}{
+		{spec: "0 18 * * fri", t: friday, want: true},
+		{spec: "0 18 * * FRI", t: friday.Add(time.Minute)},
+		{spec: "*/15 9-17 * * 1-5", t: time.Date(2025, 1, 6, 9, 45, 0, 0, time.UTC), want: true},
+		{spec: "*/15 9-17 * * 1-5", t: time.Date(2025, 1, 5, 9, 45, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", t: time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC), want: true},
+		{spec: "0 0 1,15 dec *", t: time.Date(2025, 12, 15, 0, 0, 0, 0, time.UTC), want: true},
+		// either day field matches if both are restricted
+		{spec: "0 0 1 * mon", t: time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC), want: true},
+		{spec: "0 0 * *", wantErr: true},
+		{spec: "60 0 * * *", wantErr: true},
+		{spec: "0 0 * * funday", wantErr: true},
+		{spec: "0 5-1 * * *", wantErr: true},
+		{spec: "*/0 0 * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			c, err := parseCron(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && c.matches(tt.t) != tt.want {
+				t.Errorf("matches(%s) = %v, want %v", tt.t, !tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func Test_freezeWindow_active(t *testing.T) {
+	f, err := NewFreeze([]FreezeWindow{{Schedule: "0 18 * * fri", Duration: "63h", TimeZone: "Europe/Moscow"}}, FreezeModeRefuse, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := f.windows[0]
+	// Friday 18:00 in Moscow is 15:00 UTC
+	start := time.Date(2025, 1, 3, 15, 0, 0, 0, time.UTC)
+	for at, want := range map[time.Time]bool{
+		start.Add(-time.Minute):          false,
+		start:                            true,
+		start.Add(63*time.Hour - 1):      true,
+		start.Add(63 * time.Hour):        false,
+		start.Add(7*24*time.Hour + 3600): true,
+	} {
+		if got := w.active(at); got != want {
+			t.Errorf("active(%s) = %v, want %v", at, got, want)
+		}
+	}
+}
+
+func Test_Freeze_hold(t *testing.T) {
+	overrideFile := filepath.Join(t.TempDir(), "override")
+	windows := []FreezeWindow{
+		{Name: "release", Schedule: "* * * * *", Duration: "1m", Zones: []string{"Prod.example.com."}},
+		{Name: "future", Schedule: "0 0 1 1 *", Duration: "1m"},
+	}
+	changes := &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("www.prod.example.com", "A", "1.1.1.1"), endpoint.NewEndpoint("www.dev.example.com", "A", "1.1.1.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("prod.example.com", "A", "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("prod.example.com", "A", "2.2.2.2")},
+	}
+
+	f, err := NewFreeze(windows, FreezeModeRefuse, overrideFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.now = func() time.Time { return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC) }
+	res, refused, err := f.hold(context.Background(), changes)
+	var freezeErr *FreezeError
+	if !errors.As(err, &freezeErr) || freezeErr.Changes != 2 || len(freezeErr.Windows) != 1 || freezeErr.Windows[0] != "release" {
+		t.Fatalf("hold() error = %v, want 2 changes refused by release", err)
+	}
+	if len(res.Create) != 1 || res.Create[0].DNSName != "www.dev.example.com" || len(res.UpdateOld)+len(res.UpdateNew) != 0 {
+		t.Errorf("hold() = %+v, want dev record only", res)
+	}
+	if len(refused.Create) != 1 || len(refused.UpdateOld) != 1 || len(refused.UpdateNew) != 1 {
+		t.Errorf("hold() refused = %+v, want prod records", refused)
+	}
+
+	// emergency override
+	if err = os.WriteFile(overrideFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if res, _, err = f.hold(context.Background(), changes); err != nil || len(res.Create) != 2 || len(res.UpdateNew) != 1 {
+		t.Errorf("hold() with override = %+v, %v, want all changes", res, err)
+	}
+	_ = os.Remove(overrideFile)
+
+	f.mode = FreezeModeQueue
+	if res, refused, err = f.hold(context.Background(), changes); err != nil || len(res.Create) != 1 || refused.HasChanges() {
+		t.Errorf("hold() in queue mode = %+v, %v", res, err)
+	}
+	if len(f.queued.Create) != 1 || len(f.queued.UpdateOld) != 1 || len(f.queued.UpdateNew) != 1 {
+		t.Errorf("queued = %+v", f.queued)
+	}
+}
+
+func Test_Freeze_unreported(t *testing.T) {
+	f, err := NewFreeze([]FreezeWindow{{Name: "release", Schedule: "0 18 * * *", Duration: "2h"}}, FreezeModeRefuse, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 1, 3, 18, 30, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	create := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1", "2.2.2.2")
+	refused := &plan.Changes{Create: []*endpoint.Endpoint{create}}
+
+	if got := f.unreported(refused); len(got.Create) != 1 {
+		t.Errorf("unreported() = %+v, want the first refusal", got)
+	}
+	// the same change planned again during the window, targets order doesn't matter
+	now = now.Add(time.Minute)
+	replanned := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "2.2.2.2", "1.1.1.1")}}
+	if got := f.unreported(replanned); got.HasChanges() {
+		t.Errorf("unreported() of replanned change = %+v, want none", got)
+	}
+	changed := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "3.3.3.3")}}
+	if got := f.unreported(changed); len(got.Create) != 1 {
+		t.Errorf("unreported() of another change = %+v, want it", got)
+	}
+	// changes no longer refused are forgotten
+	if got := f.unreported(refused); len(got.Create) != 1 {
+		t.Errorf("unreported() of forgotten change = %+v, want it", got)
+	}
+	// next occurrence of the window
+	now = now.Add(24 * time.Hour)
+	if got := f.unreported(refused); len(got.Create) != 1 {
+		t.Errorf("unreported() in the next window = %+v, want the refusal", got)
+	}
+}
+
+func Test_dnsProvider_applyQueued(t *testing.T) {
+	var created []string
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com"}}, nil
+		},
+		addZoneRRSet: func(_ context.Context, _, name, _ string, _ []dns.ResourceRecord, _ int, _ ...dns.AddZoneOpt) error {
+			created = append(created, name)
+			return nil
+		},
+	}
+	f, err := NewFreeze([]FreezeWindow{{Schedule: "0 18 * * fri", Duration: "1h"}}, FreezeModeQueue, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 1, 3, 18, 30, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	WithFreeze(f)(p)
+
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")}}
+	if err = p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() during freeze error = %v", err)
+	}
+	p.applyQueued(context.Background())
+	if len(created) != 0 {
+		t.Fatalf("changes applied during freeze: %v", created)
+	}
+
+	now = now.Add(time.Hour)
+	p.applyQueued(context.Background())
+	if len(created) != 1 || created[0] != "www.example.com" {
+		t.Errorf("created after freeze = %v", created)
+	}
+	if f.queued.HasChanges() {
+		t.Errorf("queued after freeze = %+v", f.queued)
+	}
+}
+
+func Test_dnsProvider_ApplyChanges_refused(t *testing.T) {
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com"}}, nil
+		},
+		addZoneRRSet: func(context.Context, string, string, string, []dns.ResourceRecord, int, ...dns.AddZoneOpt) error {
+			return nil
+		},
+	}
+	f, err := NewFreeze([]FreezeWindow{{Name: "release", Schedule: "* * * * *", Duration: "1m", Zones: []string{"prod.example.com"}}}, FreezeModeRefuse, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &sinkMock{}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	WithFreeze(f)(p)
+	WithAuditSink(sink)(p)
+	WithDriftDetection(filepath.Join(t.TempDir(), "drift.json"), DefaultDriftInterval, false)(p)
+
+	dev := endpoint.NewEndpoint("www.dev.example.com", "A", "1.1.1.1")
+	prod := endpoint.NewEndpoint("www.prod.example.com", "A", "1.1.1.1")
+	err = p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{dev, prod}})
+	var freezeErr *FreezeError
+	if !errors.As(err, &freezeErr) {
+		t.Fatalf("ApplyChanges() error = %v, want FreezeError", err)
+	}
+	// changes applied along with refused ones are tracked
+	if _, ok := p.drift.applied[driftKey(dev)]; !ok || len(p.drift.applied) != 1 {
+		t.Errorf("drift applied = %v, want dev record", p.drift.applied)
+	}
+
+	// fully refused plan is audited too
+	if err = p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{prod}}); !errors.As(err, &freezeErr) {
+		t.Fatalf("ApplyChanges() error = %v, want FreezeError", err)
+	}
+	var refused int
+	for _, e := range sink.entries {
+		if e.Name == prod.DNSName {
+			refused++
+			if e.Result != audit.ResultError || e.Zone != "example.com" || e.Account != DefaultAccountAlias {
+				t.Errorf("refused entry = %+v", e)
+			}
+		}
+	}
+	if refused != 2 || len(sink.entries) != 3 {
+		t.Errorf("entries = %+v, want dev and two refused prod entries", sink.entries)
+	}
+}
@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const ENV_RECORDS_UNICODE = "EC_RECORDS_UNICODE"
+
+// WithUnicodeNames makes Records return IDN names and hostname targets in Unicode instead of punycode.
+// It's useful when sources of external-dns produce Unicode hostnames, so the plan matches them.
+func WithUnicodeNames() Option {
+	return func(p *DnsProvider) {
+		p.unicodeNames = true
+	}
+}
+
+// isHostnameTarget reports whether targets of recordType are DNS names
+func isHostnameTarget(recordType string) bool {
+	return recordType == endpoint.RecordTypeCNAME || recordType == endpoint.RecordTypeNS || recordType == RecordTypePTR
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// toASCII converts IDN name to punycode keeping trailing dot, ASCII names are returned as is
+func toASCII(name string) string {
+	if isASCII(name) {
+		return name
+	}
+	ascii, err := idnaProfile.ToASCII(strings.TrimSuffix(name, "."))
+	if err != nil {
+		return name
+	}
+	if strings.HasSuffix(name, ".") {
+		ascii += "."
+	}
+	return ascii
+}
+
+// toUnicode converts punycode labels of name to Unicode
+func toUnicode(name string) string {
+	if !strings.Contains(name, "xn--") {
+		return name
+	}
+	unicode, err := idnaProfile.ToUnicode(name)
+	if err != nil {
+		return name
+	}
+	return unicode
+}
+
+// endpointToASCII returns copy of e with name and hostname targets in punycode, as the API stores them
+func endpointToASCII(e *endpoint.Endpoint) *endpoint.Endpoint {
+	res := *e
+	res.DNSName = toASCII(e.DNSName)
+	if isHostnameTarget(e.RecordType) {
+		res.Targets = make(endpoint.Targets, len(e.Targets))
+		for i, t := range e.Targets {
+			res.Targets[i] = toASCII(t)
+		}
+	}
+	return &res
+}
+
+func endpointsToASCII(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	if endpoints == nil {
+		return nil
+	}
+	res := make([]*endpoint.Endpoint, len(endpoints))
+	for i, e := range endpoints {
+		res[i] = endpointToASCII(e)
+	}
+	return res
+}
+
+// endpointToUnicode converts name and hostname targets of e to Unicode in place
+func endpointToUnicode(e *endpoint.Endpoint) {
+	e.DNSName = toUnicode(e.DNSName)
+	if isHostnameTarget(e.RecordType) {
+		for i, t := range e.Targets {
+			e.Targets[i] = toUnicode(t)
+		}
+	}
+}
+
+// sameName compares DNS names ignoring case, IDN form and trailing dot
+func sameName(a, b string) bool {
+	return a == b || normalizeZone(a) == normalizeZone(b)
+}
+
+// sameTarget compares targets of recordType, TXT content is case sensitive unlike names and addresses
+func sameTarget(recordType, a, b string) bool {
+	if a == b {
+		return true
+	}
+	if recordType == endpoint.RecordTypeTXT {
+		return false
+	}
+	if isHostnameTarget(recordType) {
+		return sameName(a, b)
+	}
+	return strings.EqualFold(a, b)
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_toASCII(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "www.пример.рф", want: "www.xn--e1afmkfd.xn--p1ai"},
+		{name: "Алиас.Пример.РФ.", want: "xn--80aaxl6a.xn--e1afmkfd.xn--p1ai."},
+		{name: "WWW.Example.com", want: "WWW.Example.com"},
+		{name: "_sip._tcp.example.com", want: "_sip._tcp.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toASCII(tt.name); got != tt.want {
+				t.Errorf("toASCII() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_toUnicode(t *testing.T) {
+	if got := toUnicode("www.xn--e1afmkfd.xn--p1ai"); got != "www.пример.рф" {
+		t.Errorf("toUnicode() = %v", got)
+	}
+	if got := toUnicode("www.example.com"); got != "www.example.com" {
+		t.Errorf("toUnicode() = %v", got)
+	}
+}
+
+func Test_sameTarget(t *testing.T) {
+	tests := []struct {
+		recordType string
+		a, b       string
+		want       bool
+	}{
+		{recordType: "CNAME", a: "www.пример.рф", b: "WWW.xn--e1afmkfd.xn--p1ai.", want: true},
+		{recordType: "CNAME", a: "www.example.com", b: "www.example.org", want: false},
+		{recordType: "AAAA", a: "2001:DB8::1", b: "2001:db8::1", want: true},
+		{recordType: "TXT", a: "Hello", b: "hello", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.recordType+" "+tt.a, func(t *testing.T) {
+			if got := sameTarget(tt.recordType, tt.a, tt.b); got != tt.want {
+				t.Errorf("sameTarget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dnsProvider_idn(t *testing.T) {
+	client := &zonesClient{zones: []dns.Zone{{
+		Name: "xn--e1afmkfd.xn--p1ai",
+		Records: []dns.ZoneRecord{
+			{Name: "xn--80aaxl6a.xn--e1afmkfd.xn--p1ai", Type: "CNAME", TTL: 60, ShortAnswers: []string{"www.xn--e1afmkfd.xn--p1ai"}},
+		},
+	}}}
+	p := &DnsProvider{accounts: []*account{newAccount("main", client, nil)}}
+	WithUnicodeNames()(p)
+	ctx := context.Background()
+
+	records, err := p.Records(ctx)
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	want := endpoint.NewEndpointWithTTL("алиас.пример.рф", "CNAME", 60, "www.пример.рф")
+	if len(records) != 1 || records[0].String() != want.String() {
+		t.Fatalf("Records() = %v, want %v", records, want)
+	}
+
+	changes := &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("Почта.Пример.РФ", "A", 60, "1.1.1.1")},
+		UpdateOld: []*endpoint.Endpoint{want},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("АЛИАС.пример.рф", "CNAME", 60, "WWW.ПРИМЕР.РФ")},
+	}
+	if err = p.ApplyChanges(ctx, changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if want := []string{"xn--e1afmkfd.xn--p1ai xn--80a1acny.xn--e1afmkfd.xn--p1ai A"}; !reflect.DeepEqual(client.created, want) {
+		t.Errorf("created = %v, want %v, update differing only in case must be a no-op", client.created, want)
+	}
+	if changes.Create[0].DNSName != "Почта.Пример.РФ" {
+		t.Errorf("ApplyChanges() modified changes of caller")
+	}
+}
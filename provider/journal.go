@@ -0,0 +1,475 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const ENV_ASYNC_JOURNAL_FILE = "EC_ASYNC_JOURNAL_FILE"
+
+// journalEntry is a plan acknowledged by ApplyChanges and not applied yet
+type journalEntry struct {
+	ID         string        `json:"id"`
+	TraceID    string        `json:"traceId,omitempty"`
+	ReceivedAt time.Time     `json:"receivedAt"`
+	Changes    *plan.Changes `json:"changes"`
+	// Applied are keys of changes applied so far, a plan resumed after restart skips them
+	Applied []string `json:"applied,omitempty"`
+}
+
+// journalChangeKey identifies action on RRSet of e within a plan
+func journalChangeKey(action string, e *endpoint.Endpoint) string {
+	return strings.Join([]string{action, normalizeZone(toASCII(e.DNSName)), e.RecordType, e.SetIdentifier}, " ")
+}
+
+// remaining returns changes of the entry which aren't applied yet
+func (e *journalEntry) remaining() *plan.Changes {
+	if len(e.Applied) == 0 {
+		return e.Changes
+	}
+	keys := make(map[string]struct{}, len(e.Applied))
+	for _, k := range e.Applied {
+		keys[k] = struct{}{}
+	}
+	applied := func(action string, ep *endpoint.Endpoint) bool {
+		_, ok := keys[journalChangeKey(action, ep)]
+		return ok
+	}
+	res := &plan.Changes{}
+	for _, c := range e.Changes.Create {
+		if !applied(actionCreate, c) {
+			res.Create = append(res.Create, c)
+		}
+	}
+	for _, c := range e.Changes.UpdateNew {
+		if applied(actionUpdate, c) {
+			continue
+		}
+		res.UpdateNew = append(res.UpdateNew, c)
+		if old := currentRecord(c, e.Changes.UpdateOld); old != nil {
+			res.UpdateOld = append(res.UpdateOld, old)
+		}
+	}
+	for _, c := range e.Changes.Delete {
+		if !applied(actionDelete, c) {
+			res.Delete = append(res.Delete, c)
+		}
+	}
+	return res
+}
+
+// journalState is the persisted form of the journal
+type journalState struct {
+	Seq     uint64          `json:"seq"`
+	Entries []*journalEntry `json:"entries"`
+}
+
+// journalProgress is a line of the progress file, it records a change applied from entry ID
+type journalProgress struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+}
+
+// Journal is a write-ahead log of plans applied in background by WatchJournal. Applied changes are appended
+// to a separate progress file, which is merged into the journal whenever the journal is written.
+type Journal struct {
+	path string
+	now  func() time.Time
+	// wake is signalled when a plan is written to the journal
+	wake chan struct{}
+
+	mu      sync.Mutex
+	seq     uint64
+	entries []*journalEntry
+	// applying is the ID of the entry applied by WatchJournal, it is never superseded
+	applying string
+	// progressFile is opened for appending, nil until a change is applied
+	progressFile *os.File
+}
+
+// OpenJournal reads plans left in the journal file by the previous run, they are applied first by WatchJournal
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{path: path, now: time.Now, wake: make(chan struct{}, 1)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	var state journalState
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode journal %s: %w", path, err)
+	}
+	j.seq, j.entries = state.Seq, state.Entries
+	if err = j.loadProgress(); err != nil {
+		return nil, err
+	}
+	metrics.JournalDepth.Set(float64(len(j.entries)))
+	if len(j.entries) > 0 {
+		log.Logger(context.Background()).Infof("%d journaled plan(s) will be resumed", len(j.entries))
+	}
+	return j, nil
+}
+
+// WithJournal makes ApplyChanges write changes to the journal and return once they are persisted,
+// changes are applied by WatchJournal
+func WithJournal(j *Journal) Option {
+	return func(p *DnsProvider) {
+		p.journal = j
+	}
+}
+
+func (j *Journal) progressPath() string {
+	return j.path + ".progress"
+}
+
+// loadProgress adds keys from the progress file to Applied of entries. A line torn by a crash is skipped,
+// as its change wasn't recorded as applied.
+func (j *Journal) loadProgress() error {
+	b, err := os.ReadFile(j.progressPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read journal progress: %w", err)
+	}
+	byID := make(map[string]*journalEntry, len(j.entries))
+	for _, e := range j.entries {
+		byID[e.ID] = e
+	}
+	for line := range bytes.Lines(b) {
+		var p journalProgress
+		if json.Unmarshal(line, &p) != nil {
+			continue
+		}
+		if e, ok := byID[p.ID]; ok {
+			e.Applied = append(e.Applied, p.Key)
+		}
+	}
+	return nil
+}
+
+// save writes the journal with applied changes of entries, so the progress file is removed
+func (j *Journal) save(entries []*journalEntry) error {
+	b, err := json.Marshal(journalState{Seq: j.seq, Entries: entries})
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(j.path, b); err != nil {
+		return err
+	}
+	if j.progressFile != nil {
+		_ = j.progressFile.Close()
+		j.progressFile = nil
+	}
+	if err = os.Remove(j.progressPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// appendProgress appends p to the progress file and syncs it
+func (j *Journal) appendProgress(p journalProgress) error {
+	if j.progressFile == nil {
+		f, err := os.OpenFile(j.progressPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		j.progressFile = f
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if _, err = j.progressFile.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return j.progressFile.Sync()
+}
+
+// enqueue persists changes to the journal. Waiting plans are superseded by changes, as ExternalDNS plans
+// them again from the same records until they are applied.
+func (j *Journal) enqueue(ctx context.Context, changes *plan.Changes) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]*journalEntry, 0, 2)
+	superseded := 0
+	for _, e := range j.entries {
+		if e.ID == j.applying {
+			entries = append(entries, e)
+			continue
+		}
+		superseded++
+	}
+	j.seq++
+	e := &journalEntry{ID: strconv.FormatUint(j.seq, 10), ReceivedAt: j.now(), Changes: changes}
+	if traceID := ctx.Value(log.TraceIDKey); traceID != nil {
+		e.TraceID = fmt.Sprint(traceID)
+	}
+	entries = append(entries, e)
+	if err := j.save(entries); err != nil {
+		j.seq--
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	j.entries = entries
+
+	metrics.JournalApplies.WithLabelValues(metrics.StatusSuperseded).Add(float64(superseded))
+	metrics.JournalDepth.Set(float64(len(entries)))
+	log.Logger(ctx).WithField("superseded", superseded).Infof("changes are journaled as plan %s", e.ID)
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// next returns the oldest entry and marks it applying, nil if the journal is empty
+func (j *Journal) next() *journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.entries) == 0 {
+		return nil
+	}
+	j.applying = j.entries[0].ID
+	return j.entries[0]
+}
+
+// progress records that change of entry id is applied, so it isn't applied again if the plan is resumed
+func (j *Journal) progress(ctx context.Context, id, key string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range j.entries {
+		if e.ID != id {
+			continue
+		}
+		e.Applied = append(e.Applied, key)
+		if err := j.appendProgress(journalProgress{ID: id, Key: key}); err != nil {
+			log.Logger(ctx).WithField(log.ErrorKey, err).Error("failed to write journal, applied change will be applied again after restart")
+		}
+		return
+	}
+}
+
+// finish removes applied entry from the journal, it is kept to be resumed after restart if done is false
+func (j *Journal) finish(ctx context.Context, id string, done bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.applying = ""
+	if !done {
+		return
+	}
+	entries := make([]*journalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		if e.ID != id {
+			entries = append(entries, e)
+		}
+	}
+	j.entries = entries
+	metrics.JournalDepth.Set(float64(len(entries)))
+	if err := j.save(entries); err != nil {
+		log.Logger(ctx).WithField(log.ErrorKey, err).Error("failed to write journal, applied plan will be applied again after restart")
+	}
+}
+
+// WatchJournal applies journaled plans one by one until ctx is done, it does nothing without WithJournal.
+// Plan interrupted by ctx or a crash stays in the journal and its changes not applied yet are applied after restart.
+func (p *DnsProvider) WatchJournal(ctx context.Context) {
+	j := p.journal
+	if j == nil {
+		return
+	}
+	for {
+		e := j.next()
+		if e == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-j.wake:
+				continue
+			}
+		}
+
+		applyCtx := log.Trace(ctx)
+		if e.TraceID != "" {
+			applyCtx = context.WithValue(ctx, log.TraceIDKey, e.TraceID)
+		}
+		logger := log.Logger(applyCtx).WithField("plan", e.ID)
+		logger.Info("applying journaled plan")
+		j.mu.Lock()
+		changes := e.remaining()
+		j.mu.Unlock()
+		results := &changeResults{applied: func(action string, ep *endpoint.Endpoint) {
+			j.progress(applyCtx, e.ID, journalChangeKey(action, ep))
+		}}
+		err := p.applyTracked(applyCtx, p.reconcileChanges(applyCtx, changes), results)
+		if ctx.Err() != nil {
+			logger.Warning("applying journaled plan is interrupted, it will be resumed after restart")
+			j.finish(ctx, e.ID, false)
+			return
+		}
+
+		status := metrics.StatusOK
+		if err != nil {
+			status = metrics.StatusError
+			logger.WithField(log.ErrorKey, err).Error("failed to apply journaled plan")
+		}
+		metrics.JournalApplies.WithLabelValues(status).Inc()
+		metrics.JournalApplyLag.Observe(j.now().Sub(e.ReceivedAt).Seconds())
+		j.finish(applyCtx, e.ID, true)
+	}
+}
+
+// reconcileChanges drops or trims changes which the current RRSets already reflect. While a plan is applied
+// ExternalDNS plans again from records which don't show it yet, so the next plan replays its creates and deletes,
+// and a resumed plan may have changes applied right before a crash. Changes whose RRSets can't be read are kept.
+func (p *DnsProvider) reconcileChanges(ctx context.Context, changes *plan.Changes) *plan.Changes {
+	changes = &plan.Changes{
+		Create:    endpointsToASCII(changes.Create),
+		UpdateOld: endpointsToASCII(changes.UpdateOld),
+		UpdateNew: endpointsToASCII(changes.UpdateNew),
+		Delete:    endpointsToASCII(changes.Delete),
+	}
+	current := p.currentTargets(ctx, slices.Concat(changes.Create, changes.UpdateNew, changes.Delete))
+	logger := log.Logger(ctx)
+
+	res := &plan.Changes{}
+	for _, e := range changes.Create {
+		c, ok := current[driftKey(e)]
+		if !ok || !c.found {
+			res.Create = append(res.Create, e)
+			continue
+		}
+		missing := findMissing(e.RecordType, e.Targets, c.targets)
+		if len(missing) == 0 {
+			logger.WithField(log.DNSNameKey, e.DNSName).Debugf("create %s is already applied", e.RecordType)
+			continue
+		}
+		e = e.DeepCopy()
+		e.Targets = missing
+		res.Create = append(res.Create, e)
+	}
+	for _, e := range changes.UpdateNew {
+		old := currentRecord(e, changes.UpdateOld)
+		c, ok := current[driftKey(e)]
+		switch {
+		case !ok || old == nil:
+			res.UpdateNew = append(res.UpdateNew, e)
+			if old != nil {
+				res.UpdateOld = append(res.UpdateOld, old)
+			}
+		case !c.found:
+			logger.WithField(log.DNSNameKey, e.DNSName).Debugf("update %s of missing rrset is applied as create", e.RecordType)
+			res.Create = append(res.Create, e)
+		default:
+			// targets are diffed against the RRSet as it is
+			old = old.DeepCopy()
+			old.Targets = c.targets
+			res.UpdateOld = append(res.UpdateOld, old)
+			res.UpdateNew = append(res.UpdateNew, e)
+		}
+	}
+	for _, e := range changes.Delete {
+		c, ok := current[driftKey(e)]
+		if !ok {
+			res.Delete = append(res.Delete, e)
+			continue
+		}
+		present := findPresent(e.RecordType, e.Targets, c.targets)
+		if len(present) == 0 {
+			logger.WithField(log.DNSNameKey, e.DNSName).Debugf("delete %s is already applied", e.RecordType)
+			continue
+		}
+		e = e.DeepCopy()
+		e.Targets = present
+		res.Delete = append(res.Delete, e)
+	}
+	return res
+}
+
+// rrsetTargets are targets of a SetIdentifier in RRSet, found is false if RRSet doesn't exist
+type rrsetTargets struct {
+	targets endpoint.Targets
+	found   bool
+}
+
+// currentTargets reads targets of endpoints from their RRSets. Endpoints without zone or whose RRSet
+// can't be read are left out.
+func (p *DnsProvider) currentTargets(ctx context.Context, endpoints []*endpoint.Endpoint) map[rrsetKey]rrsetTargets {
+	zones := p.zoneIndex(ctx)
+	res := make(map[rrsetKey]rrsetTargets)
+	var mu sync.Mutex
+
+	gr, grCtx := errgroup.WithContext(ctx)
+	gr.SetLimit(rrsetFetchConcurrency)
+	for _, e := range endpoints {
+		zone, acc, reason := zones.lookup(e.DNSName, e.RecordType)
+		if reason != "" {
+			continue
+		}
+		gr.Go(func() error {
+			var c rrsetTargets
+			set, err := acc.client.RRSet(grCtx, zone, e.DNSName, e.RecordType)
+			switch apiErr := new(dns.APIError); {
+			case err == nil:
+				c.found = true
+				for _, rr := range set.Records {
+					if recordSetIdentifier(rr) == e.SetIdentifier {
+						c.targets = append(c.targets, formatAnswer(e.RecordType, rr.ContentToString()))
+					}
+				}
+			case errors.As(err, apiErr) && apiErr.StatusCode == http.StatusNotFound:
+			default:
+				log.Logger(ctx).WithField(log.DNSNameKey, e.DNSName).WithField(log.ErrorKey, err).
+					Warningf("failed to get %s rrset, the change is applied as planned", e.RecordType)
+				return nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			res[driftKey(e)] = c
+			return nil
+		})
+	}
+	_ = gr.Wait()
+	return res
+}
+
+// findMissing returns targets which current doesn't contain
+func findMissing(recordType string, targets, current endpoint.Targets) endpoint.Targets {
+	var res endpoint.Targets
+	for _, t := range targets {
+		if !containsTarget(recordType, current, t) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// findPresent returns targets which current contains
+func findPresent(recordType string, targets, current endpoint.Targets) endpoint.Targets {
+	var res endpoint.Targets
+	for _, t := range targets {
+		if containsTarget(recordType, current, t) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
@@ -0,0 +1,232 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_Journal_enqueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("a.example.com", "A", "1.1.1.1")}}
+	second := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("b.example.com", "A", "1.1.1.1")}}
+	third := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("c.example.com", "A", "1.1.1.1")}}
+
+	if err = j.enqueue(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	// first is being applied, second is superseded by third
+	if e := j.next(); e == nil || e.ID != "1" {
+		t.Fatalf("next() = %+v, want plan 1", e)
+	}
+	for _, changes := range []*plan.Changes{second, third} {
+		if err = j.enqueue(context.Background(), changes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(j.entries) != 2 || j.entries[0].ID != "1" || j.entries[1].ID != "3" {
+		t.Fatalf("entries = %+v, want plans 1 and 3", j.entries)
+	}
+
+	// interrupted plan is resumed after restart
+	j.finish(context.Background(), "1", false)
+	if j, err = OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	if e := j.next(); e == nil || e.ID != "1" || e.Changes.Create[0].DNSName != "a.example.com" {
+		t.Fatalf("next() after restart = %+v, want plan 1", e)
+	}
+	j.finish(context.Background(), "1", true)
+	if e := j.next(); e == nil || e.ID != "3" {
+		t.Fatalf("next() = %+v, want plan 3", e)
+	}
+	j.finish(context.Background(), "3", true)
+	if j, err = OpenJournal(path); err != nil || j.next() != nil || j.seq != 3 {
+		t.Errorf("journal after apply = %+v, %v, want empty", j, err)
+	}
+}
+
+func Test_dnsProvider_WatchJournal(t *testing.T) {
+	var mu sync.Mutex
+	var created []string
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com"}}, nil
+		},
+		addZoneRRSet: func(_ context.Context, _, name, _ string, _ []dns.ResourceRecord, _ int, _ ...dns.AddZoneOpt) error {
+			mu.Lock()
+			defer mu.Unlock()
+			created = append(created, name)
+			return nil
+		},
+	}
+	j, err := OpenJournal(filepath.Join(t.TempDir(), "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	WithJournal(j)(p)
+
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")}}
+	if err = p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if len(created) != 0 {
+		t.Fatalf("changes applied before WatchJournal: %v", created)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.WatchJournal(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(created)
+		mu.Unlock()
+		j.mu.Lock()
+		depth := len(j.entries)
+		j.mu.Unlock()
+		if n == 1 && depth == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("journaled plan isn't applied, created = %v, depth = %d", created, depth)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_Journal_progress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	www := endpoint.NewEndpoint("www.example.com", "A", "2.2.2.2")
+	changes := &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("a.example.com", "A", "1.1.1.1"), endpoint.NewEndpoint("b.example.com", "A", "1.1.1.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{www},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("old.example.com", "A", "1.1.1.1")},
+	}
+	if err = j.enqueue(context.Background(), changes); err != nil {
+		t.Fatal(err)
+	}
+	e := j.next()
+	j.progress(context.Background(), e.ID, journalChangeKey(actionCreate, changes.Create[0]))
+	j.progress(context.Background(), e.ID, journalChangeKey(actionUpdate, www))
+
+	// progress is appended to the progress file, the journal isn't rewritten
+	if b, _ := os.ReadFile(path); strings.Contains(string(b), "applied") {
+		t.Errorf("journal = %s, want it without applied changes", b)
+	}
+	// a line torn by a crash
+	f, err := os.OpenFile(j.progressPath(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"id":"1","key":"delete old`)
+	_ = f.Close()
+
+	// crash, only changes not applied yet are resumed
+	if j, err = OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	want := func(j *Journal) {
+		t.Helper()
+		got := j.next().remaining()
+		if len(got.Create) != 1 || got.Create[0].DNSName != "b.example.com" || len(got.UpdateOld)+len(got.UpdateNew) != 0 || len(got.Delete) != 1 {
+			t.Errorf("remaining() = %+v, want create of b and delete", got)
+		}
+	}
+	want(j)
+
+	// writing the journal merges the progress into it
+	if err = j.enqueue(context.Background(), &plan.Changes{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(j.progressPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("progress file after journal write: %v, want removed", err)
+	}
+	if j, err = OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	want(j)
+}
+
+func Test_dnsProvider_reconcileChanges(t *testing.T) {
+	rrsets := map[string][]string{
+		"partial.example.com": {"1.1.1.1"},
+		"done.example.com":    {"1.1.1.1"},
+		"del.example.com":     {"1.1.1.1"},
+		"upd.example.com":     {"2.2.2.2"},
+	}
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com"}}, nil
+		},
+		rrSet: func(_ context.Context, _, name, _ string) (dns.RRSet, error) {
+			contents, ok := rrsets[name]
+			if !ok {
+				return dns.RRSet{}, dns.APIError{StatusCode: http.StatusNotFound, Message: "rrset not found"}
+			}
+			set := dns.RRSet{TTL: 60}
+			for _, c := range contents {
+				set.Records = append(set.Records, identifierRecord(c, "", true))
+			}
+			return set, nil
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+
+	got := p.reconcileChanges(context.Background(), &plan.Changes{
+		// replayed creates
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("partial.example.com", "A", "1.1.1.1", "2.2.2.2"),
+			endpoint.NewEndpoint("done.example.com", "A", "1.1.1.1"),
+			endpoint.NewEndpoint("new.example.com", "A", "1.1.1.1"),
+		},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("upd.example.com", "A", "1.1.1.1"), endpoint.NewEndpoint("missing.example.com", "A", "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("upd.example.com", "A", "3.3.3.3"), endpoint.NewEndpoint("missing.example.com", "A", "2.2.2.2")},
+		// replayed deletes
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("del.example.com", "A", "1.1.1.1", "2.2.2.2"),
+			endpoint.NewEndpoint("gone.example.com", "A", "1.1.1.1"),
+		},
+	})
+
+	targets := func(endpoints []*endpoint.Endpoint) []string {
+		var res []string
+		for _, e := range endpoints {
+			res = append(res, e.DNSName+" "+strings.Join(e.Targets, ","))
+		}
+		return res
+	}
+	if want := []string{"partial.example.com 2.2.2.2", "new.example.com 1.1.1.1", "missing.example.com 2.2.2.2"}; !reflect.DeepEqual(targets(got.Create), want) {
+		t.Errorf("create = %v, want %v", targets(got.Create), want)
+	}
+	if want := []string{"upd.example.com 2.2.2.2"}; !reflect.DeepEqual(targets(got.UpdateOld), want) {
+		t.Errorf("update old = %v, want %v", targets(got.UpdateOld), want)
+	}
+	if want := []string{"upd.example.com 3.3.3.3"}; !reflect.DeepEqual(targets(got.UpdateNew), want) {
+		t.Errorf("update new = %v, want %v", targets(got.UpdateNew), want)
+	}
+	if want := []string{"del.example.com 1.1.1.1"}; !reflect.DeepEqual(targets(got.Delete), want) {
+		t.Errorf("delete = %v, want %v", targets(got.Delete), want)
+	}
+}
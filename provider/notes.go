@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"strings"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	ENV_RECORD_NOTES = "EC_RECORD_NOTES"
+	ENV_CLUSTER_NAME = "EC_CLUSTER_NAME"
+)
+
+// metaNotes is a key of free-form notes in meta of a resource record
+const metaNotes = "notes"
+
+// provenanceNotePrefix starts notes describing where a record comes from
+const provenanceNotePrefix = "managed by external-dns"
+
+// provenanceNotes describe created records for people looking at them in the control panel
+type provenanceNotes struct {
+	cluster string
+}
+
+// WithProvenanceNotes makes the provider write a note with cluster name, owner and resource
+// from labels of endpoint to meta of every record it adds. Notes of existing records are kept as is.
+func WithProvenanceNotes(cluster string) Option {
+	return func(p *DnsProvider) {
+		p.provenance = &provenanceNotes{cluster: cluster}
+	}
+}
+
+// note returns e.g. "managed by external-dns, cluster prod, owner default, resource service/web/web"
+func (pn *provenanceNotes) note(e *endpoint.Endpoint) string {
+	parts := []string{provenanceNotePrefix}
+	if pn.cluster != "" {
+		parts = append(parts, "cluster "+pn.cluster)
+	}
+	if owner := e.Labels[endpoint.OwnerLabelKey]; owner != "" {
+		parts = append(parts, "owner "+owner)
+	}
+	if resource := e.Labels[endpoint.ResourceLabelKey]; resource != "" {
+		parts = append(parts, "resource "+resource)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// annotate adds provenance note of e to records which are about to be added
+func (pn *provenanceNotes) annotate(e *endpoint.Endpoint, records []dns.ResourceRecord) {
+	if pn == nil {
+		return
+	}
+	note := pn.note(e)
+	for i := range records {
+		setRecordNotes(&records[i], replaceNote(recordNotes(records[i]), isProvenanceNote, note))
+	}
+}
+
+func isProvenanceNote(note string) bool {
+	return strings.HasPrefix(note, provenanceNotePrefix)
+}
+
+// recordNotes returns notes from meta of rr, they are []any after decoding API response
+func recordNotes(rr dns.ResourceRecord) []string {
+	switch v := rr.Meta[metaNotes].(type) {
+	case []string:
+		return v
+	case string:
+		return []string{v}
+	case []any:
+		res := make([]string, 0, len(v))
+		for _, n := range v {
+			if s, ok := n.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// setRecordNotes replaces notes in meta of rr, empty notes are removed from meta
+func setRecordNotes(rr *dns.ResourceRecord, notes []string) {
+	if len(notes) == 0 {
+		delete(rr.Meta, metaNotes)
+		return
+	}
+	rr.AddMeta(dns.NewResourceMetaNotes(notes...))
+}
+
+// replaceNote returns notes with notes matching isOld replaced by note, empty note only removes them
+func replaceNote(notes []string, isOld func(string) bool, note string) []string {
+	res := make([]string, 0, len(notes)+1)
+	for _, n := range notes {
+		if !isOld(n) {
+			res = append(res, n)
+		}
+	}
+	if note != "" {
+		res = append(res, note)
+	}
+	return res
+}
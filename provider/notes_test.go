@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func Test_provenanceNotes_note(t *testing.T) {
+	e := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")
+	e.Labels[endpoint.OwnerLabelKey] = "default"
+	e.Labels[endpoint.ResourceLabelKey] = "service/web/web"
+
+	if got := (&provenanceNotes{cluster: "prod"}).note(e); got != "managed by external-dns, cluster prod, owner default, resource service/web/web" {
+		t.Errorf("note() = %q", got)
+	}
+	if got := (&provenanceNotes{}).note(endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")); got != "managed by external-dns" {
+		t.Errorf("note() without labels = %q", got)
+	}
+}
+
+func Test_provenanceNotes_annotate(t *testing.T) {
+	e := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")
+	records := []dns.ResourceRecord{{Content: []any{"1.1.1.1"}}}
+
+	var disabled *provenanceNotes
+	disabled.annotate(e, records)
+	if records[0].Meta != nil {
+		t.Fatalf("annotate() of disabled notes = %v", records[0].Meta)
+	}
+
+	(&provenanceNotes{cluster: "prod"}).annotate(e, records)
+	if got := recordNotes(records[0]); !reflect.DeepEqual(got, []string{"managed by external-dns, cluster prod"}) {
+		t.Errorf("annotate() notes = %v", got)
+	}
+}
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/notify"
+)
+
+const ENV_NOTIFY_TARGETS_FILE = "EC_NOTIFY_TARGETS_FILE"
+
+// WithNotifier makes ApplyChanges send summary of applied changes to notification targets
+func WithNotifier(n *notify.Notifier) Option {
+	return func(p *DnsProvider) {
+		p.notifier = n
+	}
+}
+
+// notifyApplied sends summary of entries and skipped changes of ApplyChanges finished with err
+func (p *DnsProvider) notifyApplied(ctx context.Context, entries *auditEntries, skipped *skippedChanges, err error) {
+	if p.notifier == nil {
+		return
+	}
+	changes := make([]notify.Change, 0, len(entries.entries))
+	for _, e := range entries.entries {
+		c := notify.Change{Action: e.Action, Zone: e.Zone, Name: e.Name, Type: e.Type, SetIdentifier: e.SetIdentifier, Targets: e.NewTargets, Error: e.Error}
+		if e.Action == actionDelete {
+			c.Targets = e.OldTargets
+		}
+		changes = append(changes, c)
+	}
+	skippedChanges := make([]notify.Change, 0, len(skipped.changes))
+	for _, c := range skipped.changes {
+		skippedChanges = append(skippedChanges, notify.Change{Action: c.Action, Name: c.DNSName, Type: c.RecordType, Error: c.Reason})
+	}
+
+	s := notify.NewSummary(changes, skippedChanges, err)
+	s.DryRun = p.dryRun
+	if traceID := ctx.Value(log.TraceIDKey); traceID != nil {
+		s.TraceID = fmt.Sprint(traceID)
+	}
+	p.notifier.Notify(ctx, s)
+}
+
+// WaitNotifications waits for summaries being delivered, deliveries left when ctx is done are canceled
+func (p *DnsProvider) WaitNotifications(ctx context.Context) error {
+	if p.notifier == nil {
+		return nil
+	}
+	return p.notifier.Wait(ctx)
+}
@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/notify"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_dnsProvider_ApplyChanges_notify(t *testing.T) {
+	var got notify.Summary
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+	n, err := notify.NewNotifier([]notify.Target{{URL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com"}}, nil
+		},
+		addZoneRRSet: func(context.Context, string, string, string, []dns.ResourceRecord, int, ...dns.AddZoneOpt) error {
+			return nil
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	WithNotifier(n)(p)
+
+	err = p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1"),
+		endpoint.NewEndpoint("www.other.com", "A", "1.1.1.1"),
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if err = n.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if got.Created != 1 || got.Severity != notify.SeverityWarning || len(got.Skipped) != 1 || got.Skipped[0].Error != skipReasonNoZone {
+		t.Errorf("summary = %+v", got)
+	}
+	if len(got.Zones) != 1 || got.Zones[0].Zone != "example.com" || got.Zones[0].Changes[0].Targets[0] != "1.1.1.1" {
+		t.Errorf("zones = %+v", got.Zones)
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
-	"strings"
+	"sync/atomic"
+	"time"
 
 	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/audit"
 	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/notify"
 	"golang.org/x/sync/errgroup"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
@@ -29,33 +33,94 @@ type DnsClient interface {
 		values []dns.ResourceRecord, ttl int, opts ...dns.AddZoneOpt) error
 	ZonesWithRecords(ctx context.Context, filters ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error)
 	DeleteRRSetRecord(ctx context.Context, zone, name, recordType string, contents ...string) error
+	DeleteRRSet(ctx context.Context, zone, name, recordType string) error
+	CreateZone(ctx context.Context, name string) (uint64, error)
+	RRSet(ctx context.Context, zone, name, recordType string) (dns.RRSet, error)
+	UpdateRRSet(ctx context.Context, zone, name, recordType string, record dns.RRSet) error
 }
 
 type DnsProvider struct {
 	provider.BaseProvider
-	client DnsClient
-	dryRun bool
+	accounts     []*account
+	tokenFiles   []*tokenFile
+	zoneCreation *zoneCreation
+	registry     *metaRegistry
+	provenance   *provenanceNotes
+	drift        *driftDetector
+	audit        audit.Sink
+	notifier     *notify.Notifier
+	freeze       *Freeze
+	approvals    *approvalQueue
+	journal      *Journal
+	// rrsetCacheMaxAge is how long Records reuses fetched RRSets
+	rrsetCacheMaxAge time.Duration
+	index            atomic.Pointer[zoneIndex]
+	snapshot         atomic.Pointer[rrsetSnapshot]
+	locks            rrsetLocks
+	disabledPolicy   DisabledPolicy
+	skipPolicy       SkipPolicy
+	unicodeNames     bool
+	reverseRecords   bool
+	dryRun           bool
 }
 
-func NewProvider(apiUrl, apiToken string, dryRun bool) (p *DnsProvider, err error) {
-	log.Logger(context.Background()).Infof("init %s provider for %s", ProviderName, apiUrl)
+// Option configures optional DnsProvider behaviour
+type Option func(*DnsProvider)
 
+// NewProvider creates provider managing all zones of a single account
+func NewProvider(apiUrl, apiToken string, dryRun bool, opts ...Option) (*DnsProvider, error) {
 	if apiToken == "" {
 		return nil, errors.New("empty API token, check env var " + ENV_API_TOKEN)
 	}
+	return NewMultiAccountProvider(apiUrl, []Account{{Alias: DefaultAccountAlias, Token: apiToken}}, dryRun, opts...)
+}
+
+// NewMultiAccountProvider creates provider with a client per account,
+// changes are routed to the account serving the zone of a record
+func NewMultiAccountProvider(apiUrl string, accounts []Account, dryRun bool, opts ...Option) (*DnsProvider, error) {
+	log.Logger(context.Background()).Infof("init %s provider for %s with %d account(s)", ProviderName, apiUrl, len(accounts))
 
-	client := dns.NewClient(dns.PermanentAPIKeyAuth(apiToken))
+	if len(accounts) == 0 {
+		return nil, errors.New("no accounts configured")
+	}
+
+	var baseURL *url.URL
 	if apiUrl != "" {
-		client.BaseURL, err = url.Parse(apiUrl)
+		var err error
+		baseURL, err = url.Parse(apiUrl)
 		if err != nil {
 			return nil, fmt.Errorf("can't parse API URL '%s'", apiUrl)
 		}
 	}
 
-	return &DnsProvider{
-		client: client,
-		dryRun: dryRun,
-	}, nil
+	p := &DnsProvider{dryRun: dryRun, skipPolicy: SkipPolicyWarn, disabledPolicy: DisabledPolicyKeep, rrsetCacheMaxAge: DefaultRRSetCacheMaxAge}
+	aliases := make(map[string]bool, len(accounts))
+	for _, a := range accounts {
+		scheme, token, err := a.validate()
+		if err != nil {
+			return nil, err
+		}
+		if aliases[a.Alias] {
+			return nil, fmt.Errorf("duplicate account alias %s", a.Alias)
+		}
+		aliases[a.Alias] = true
+
+		client, rotator := newClient(scheme, token)
+		if baseURL != nil {
+			u := *baseURL
+			client.BaseURL = &u
+		}
+		p.accounts = append(p.accounts, newAccount(a.Alias, client, a.Zones))
+		if a.TokenFile != "" {
+			f := &tokenFile{alias: a.Alias, path: a.TokenFile, rotator: rotator}
+			f.stamp, _ = fileStamp(a.TokenFile)
+			p.tokenFiles = append(p.tokenFiles, f)
+		}
+	}
+	for _, op := range opts {
+		op(p)
+	}
+	return p, nil
 }
 
 func (p *DnsProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
@@ -63,17 +128,30 @@ func (p *DnsProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error)
 	logger.Info("starting to get records")
 	defer logger.Info("finished getting records")
 
-	filters := p.GetDomainFilter(ctx).Filters
-	logger = log.Logger(ctx).WithField("filters", filters)
-
 	// todo mb add context with timeout
 
-	zones, err := p.client.ZonesWithRecords(ctx, func(zone *dns.ZonesFilter) {
-		zone.Names = filters
-	})
+	result, zones, snapshot, err := p.records(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get zones with records: %s", err)
+		return nil, err
 	}
+	p.index.Store(newZoneIndex(zones))
+	p.snapshot.Store(snapshot)
+	return result, nil
+}
+
+// records reads endpoints of all accounts with zones and RRSets they are built from. Unlike Records
+// it leaves the zone index and the snapshot ApplyChanges relies on untouched, so it's safe for background checks.
+func (p *DnsProvider) records(ctx context.Context) ([]*endpoint.Endpoint, []accountZone, *rrsetSnapshot, error) {
+	logger := log.Logger(ctx)
+	zones, err := p.accountZones(ctx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get zones with records: %w", err)
+	}
+	rrsets, err := p.fetchRRSets(ctx, zones)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	snapshot := newRRSetSnapshot(rrsets)
 
 	recordCountByZone := make(map[string]int)
 	result := make([]*endpoint.Endpoint, 0)
@@ -81,10 +159,23 @@ func (p *DnsProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error)
 	for _, zone := range zones {
 		recordCountByZone[zone.Name]++
 		for _, r := range zone.Records {
-			if provider.SupportedRecordType(r.Type) {
-				result = append(result,
-					endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), r.ShortAnswers...))
+			if !supportedRecordType(r.Type) {
+				continue
+			}
+			for _, e := range recordEndpoints(r, rrsets[newRRSetKey(r.Name, r.Type)], snapshot.disabled) {
+				if p.unicodeNames {
+					endpointToUnicode(e)
+				}
+				result = append(result, e)
+			}
+		}
+	}
+	if p.registry != nil {
+		for _, e := range p.registry.registryRecords(zones, rrsets) {
+			if p.unicodeNames {
+				endpointToUnicode(e)
 			}
+			result = append(result, e)
 		}
 	}
 
@@ -93,40 +184,104 @@ func (p *DnsProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error)
 		WithField("result", result).
 		Debugf("found %d zones, %d records in result", len(recordCountByZone), len(result))
 
-	return result, nil
+	return result, zones, snapshot, nil
 }
 
 const changesApplicationStepsNumber = 3
 
-// todo mb add context with timeout
+// ApplyChanges applies changes, with WithJournal it only writes them to the journal for WatchJournal
 func (p *DnsProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
 	if !changes.HasChanges() {
 		return nil
 	}
+	if p.journal != nil {
+		return p.journal.enqueue(ctx, changes)
+	}
+	return p.applyChanges(ctx, changes)
+}
+
+// applyChanges applies changes right away, bypassing the journal
+func (p *DnsProvider) applyChanges(ctx context.Context, changes *plan.Changes) error {
+	return p.applyTracked(ctx, changes, &changeResults{})
+}
+
+// todo mb add context with timeout
+
+// applyTracked applies changes reporting result of every change to results
+func (p *DnsProvider) applyTracked(ctx context.Context, changes *plan.Changes, results *changeResults) error {
+	if !changes.HasChanges() {
+		return nil
+	}
 
 	logger := log.Logger(ctx)
 	logger.Info("starting to apply changes")
 	defer logger.Info("finished applying changes")
 
-	getZoneFunc := p.zoneFromDNSNameGetter(ctx)
+	// API stores IDN names in punycode
+	changes = &plan.Changes{
+		Create:    endpointsToASCII(changes.Create),
+		UpdateOld: endpointsToASCII(changes.UpdateOld),
+		UpdateNew: endpointsToASCII(changes.UpdateNew),
+		Delete:    endpointsToASCII(changes.Delete),
+	}
+
+	changes, refused, frozenErr := p.freeze.hold(ctx, changes)
+	changes, approved := p.approvals.hold(ctx, changes)
+	if !changes.HasChanges() {
+		if refused.HasChanges() && (p.audit != nil || p.notifier != nil) {
+			entries := &auditEntries{}
+			if p.auditRefused(ctx, entries, p.zoneIndex(ctx), refused, frozenErr) {
+				p.notifyApplied(ctx, entries, &skippedChanges{}, frozenErr)
+			}
+		}
+		return frozenErr
+	}
+
+	var registryOps []registryOp
+	if p.registry != nil {
+		changes, registryOps = p.registry.split(changes)
+	}
+	p.drift.begin()
+	applied := changes
+
+	zones := p.zoneIndex(ctx)
+	var createZonesErr error
+	if p.zoneCreation != nil {
+		toCreate := append(append([]*endpoint.Endpoint{}, changes.Create...), changes.UpdateNew...)
+		zones, createZonesErr = p.createMissingZones(ctx, toCreate, zones)
+	}
+	if p.reverseRecords {
+		changes = withReverseChanges(changes, zones)
+	}
 	appliedChanges := struct {
 		created int
 		updated int
 		deleted int
 	}{}
 
+	skipped := &skippedChanges{}
+	entries := &auditEntries{}
+	notifiedErr := frozenErr
+	if !p.auditRefused(ctx, entries, zones, refused, frozenErr) {
+		notifiedErr = nil
+	}
+
 	var updateGr *errgroup.Group
-	appliedChanges.updated, updateGr = p.handleUpdateChanges(ctx, changes, getZoneFunc)
+	appliedChanges.updated, updateGr = p.handleUpdateChanges(ctx, changes, zones, skipped, results, entries)
 
 	var deleteGr *errgroup.Group
-	appliedChanges.deleted, deleteGr = p.handleDeleteChanges(ctx, changes, getZoneFunc)
+	appliedChanges.deleted, deleteGr = p.handleDeleteChanges(ctx, changes, zones, skipped, results, entries)
 
 	var createGr *errgroup.Group
-	appliedChanges.created, createGr = p.handleCreateChanges(ctx, changes, getZoneFunc)
+	appliedChanges.created, createGr = p.handleCreateChanges(ctx, changes, zones, skipped, results, entries)
 
 	logger = logger.WithField("to_apply", appliedChanges)
 
-	errs := make([]error, 0, changesApplicationStepsNumber)
+	// refused changes aren't counted as failed, so changes applied along with them are tracked and approved
+	errs := make([]error, 0, changesApplicationStepsNumber+2)
+	if createZonesErr != nil {
+		errs = append(errs, createZonesErr)
+	}
 	err := updateGr.Wait()
 	if err != nil {
 		logger.WithField(log.ErrorKey, err).Error("failed to commit update changes")
@@ -148,10 +303,24 @@ func (p *DnsProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) e
 	} else {
 		logger.Info("create changes commited")
 	}
-	if len(errs) > 0 {
-		return errors.Join(errs...)
+	if len(registryOps) > 0 {
+		// ownership is written after owned records are created
+		if err = p.applyRegistry(ctx, zones, registryOps); err != nil {
+			logger.WithField(log.ErrorKey, err).Error("failed to commit ownership changes")
+			errs = append(errs, err)
+		} else {
+			logger.Info("ownership changes commited")
+		}
 	}
-	return nil
+	if err = skipped.err(p.skipPolicy); err != nil {
+		logger.WithField(log.ErrorKey, err).Error("changes skipped")
+		errs = append(errs, err)
+	}
+	err = errors.Join(errs...)
+	p.drift.end(ctx, applied, skipped, results, p.dryRun)
+	p.approvals.done(ctx, approved, err == nil && !p.dryRun)
+	p.notifyApplied(ctx, entries, skipped, errors.Join(notifiedErr, err))
+	return errors.Join(frozenErr, err)
 }
 
 func (p *DnsProvider) GetDomainFilter(ctx context.Context) *endpoint.DomainFilter {
@@ -159,10 +328,12 @@ func (p *DnsProvider) GetDomainFilter(ctx context.Context) *endpoint.DomainFilte
 	logger.Info("start GetDomainFilter")
 	defer logger.Info("finish GetDomainFilter")
 
-	zones, err := p.client.ZonesWithRecords(ctx)
+	zones, err := p.accountZones(ctx)
 	if err != nil {
 		logger.Errorf("failed to get zones with records: %s", err)
-		return &endpoint.DomainFilter{}
+		if len(zones) == 0 {
+			return &endpoint.DomainFilter{}
+		}
 	}
 
 	domains := make([]string, 0)
@@ -172,41 +343,35 @@ func (p *DnsProvider) GetDomainFilter(ctx context.Context) *endpoint.DomainFilte
 	return endpoint.NewDomainFilter(domains)
 }
 
-// todo figure out wtf is this func
+// AdjustEndpoints drops TXT records. Desired records with targets the API can't store are returned unchanged:
+// dropping them would make the plan delete the current record, so instead their changes are skipped
+// on apply and one bad annotation doesn't fail the whole plan. Unless disabled targets may be enabled,
+// desired records get disabled targets of current records, so the plan keeps them as is.
+// Routing properties are normalized the way Records returns them.
 func (p *DnsProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	snapshot := p.snapshot.Load()
 	adjusted := make([]*endpoint.Endpoint, 0, len(endpoints))
 	for _, e := range endpoints {
-		if e.RecordType != "TXT" {
+		if e.RecordType == endpoint.RecordTypeTXT {
+			continue
+		}
+		if err := validateEndpoint(endpointToASCII(e)); err != nil {
 			adjusted = append(adjusted, e)
+			continue
 		}
-	}
-	return adjusted, nil
-}
-
-func (p *DnsProvider) zoneFromDNSNameGetter(ctx context.Context) func(name string) (zone string) {
-	existingZones := p.GetDomainFilter(ctx)
-	search := make(map[string]string)
-	for _, zone := range existingZones.Filters {
-		search[zone] = strings.Trim(zone, ".")
-	}
-	return func(name string) (zone string) {
-		dnsName := strings.Trim(name, ".")
-		if result, ok := search[dnsName]; ok {
-			return result
-		}
-		i, j := 0, 0
-		for j != -1 { // check if there was a dot
-			if result, ok := search[dnsName[i:]]; ok { // check substring to the right of it
-				return result
-			}
-			j = strings.Index(dnsName[i:], ".") // look for the next dot
-			i = i + j + 1                       // calculate index of the next substr beginning
+		normalizeRouting(e)
+		if snapshot != nil && p.disabledPolicy != DisabledPolicyEnable {
+			adjustDisabled(e, snapshot.disabled)
+		}
+		if snapshot != nil {
+			adjustSharedTTL(e, snapshot.shared)
 		}
-		return ""
+		adjusted = append(adjusted, e)
 	}
+	return adjusted, nil
 }
 
-func (p *DnsProvider) handleUpdateChanges(ctx context.Context, changes *plan.Changes, getZone func(name string) string) (int, *errgroup.Group) {
+func (p *DnsProvider) handleUpdateChanges(ctx context.Context, changes *plan.Changes, zones *zoneIndex, skipped *skippedChanges, results *changeResults, entries *auditEntries) (int, *errgroup.Group) {
 	logger := log.Logger(ctx)
 	logger.Info("start applying Update changes")
 	defer logger.Info("finish applying Update changes")
@@ -216,48 +381,115 @@ func (p *DnsProvider) handleUpdateChanges(ctx context.Context, changes *plan.Cha
 	gr, _ := errgroup.WithContext(ctx)
 
 	for _, e := range changes.UpdateNew {
-		zone := getZone(e.DNSName)
-		if zone == "" {
-			logger.WithField(log.DNSNameKey, e.DNSName).Warning("update skipped - no such zone")
+		zone, acc, reason := zones.lookup(e.DNSName, e.RecordType)
+		if reason != "" {
+			skipped.add(ctx, actionUpdate, e, reason)
 			continue
 		}
 
+		rrsetValuesToCreate, err := p.findRecordsToCreate(ctx, e, changes.UpdateOld)
+		if err != nil {
+			logger.WithField(log.DNSNameKey, e.DNSName).WithField(log.ErrorKey, err).Warning("invalid target")
+			skipped.add(ctx, actionUpdate, e, skipReasonInvalidTarget)
+			continue
+		}
 		rrsetsToDelete := p.findRecordsToDelete(ctx, e, changes.UpdateOld)
-		rrsetValuesToCreate := p.findRecordsToCreate(ctx, e, changes.UpdateOld)
+		var toEnable []string
+		if p.disabledPolicy == DisabledPolicyEnable {
+			toEnable = p.findRecordsToEnable(ctx, e, changes.UpdateOld)
+		}
+		reroute := p.findRoutingChange(ctx, e, changes.UpdateOld)
+		retime := p.findTTLChange(ctx, e, changes.UpdateOld)
 
-		forUpdate += len(rrsetsToDelete) + len(rrsetValuesToCreate)
+		forUpdate += len(rrsetsToDelete) + len(rrsetValuesToCreate) + len(toEnable)
+		if reroute {
+			forUpdate++
+		}
+		if retime {
+			forUpdate++
+		}
+		// creates aren't collected in dry run mode, so they are found again for the audit
+		current := currentRecord(e, changes.UpdateOld)
+		changed := current != nil && (len(findDiff(e, current)) > 0 || len(rrsetsToDelete) > 0 || len(toEnable) > 0 || reroute || retime)
 
 		gr.Go(func() error {
-			return p.sendUpdates(ctx, zone, e, rrsetsToDelete, rrsetValuesToCreate)
+			err := p.sendUpdates(ctx, acc, zone, e, rrsetsToDelete, rrsetValuesToCreate, toEnable, reroute, retime)
+			results.add(actionUpdate, e, err)
+			if changed {
+				p.auditChange(ctx, entries, acc, zone, actionUpdate, current, e, err)
+			}
+			return err
 		})
 	}
 
 	return forUpdate, gr
 }
 
-func (p *DnsProvider) sendUpdates(ctx context.Context, zone string, e *endpoint.Endpoint, rrsetsToDelete endpoint.Targets, rrsetValuesToCreate []dns.ResourceRecord) error {
-	logger := log.Logger(ctx)
+func (p *DnsProvider) sendUpdates(ctx context.Context, acc *account, zone string, e *endpoint.Endpoint, rrsetsToDelete endpoint.Targets, rrsetValuesToCreate []dns.ResourceRecord, toEnable []string, reroute, retime bool) error {
+	logger := log.Logger(ctx).WithField(log.AccountKey, acc.alias)
+	defer p.locks.lock(e.DNSName, e.RecordType)()
 
 	if len(rrsetsToDelete) > 0 && !p.dryRun {
-		err := p.client.DeleteRRSetRecord(ctx, zone, e.DNSName, e.RecordType, rrsetsToDelete...)
+		err := p.deleteTargets(ctx, acc, zone, e, rrsetsToDelete)
 		if err != nil {
-			err = fmt.Errorf("failed to delete rrset records: %s", err)
+			err = fmt.Errorf("failed to delete rrset records: %w", err)
 			logger.Error(err)
+			return err
 		}
-		return err
 	}
 	if len(rrsetValuesToCreate) > 0 && !p.dryRun {
-		err := p.client.AddZoneRRSet(ctx, zone, e.DNSName, e.RecordType, rrsetValuesToCreate, int(e.RecordTTL))
+		// routing of shared RRSet is written together with the added records
+		err := p.addRecords(ctx, acc, zone, e, rrsetValuesToCreate)
 		if err != nil {
-			err = fmt.Errorf("failed to add rrset records: %s", err)
+			err = fmt.Errorf("failed to add rrset records: %w", err)
 			logger.Error(err)
+			return err
 		}
-		return err
+	}
+	if len(toEnable) > 0 && !p.dryRun {
+		err := p.enableTargets(ctx, acc, zone, e, toEnable)
+		if err != nil {
+			logger.Error(err)
+			return err
+		}
+	}
+	if reroute && len(rrsetValuesToCreate) == 0 && !p.dryRun {
+		err := p.applyRouting(ctx, acc, zone, e)
+		if err != nil {
+			logger.Error(err)
+			return err
+		}
+	}
+	if retime && !p.dryRun {
+		err := p.applyTTL(ctx, acc, zone, e)
+		if err != nil {
+			logger.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// applyTTL writes TTL of e to its RRSet, unless the RRSet already has it, e.g. after records were added
+func (p *DnsProvider) applyTTL(ctx context.Context, acc *account, zone string, e *endpoint.Endpoint) error {
+	set, err := acc.client.RRSet(ctx, zone, e.DNSName, e.RecordType)
+	if err != nil {
+		if apiErr := new(dns.APIError); errors.As(err, apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to get rrset to apply ttl: %w", err)
+	}
+	if set.TTL == int(e.RecordTTL) {
+		return nil
+	}
+	set.TTL = int(e.RecordTTL)
+	if err = acc.client.UpdateRRSet(ctx, zone, e.DNSName, e.RecordType, set); err != nil {
+		return fmt.Errorf("failed to apply ttl: %w", err)
 	}
 	return nil
 }
 
-func (p *DnsProvider) handleDeleteChanges(ctx context.Context, changes *plan.Changes, getZone func(name string) string) (int, *errgroup.Group) {
+func (p *DnsProvider) handleDeleteChanges(ctx context.Context, changes *plan.Changes, zones *zoneIndex, skipped *skippedChanges, results *changeResults, entries *auditEntries) (int, *errgroup.Group) {
 	logger := log.Logger(ctx)
 	logger.Info("start applying Delete changes")
 	defer logger.Info("finish applying Delete changes")
@@ -266,9 +498,9 @@ func (p *DnsProvider) handleDeleteChanges(ctx context.Context, changes *plan.Cha
 	gr, _ := errgroup.WithContext(ctx)
 
 	for _, e := range changes.Delete {
-		zone := getZone(e.DNSName)
-		if zone == "" {
-			logger.WithField(log.DNSNameKey, e.DNSName).Warning("delete skipped - no such zone")
+		zone, acc, reason := zones.lookup(e.DNSName, e.RecordType)
+		if reason != "" {
+			skipped.add(ctx, actionDelete, e, reason)
 			continue
 		}
 
@@ -283,27 +515,36 @@ func (p *DnsProvider) handleDeleteChanges(ctx context.Context, changes *plan.Cha
 			logger.Debug(msg)
 		}
 
-		if len(e.Targets) > 0 && !p.dryRun {
-			gr.Go(func() error {
-				return p.sendDeletes(ctx, zone, e)
-			})
+		if len(e.Targets) == 0 {
+			continue
+		}
+		if p.dryRun {
+			p.auditChange(ctx, entries, acc, zone, actionDelete, nil, e, nil)
+			continue
 		}
+		gr.Go(func() error {
+			err := p.sendDeletes(ctx, acc, zone, e)
+			results.add(actionDelete, e, err)
+			p.auditChange(ctx, entries, acc, zone, actionDelete, nil, e, err)
+			return err
+		})
 	}
 
 	return forDelete, gr
 }
 
-func (p *DnsProvider) sendDeletes(ctx context.Context, zone string, e *endpoint.Endpoint) error {
-	logger := log.Logger(ctx)
-	err := p.client.DeleteRRSetRecord(ctx, zone, e.DNSName, e.RecordType, e.Targets...)
+func (p *DnsProvider) sendDeletes(ctx context.Context, acc *account, zone string, e *endpoint.Endpoint) error {
+	logger := log.Logger(ctx).WithField(log.AccountKey, acc.alias)
+	defer p.locks.lock(e.DNSName, e.RecordType)()
+	err := p.deleteTargets(ctx, acc, zone, e, e.Targets)
 	if err != nil {
-		err = fmt.Errorf("failed to delete rrset: %s", err)
+		err = fmt.Errorf("failed to delete rrset: %w", err)
 		logger.Error(err)
 	}
 	return err
 }
 
-func (p *DnsProvider) handleCreateChanges(ctx context.Context, changes *plan.Changes, getZone func(name string) string) (int, *errgroup.Group) {
+func (p *DnsProvider) handleCreateChanges(ctx context.Context, changes *plan.Changes, zones *zoneIndex, skipped *skippedChanges, results *changeResults, entries *auditEntries) (int, *errgroup.Group) {
 	logger := log.Logger(ctx)
 	logger.Info("start applying Create changes")
 	defer logger.Info("finish applying Create changes")
@@ -312,15 +553,21 @@ func (p *DnsProvider) handleCreateChanges(ctx context.Context, changes *plan.Cha
 	gr, _ := errgroup.WithContext(ctx)
 
 	for _, e := range changes.Create {
-		zone := getZone(e.DNSName)
-		if zone == "" {
-			logger.WithField(log.DNSNameKey, e.DNSName).Warning("delete skipped - no such zone")
+		zone, acc, reason := zones.lookup(e.DNSName, e.RecordType)
+		if reason != "" {
+			skipped.add(ctx, actionCreate, e, reason)
+			continue
+		}
+
+		recordValues, err := p.newRecords(e, e.Targets)
+		if err != nil {
+			logger.WithField(log.DNSNameKey, e.DNSName).WithField(log.ErrorKey, err).Warning("invalid target")
+			skipped.add(ctx, actionCreate, e, skipReasonInvalidTarget)
 			continue
 		}
 
 		forCreate += len(e.Targets)
 
-		recordValues := make([]dns.ResourceRecord, 0)
 		for _, content := range e.Targets {
 			msg := fmt.Sprintf("for create %s %s %s", e.DNSName, e.RecordType, content)
 			if p.dryRun {
@@ -328,39 +575,40 @@ func (p *DnsProvider) handleCreateChanges(ctx context.Context, changes *plan.Cha
 				continue
 			}
 			logger.Debug(msg)
-			rr := dns.ResourceRecord{Enabled: true}
-			rr.SetContent(e.RecordType, content)
-			recordValues = append(recordValues, rr)
 		}
 
-		if len(e.Targets) > 0 && !p.dryRun {
-			gr.Go(func() error {
-				return p.sendCreates(ctx, zone, e, recordValues)
-			})
+		if len(e.Targets) == 0 {
+			continue
 		}
+		if p.dryRun {
+			p.auditChange(ctx, entries, acc, zone, actionCreate, nil, e, nil)
+			continue
+		}
+		gr.Go(func() error {
+			err := p.sendCreates(ctx, acc, zone, e, recordValues)
+			results.add(actionCreate, e, err)
+			p.auditChange(ctx, entries, acc, zone, actionCreate, nil, e, err)
+			return err
+		})
 	}
 
 	return forCreate, gr
 }
 
-func (p *DnsProvider) sendCreates(ctx context.Context, zone string, e *endpoint.Endpoint, recordValues []dns.ResourceRecord) error {
-	logger := log.Logger(ctx)
-	err := p.client.AddZoneRRSet(ctx, zone, e.DNSName, e.RecordType, recordValues, int(e.RecordTTL))
+func (p *DnsProvider) sendCreates(ctx context.Context, acc *account, zone string, e *endpoint.Endpoint, recordValues []dns.ResourceRecord) error {
+	logger := log.Logger(ctx).WithField(log.AccountKey, acc.alias)
+	defer p.locks.lock(e.DNSName, e.RecordType)()
+	err := p.addRecords(ctx, acc, zone, e, recordValues)
 	if err != nil {
-		err = fmt.Errorf("failed to create rrset: %s", err)
+		err = fmt.Errorf("failed to create rrset: %w", err)
 		logger.Error(err)
+		return err
 	}
-	return err
+	return nil
 }
 
 func (p *DnsProvider) findRecordsToDelete(ctx context.Context, update *endpoint.Endpoint, existingEndpoints []*endpoint.Endpoint) endpoint.Targets {
-	var existing *endpoint.Endpoint
-	for _, ex := range existingEndpoints {
-		if ex.RecordType != update.RecordType || ex.DNSName != update.DNSName {
-			continue
-		}
-		existing = ex
-	}
+	existing := currentRecord(update, existingEndpoints)
 	if existing == nil {
 		return nil
 	}
@@ -378,20 +626,17 @@ func (p *DnsProvider) findRecordsToDelete(ctx context.Context, update *endpoint.
 	return diff
 }
 
-func (p *DnsProvider) findRecordsToCreate(ctx context.Context, update *endpoint.Endpoint, existingEndpoints []*endpoint.Endpoint) []dns.ResourceRecord {
-	var existing *endpoint.Endpoint
-	for _, ex := range existingEndpoints {
-		if ex.RecordType != update.RecordType || ex.DNSName != update.DNSName {
-			continue
-		}
-		existing = ex
-	}
+func (p *DnsProvider) findRecordsToCreate(ctx context.Context, update *endpoint.Endpoint, existingEndpoints []*endpoint.Endpoint) ([]dns.ResourceRecord, error) {
+	existing := currentRecord(update, existingEndpoints)
 	if existing == nil {
-		return nil
+		return nil, nil
 	}
 	diff := findDiff(update, existing)
 
-	recordValues := make([]dns.ResourceRecord, 0, len(diff))
+	recordValues, err := p.newRecords(update, diff)
+	if err != nil {
+		return nil, err
+	}
 	logger := log.Logger(ctx)
 
 	for _, content := range diff {
@@ -401,11 +646,61 @@ func (p *DnsProvider) findRecordsToCreate(ctx context.Context, update *endpoint.
 			continue
 		}
 		logger.Debug(msg)
-		rr := dns.ResourceRecord{Enabled: true}
-		rr.SetContent(update.RecordType, content)
-		recordValues = append(recordValues, rr)
 	}
-	return recordValues
+	if p.dryRun {
+		return nil, nil
+	}
+	return recordValues, nil
+}
+
+// findTTLChange reports whether configured TTL of update differs from TTL of the current record
+func (p *DnsProvider) findTTLChange(ctx context.Context, update *endpoint.Endpoint, existingEndpoints []*endpoint.Endpoint) bool {
+	existing := currentRecord(update, existingEndpoints)
+	if existing == nil || !update.RecordTTL.IsConfigured() || update.RecordTTL == existing.RecordTTL {
+		return false
+	}
+
+	msg := fmt.Sprintf("for update-ttl %s %s %d", update.DNSName, update.RecordType, update.RecordTTL)
+	logger := log.Logger(ctx)
+	if p.dryRun {
+		logger.WithField(log.DryRunKey, true).Info(msg)
+	} else {
+		logger.Debug(msg)
+	}
+	return true
+}
+
+func (p *DnsProvider) findRecordsToEnable(ctx context.Context, update *endpoint.Endpoint, existingEndpoints []*endpoint.Endpoint) []string {
+	toEnable := targetsToEnable(update, existingEndpoints)
+
+	logger := log.Logger(ctx)
+	for _, content := range toEnable {
+		msg := fmt.Sprintf("for update-enable %s %s %s", update.DNSName, update.RecordType, content)
+		if p.dryRun {
+			logger.WithField(log.DryRunKey, true).Info(msg)
+			continue
+		}
+		logger.Debug(msg)
+	}
+	return toEnable
+}
+
+// newRecords returns records to add for targets of e with routing, provenance and SetIdentifier of e in meta
+func (p *DnsProvider) newRecords(e *endpoint.Endpoint, targets endpoint.Targets) ([]dns.ResourceRecord, error) {
+	records, err := resourceRecords(e.RecordType, targets)
+	if err != nil {
+		return nil, err
+	}
+	r, err := routingOf(e)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		r.apply(&records[i])
+	}
+	p.provenance.annotate(e, records)
+	tagSetIdentifier(e, records)
+	return records, nil
 }
 
 // findDiff returns RRSets in target that don't exist in source
@@ -414,7 +709,7 @@ func findDiff(target, source *endpoint.Endpoint) endpoint.Targets {
 	for _, t := range target.Targets {
 		exists := false
 		for _, st := range source.Targets {
-			if st == t {
+			if sameTarget(target.RecordType, st, t) {
 				exists = true
 				break
 			}
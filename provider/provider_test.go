@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"reflect"
 	"testing"
 
@@ -15,6 +16,10 @@ type clientMock struct {
 	addZoneRRSet      func(ctx context.Context, zone, recordName, recordType string, values []dns.ResourceRecord, ttl int, opts ...dns.AddZoneOpt) error
 	zonesWithRecords  func(ctx context.Context, filters ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error)
 	deleteRRSetRecord func(ctx context.Context, zone, name, recordType string, contents ...string) error
+	deleteRRSet       func(ctx context.Context, zone, name, recordType string) error
+	createZone        func(ctx context.Context, name string) (uint64, error)
+	rrSet             func(ctx context.Context, zone, name, recordType string) (dns.RRSet, error)
+	updateRRSet       func(ctx context.Context, zone, name, recordType string, record dns.RRSet) error
 }
 
 func (c *clientMock) AddZoneRRSet(ctx context.Context,
@@ -31,6 +36,26 @@ func (c *clientMock) DeleteRRSetRecord(ctx context.Context, zone, name, recordTy
 	return c.deleteRRSetRecord(ctx, zone, name, recordType, contents...)
 }
 
+func (c *clientMock) DeleteRRSet(ctx context.Context, zone, name, recordType string) error {
+	return c.deleteRRSet(ctx, zone, name, recordType)
+}
+
+func (c *clientMock) CreateZone(ctx context.Context, name string) (uint64, error) {
+	return c.createZone(ctx, name)
+}
+
+// RRSet answers not found if rrSet isn't set, so Records reports all records as enabled
+func (c *clientMock) RRSet(ctx context.Context, zone, name, recordType string) (dns.RRSet, error) {
+	if c.rrSet == nil {
+		return dns.RRSet{}, dns.APIError{StatusCode: http.StatusNotFound, Message: "rrset not found"}
+	}
+	return c.rrSet(ctx, zone, name, recordType)
+}
+
+func (c *clientMock) UpdateRRSet(ctx context.Context, zone, name, recordType string, record dns.RRSet) error {
+	return c.updateRRSet(ctx, zone, name, recordType, record)
+}
+
 func Test_dnsProvider_Records(t *testing.T) {
 	type fields struct {
 		domainFilter endpoint.DomainFilter
@@ -135,8 +160,8 @@ func Test_dnsProvider_Records(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &DnsProvider{
-				client: tt.fields.client,
-				dryRun: tt.fields.dryRun,
+				accounts: []*account{newAccount(DefaultAccountAlias, tt.fields.client, nil)},
+				dryRun:   tt.fields.dryRun,
 			}
 			got, err := p.Records(tt.args.ctx)
 			if (err != nil) != tt.wantErr {
@@ -186,8 +211,8 @@ func Test_dnsProvider_GetDomainFilter(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &DnsProvider{
-				client: tt.fields.client,
-				dryRun: tt.fields.dryRun,
+				accounts: []*account{newAccount(DefaultAccountAlias, tt.fields.client, nil)},
+				dryRun:   tt.fields.dryRun,
 			}
 			if got := p.GetDomainFilter(context.Background()); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("GetDomainFilter() = %v, want %v", got, tt.want)
@@ -394,12 +419,43 @@ func Test_dnsProvider_ApplyChanges(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "update adds targets after deleting old ones",
+			fields: fields{
+				domainFilter: endpoint.DomainFilter{},
+				client: &clientMock{
+					zonesWithRecords: func(ctx context.Context,
+						filters ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+						return []dns.Zone{{Name: "test.com"}}, nil
+					},
+					deleteRRSetRecord: func(ctx context.Context, zone, name, recordType string, contents ...string) error {
+						return nil
+					},
+					addZoneRRSet: func(ctx context.Context, zone, recordName, recordType string, values []dns.ResourceRecord, ttl int, opts ...dns.AddZoneOpt) error {
+						return fmt.Errorf("addZoneRRSet failed")
+					},
+				},
+				dryRun: false,
+			},
+			args: args{
+				ctx: context.Background(),
+				changes: &plan.Changes{
+					UpdateOld: []*endpoint.Endpoint{
+						endpoint.NewEndpointWithTTL("my.test.com", "A", 10, "1.1.1.1"),
+					},
+					UpdateNew: []*endpoint.Endpoint{
+						endpoint.NewEndpointWithTTL("my.test.com", "A", 10, "1.2.3.4"),
+					},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &DnsProvider{
-				client: tt.fields.client,
-				dryRun: tt.fields.dryRun,
+				accounts: []*account{newAccount(DefaultAccountAlias, tt.fields.client, nil)},
+				dryRun:   tt.fields.dryRun,
 			}
 			if err := p.ApplyChanges(tt.args.ctx, tt.args.changes); (err != nil) != tt.wantErr {
 				t.Errorf("ApplyChanges() error = %v, wantErr %v", err, tt.wantErr)
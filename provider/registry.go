@@ -0,0 +1,258 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	ENV_REGISTRY                          = "EC_REGISTRY"
+	ENV_REGISTRY_TXT_PREFIX               = "EC_REGISTRY_TXT_PREFIX"
+	ENV_REGISTRY_TXT_SUFFIX               = "EC_REGISTRY_TXT_SUFFIX"
+	ENV_REGISTRY_TXT_WILDCARD_REPLACEMENT = "EC_REGISTRY_TXT_WILDCARD_REPLACEMENT"
+
+	// RegistryTXT keeps TXT registry records of external-dns as DNS records
+	RegistryTXT = "txt"
+	// RegistryMeta keeps ownership from TXT registry records in notes meta of owned records
+	RegistryMeta = "meta"
+)
+
+const (
+	// registryNotePrefix starts serialized labels of external-dns TXT registry
+	registryNotePrefix = "heritage=external-dns"
+	// recordTypeTemplate is replaced with record type in TXT prefix and suffix of external-dns
+	recordTypeTemplate = "%{record_type}"
+)
+
+// registryTypes are record types the external-dns TXT registry tracks ownership of, all types managed by the provider
+var registryTypes = []string{
+	endpoint.RecordTypeA, endpoint.RecordTypeAAAA, endpoint.RecordTypeCNAME, endpoint.RecordTypeNS, endpoint.RecordTypeMX,
+	endpoint.RecordTypeSRV, endpoint.RecordTypeTXT, RecordTypeCAA, RecordTypePTR,
+}
+
+// metaRegistry maps TXT registry records to notes of owned records,
+// prefix, suffix and wildcardReplacement must match --txt-prefix, --txt-suffix and --txt-wildcard-replacement of external-dns
+type metaRegistry struct {
+	prefix              string
+	suffix              string
+	wildcardReplacement string
+}
+
+// WithMetaRegistry makes the provider store ownership written by external-dns TXT registry in notes meta
+// of owned records instead of TXT records. Records returns the matching TXT registry records, so external-dns
+// sees no difference. Encrypted TXT registry (--txt-encrypt-enabled) isn't supported.
+func WithMetaRegistry(prefix, suffix, wildcardReplacement string) Option {
+	return func(p *DnsProvider) {
+		p.registry = &metaRegistry{
+			prefix:              strings.ToLower(prefix),
+			suffix:              strings.ToLower(suffix),
+			wildcardReplacement: strings.ToLower(wildcardReplacement),
+		}
+	}
+}
+
+// txtName returns name of TXT registry record for record name and type the same way as external-dns does
+func (r *metaRegistry) txtName(name, recordType string) string {
+	parts := strings.SplitN(name, ".", 2)
+	recordType = strings.ToLower(recordType)
+	prefix := strings.ReplaceAll(r.prefix, recordTypeTemplate, recordType)
+	suffix := strings.ReplaceAll(r.suffix, recordTypeTemplate, recordType)
+
+	if r.wildcardReplacement != "" && parts[0] == "*" {
+		parts[0] = r.wildcardReplacement
+	}
+	if !strings.Contains(r.prefix, recordTypeTemplate) && !strings.Contains(r.suffix, recordTypeTemplate) {
+		parts[0] = recordType + "-" + parts[0]
+	}
+	if len(parts) < 2 {
+		return prefix + parts[0] + suffix
+	}
+	return prefix + parts[0] + suffix + "." + parts[1]
+}
+
+// ownedRecord returns name and type of record owned by TXT registry record e, name is empty if e isn't a registry record
+func (r *metaRegistry) ownedRecord(e *endpoint.Endpoint) (name, recordType string) {
+	if e.RecordType != endpoint.RecordTypeTXT || len(e.Targets) != 1 || !isRegistryNote(registryNote(e.Targets[0])) {
+		return "", ""
+	}
+	owned := toASCII(strings.TrimSuffix(e.Labels[endpoint.OwnedRecordLabelKey], "."))
+	if owned == "" {
+		return "", ""
+	}
+	for _, t := range registryTypes {
+		if sameName(r.txtName(owned, t), e.DNSName) {
+			return owned, t
+		}
+	}
+	return "", ""
+}
+
+// registryNote converts TXT registry target to note, external-dns quotes the target
+func registryNote(target string) string {
+	return strings.Trim(target, `"`)
+}
+
+func isRegistryNote(note string) bool {
+	return strings.HasPrefix(note, registryNotePrefix)
+}
+
+// registryOp sets ownership note of RRSet records of setIdentifier, empty note removes it
+type registryOp struct {
+	name          string
+	recordType    string
+	setIdentifier string
+	note          string
+}
+
+// split separates TXT registry changes from changes applied as DNS records.
+// Deleted and updated TXT registry records are still deleted as DNS records,
+// so TXT records written before the meta registry was enabled are cleaned up.
+func (r *metaRegistry) split(changes *plan.Changes) (*plan.Changes, []registryOp) {
+	var ops []registryOp
+	res := &plan.Changes{}
+
+	for _, e := range changes.Create {
+		if name, t := r.ownedRecord(e); name != "" {
+			ops = append(ops, registryOp{name: name, recordType: t, setIdentifier: e.SetIdentifier, note: registryNote(e.Targets[0])})
+			continue
+		}
+		res.Create = append(res.Create, e)
+	}
+	for _, e := range changes.UpdateNew {
+		if name, t := r.ownedRecord(e); name != "" {
+			ops = append(ops, registryOp{name: name, recordType: t, setIdentifier: e.SetIdentifier, note: registryNote(e.Targets[0])})
+			continue
+		}
+		res.UpdateNew = append(res.UpdateNew, e)
+	}
+	for _, e := range changes.UpdateOld {
+		if name, _ := r.ownedRecord(e); name != "" {
+			res.Delete = append(res.Delete, e)
+			continue
+		}
+		res.UpdateOld = append(res.UpdateOld, e)
+	}
+	for _, e := range changes.Delete {
+		if name, t := r.ownedRecord(e); name != "" {
+			ops = append(ops, registryOp{name: name, recordType: t, setIdentifier: e.SetIdentifier})
+		}
+		res.Delete = append(res.Delete, e)
+	}
+	return res, ops
+}
+
+// registryRecords returns TXT registry records for RRSets with ownership notes, one per SetIdentifier
+// of records. RRSets which still have a TXT registry record in DNS are skipped.
+func (r *metaRegistry) registryRecords(zones []accountZone, rrsets map[rrsetKey]dns.RRSet) []*endpoint.Endpoint {
+	var res []*endpoint.Endpoint
+	for _, z := range zones {
+		txtNames := make(map[string]bool)
+		for _, rec := range z.Records {
+			if rec.Type == endpoint.RecordTypeTXT {
+				txtNames[normalizeZone(rec.Name)] = true
+			}
+		}
+		for _, rec := range z.Records {
+			if !slices.Contains(registryTypes, rec.Type) {
+				continue
+			}
+			name := r.txtName(strings.TrimSuffix(rec.Name, "."), rec.Type)
+			if txtNames[normalizeZone(name)] {
+				continue
+			}
+			for _, g := range groupBySetIdentifier(rrsets[newRRSetKey(rec.Name, rec.Type)]) {
+				note := ownershipNote(g.records)
+				if note == "" {
+					continue
+				}
+				e := endpoint.NewEndpoint(name, endpoint.RecordTypeTXT, `"`+note+`"`).WithSetIdentifier(g.setIdentifier)
+				e.Labels[endpoint.OwnedRecordLabelKey] = strings.TrimSuffix(rec.Name, ".")
+				res = append(res, e)
+			}
+		}
+	}
+	return res
+}
+
+// ownershipNote returns the first ownership note of records
+func ownershipNote(records []dns.ResourceRecord) string {
+	for _, rr := range records {
+		for _, n := range recordNotes(rr) {
+			if isRegistryNote(n) {
+				return n
+			}
+		}
+	}
+	return ""
+}
+
+// applyRegistry writes ownership notes after owned records are changed
+func (p *DnsProvider) applyRegistry(ctx context.Context, zones *zoneIndex, ops []registryOp) error {
+	logger := log.Logger(ctx)
+	gr, _ := errgroup.WithContext(ctx)
+
+	for _, op := range ops {
+		zone, acc, reason := zones.lookup(op.name, op.recordType)
+		if reason != "" {
+			logger.WithField(log.DNSNameKey, op.name).Warningf("ownership of %s record is not written - %s", op.recordType, reason)
+			continue
+		}
+		msg := fmt.Sprintf("for update-owner %s %s %s %s", op.name, op.recordType, op.setIdentifier, op.note)
+		if p.dryRun {
+			logger.WithField(log.DryRunKey, true).Info(msg)
+			p.writeAudit(ctx, p.newAuditEntry(ctx, acc, zone, actionUpdateOwner, op.name, op.recordType, op.setIdentifier, nil))
+			continue
+		}
+		logger.Debug(msg)
+		gr.Go(func() error {
+			err := p.setOwnershipNote(ctx, acc, zone, op)
+			p.writeAudit(ctx, p.newAuditEntry(ctx, acc, zone, actionUpdateOwner, op.name, op.recordType, op.setIdentifier, err))
+			if err != nil {
+				logger.WithField(log.AccountKey, acc.alias).Error(err)
+			}
+			return err
+		})
+	}
+	return gr.Wait()
+}
+
+func (p *DnsProvider) setOwnershipNote(ctx context.Context, acc *account, zone string, op registryOp) error {
+	defer p.locks.lock(op.name, op.recordType)()
+	set, err := acc.client.RRSet(ctx, zone, op.name, op.recordType)
+	if err != nil {
+		if apiErr := new(dns.APIError); errors.As(err, apiErr) && apiErr.StatusCode == http.StatusNotFound && op.note == "" {
+			return nil
+		}
+		return fmt.Errorf("failed to get %s %s rrset to write ownership: %w", op.name, op.recordType, err)
+	}
+	changed := false
+	for i := range set.Records {
+		if recordSetIdentifier(set.Records[i]) != op.setIdentifier {
+			continue
+		}
+		notes := recordNotes(set.Records[i])
+		updated := replaceNote(notes, isRegistryNote, op.note)
+		if slices.Equal(notes, updated) {
+			continue
+		}
+		setRecordNotes(&set.Records[i], updated)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if err = acc.client.UpdateRRSet(ctx, zone, op.name, op.recordType, set); err != nil {
+		return fmt.Errorf("failed to write ownership of %s %s: %w", op.name, op.recordType, err)
+	}
+	return nil
+}
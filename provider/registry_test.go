@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_metaRegistry_txtName(t *testing.T) {
+	tests := []struct {
+		registry   metaRegistry
+		name       string
+		recordType string
+		want       string
+	}{
+		{name: "www.example.com", recordType: "A", want: "a-www.example.com"},
+		{name: "example.com", recordType: "CNAME", want: "cname-example.com"},
+		{registry: metaRegistry{prefix: "txt."}, name: "www.example.com", recordType: "AAAA", want: "txt.aaaa-www.example.com"},
+		{registry: metaRegistry{suffix: "-owner"}, name: "www.example.com", recordType: "A", want: "a-www-owner.example.com"},
+		{registry: metaRegistry{prefix: "%{record_type}-reg."}, name: "www.example.com", recordType: "MX", want: "mx-reg.www.example.com"},
+		{registry: metaRegistry{wildcardReplacement: "any"}, name: "*.example.com", recordType: "A", want: "a-any.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.registry.txtName(tt.name, tt.recordType); got != tt.want {
+				t.Errorf("txtName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func registryTXT(name, owned, labels string) *endpoint.Endpoint {
+	e := endpoint.NewEndpoint(name, "TXT", labels)
+	e.Labels[endpoint.OwnedRecordLabelKey] = owned
+	return e
+}
+
+func Test_metaRegistry_split(t *testing.T) {
+	r := &metaRegistry{}
+	owner := `"heritage=external-dns,external-dns/owner=k8s,external-dns/resource=service/default/web"`
+	www := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")
+	userTXT := endpoint.NewEndpoint("example.com", "TXT", "v=spf1 -all")
+	// names of TXT records without ownedRecord label can't be mapped to owned records
+	foreignTXT := endpoint.NewEndpoint("a-foreign.example.com", "TXT", owner)
+	oldTXT := registryTXT("a-api.example.com", "api.example.com", `"heritage=external-dns,external-dns/owner=old"`)
+
+	changes, ops := r.split(&plan.Changes{
+		Create:    []*endpoint.Endpoint{www, registryTXT("a-www.example.com", "www.example.com", owner), userTXT, foreignTXT},
+		UpdateOld: []*endpoint.Endpoint{oldTXT},
+		UpdateNew: []*endpoint.Endpoint{registryTXT("a-api.example.com", "api.example.com", owner)},
+		Delete:    []*endpoint.Endpoint{registryTXT("cname-gone.example.com", "gone.example.com", owner)},
+	})
+
+	wantOps := []registryOp{
+		{name: "www.example.com", recordType: "A", note: registryNote(owner)},
+		{name: "api.example.com", recordType: "A", note: registryNote(owner)},
+		{name: "gone.example.com", recordType: "CNAME"},
+	}
+	if !reflect.DeepEqual(ops, wantOps) {
+		t.Errorf("split() ops = %v, want %v", ops, wantOps)
+	}
+	if !reflect.DeepEqual(changes.Create, []*endpoint.Endpoint{www, userTXT, foreignTXT}) {
+		t.Errorf("split() create = %v", changes.Create)
+	}
+	if len(changes.UpdateOld) != 0 || len(changes.UpdateNew) != 0 {
+		t.Errorf("split() updates = %v, %v", changes.UpdateOld, changes.UpdateNew)
+	}
+	if len(changes.Delete) != 2 || changes.Delete[0] != oldTXT {
+		t.Errorf("split() delete = %v", changes.Delete)
+	}
+}
+
+func Test_registryTypes(t *testing.T) {
+	for recordType := range codecs {
+		if !slices.Contains(registryTypes, recordType) {
+			t.Errorf("ownership of %s records isn't tracked", recordType)
+		}
+	}
+
+	r := &metaRegistry{}
+	owner := `"heritage=external-dns,external-dns/owner=k8s"`
+	for _, tt := range []struct{ txtName, recordType string }{
+		{txtName: "srv-_sip._tcp.example.com", recordType: "SRV"},
+		{txtName: "txt-www.example.com", recordType: "TXT"},
+		{txtName: "caa-example.com", recordType: "CAA"},
+	} {
+		owned := strings.TrimPrefix(tt.txtName, strings.ToLower(tt.recordType)+"-")
+		if name, recordType := r.ownedRecord(registryTXT(tt.txtName, owned, owner)); name != owned || recordType != tt.recordType {
+			t.Errorf("ownedRecord(%s) = %s %s, want %s %s", tt.txtName, name, recordType, owned, tt.recordType)
+		}
+	}
+}
+
+func Test_dnsProvider_Records_registryFetchError(t *testing.T) {
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com", Records: []dns.ZoneRecord{
+				{Name: "www.example.com", Type: "A", TTL: 300, ShortAnswers: []string{"1.1.1.1"}},
+			}}}, nil
+		},
+		rrSet: func(context.Context, string, string, string) (dns.RRSet, error) {
+			return dns.RRSet{}, dns.APIError{StatusCode: http.StatusServiceUnavailable}
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	WithMetaRegistry("", "", "")(p)
+	// owned record without its TXT registry record would be taken over by external-dns
+	if records, err := p.Records(context.Background()); err == nil {
+		t.Errorf("Records() = %v, want error of failed rrset request", records)
+	}
+}
+
+func Test_metaRegistry_registryRecords(t *testing.T) {
+	r := &metaRegistry{}
+	note := "heritage=external-dns,external-dns/owner=k8s"
+	zones := []accountZone{{Zone: dns.Zone{Name: "example.com", Records: []dns.ZoneRecord{
+		{Name: "www.example.com", Type: "A"},
+		{Name: "api.example.com", Type: "A"},
+		{Name: "old.example.com", Type: "A"},
+		// TXT registry record written before meta registry was enabled wins
+		{Name: "a-old.example.com", Type: "TXT"},
+	}}}}
+	owned := dns.RRSet{Records: []dns.ResourceRecord{
+		{Content: []any{"1.1.1.1"}, Meta: map[string]any{"notes": []any{"created by cluster prod"}}},
+		{Content: []any{"2.2.2.2"}, Meta: map[string]any{"notes": []any{"created by cluster prod", note}}},
+	}}
+	rrsets := map[rrsetKey]dns.RRSet{
+		newRRSetKey("www.example.com", "A"): owned,
+		newRRSetKey("api.example.com", "A"): {Records: []dns.ResourceRecord{{Content: []any{"3.3.3.3"}}}},
+		newRRSetKey("old.example.com", "A"): owned,
+	}
+
+	got := r.registryRecords(zones, rrsets)
+	want := registryTXT("a-www.example.com", "www.example.com", `"`+note+`"`)
+	if len(got) != 1 || got[0].String() != want.String() || !reflect.DeepEqual(got[0].Labels, want.Labels) {
+		t.Errorf("registryRecords() = %v, want %v", got, want)
+	}
+}
+
+func Test_replaceNote(t *testing.T) {
+	notes := []string{"heritage=external-dns,external-dns/owner=old", "created by cluster prod"}
+	got := replaceNote(notes, isRegistryNote, "heritage=external-dns,external-dns/owner=new")
+	want := []string{"created by cluster prod", "heritage=external-dns,external-dns/owner=new"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replaceNote() = %v, want %v", got, want)
+	}
+	if got = replaceNote(notes, isRegistryNote, ""); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("replaceNote() removing = %v", got)
+	}
+}
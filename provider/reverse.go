@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const ENV_REVERSE_RECORDS = "EC_REVERSE_RECORDS"
+
+// WithReverseRecords makes ApplyChanges maintain PTR records for addresses of changed A and AAAA records,
+// e.g. for LoadBalancer IPs of services. PTR records are written only to reverse zones
+// (in-addr.arpa, ip6.arpa) which exist in one of the accounts, other addresses are ignored.
+func WithReverseRecords() Option {
+	return func(p *DnsProvider) {
+		p.reverseRecords = true
+	}
+}
+
+// reverseName returns PTR record name of IP address, it's empty for invalid address
+func reverseName(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil && !strings.Contains(addr, ":") {
+		return strconv.Itoa(int(v4[3])) + "." + strconv.Itoa(int(v4[2])) + "." +
+			strconv.Itoa(int(v4[1])) + "." + strconv.Itoa(int(v4[0])) + ".in-addr.arpa"
+	}
+	const hexDigits = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hexDigits[ip[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hexDigits[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
+
+func isAddressRecord(recordType string) bool {
+	return recordType == endpoint.RecordTypeA || recordType == endpoint.RecordTypeAAAA
+}
+
+// reverseChangeSet groups PTR targets by record name, so a PTR RRSet is written once per ApplyChanges
+type reverseChangeSet struct {
+	zones     *zoneIndex
+	endpoints []*endpoint.Endpoint
+	byName    map[string]*endpoint.Endpoint
+	// skipExisting drops targets the PTR RRSet already has
+	skipExisting bool
+}
+
+func (s *reverseChangeSet) add(e *endpoint.Endpoint, addrs endpoint.Targets) {
+	if s.byName == nil {
+		s.byName = make(map[string]*endpoint.Endpoint)
+	}
+	for _, addr := range addrs {
+		name := reverseName(addr)
+		if name == "" {
+			continue
+		}
+		if _, _, reason := s.zones.lookup(name, RecordTypePTR); reason != "" {
+			continue
+		}
+		host := strings.TrimSuffix(e.DNSName, ".")
+		if s.skipExisting && s.zones.hasAnswer(name, RecordTypePTR, host) {
+			continue
+		}
+		ptr, ok := s.byName[name]
+		if !ok {
+			ptr = endpoint.NewEndpointWithTTL(name, RecordTypePTR, e.RecordTTL)
+			s.byName[name] = ptr
+			s.endpoints = append(s.endpoints, ptr)
+		}
+		exists := false
+		for _, t := range ptr.Targets {
+			if sameName(t, host) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			ptr.Targets = append(ptr.Targets, host)
+		}
+	}
+}
+
+// withReverseChanges returns changes extended by PTR creates and deletes for changed addresses of A and AAAA records
+func withReverseChanges(changes *plan.Changes, zones *zoneIndex) *plan.Changes {
+	creates := &reverseChangeSet{zones: zones, skipExisting: true}
+	deletes := &reverseChangeSet{zones: zones}
+
+	for _, e := range changes.Create {
+		if isAddressRecord(e.RecordType) {
+			creates.add(e, e.Targets)
+		}
+	}
+	for _, e := range changes.Delete {
+		if isAddressRecord(e.RecordType) {
+			deletes.add(e, e.Targets)
+		}
+	}
+	for _, e := range changes.UpdateNew {
+		if !isAddressRecord(e.RecordType) {
+			continue
+		}
+		for _, old := range changes.UpdateOld {
+			if old.RecordType != e.RecordType || !sameName(old.DNSName, e.DNSName) {
+				continue
+			}
+			deletes.add(old, findDiff(old, e))
+			creates.add(e, findDiff(e, old))
+		}
+	}
+
+	return &plan.Changes{
+		Create:    append(append([]*endpoint.Endpoint{}, changes.Create...), creates.endpoints...),
+		UpdateOld: changes.UpdateOld,
+		UpdateNew: changes.UpdateNew,
+		Delete:    append(append([]*endpoint.Endpoint{}, changes.Delete...), deletes.endpoints...),
+	}
+}
@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_reverseName(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "192.0.2.10", want: "10.2.0.192.in-addr.arpa"},
+		{addr: "2001:db8::567:89ab", want: "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+		{addr: "www.example.com", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := reverseName(tt.addr); got != tt.want {
+				t.Errorf("reverseName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_withReverseChanges(t *testing.T) {
+	acc := &account{alias: "main"}
+	zones := newZoneIndex([]accountZone{
+		{Zone: dns.Zone{Name: "example.com"}, account: acc},
+		{Zone: dns.Zone{Name: "2.0.192.in-addr.arpa", Records: []dns.ZoneRecord{
+			{Name: "7.2.0.192.in-addr.arpa", Type: "PTR", ShortAnswers: []string{"old.example.com."}},
+		}}, account: acc},
+	})
+
+	changes := withReverseChanges(&plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("lb.example.com", "A", 300, "192.0.2.10", "198.51.100.1"),
+			endpoint.NewEndpointWithTTL("alias.example.com", "A", 300, "192.0.2.10"),
+			endpoint.NewEndpointWithTTL("old.example.com", "A", 300, "192.0.2.7"),
+			endpoint.NewEndpoint("www.example.com", "CNAME", "lb.example.com"),
+		},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("api.example.com", "A", "192.0.2.20", "192.0.2.21")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("api.example.com", "A", "192.0.2.21", "192.0.2.22")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("gone.example.com", "A", "192.0.2.30")},
+	}, zones)
+
+	got := make([]string, 0)
+	for _, e := range changes.Create[4:] {
+		got = append(got, "create "+e.String())
+	}
+	for _, e := range changes.Delete[1:] {
+		got = append(got, "delete "+e.String())
+	}
+	want := []string{
+		"create 10.2.0.192.in-addr.arpa 300 IN PTR  lb.example.com;alias.example.com []",
+		"create 22.2.0.192.in-addr.arpa 0 IN PTR  api.example.com []",
+		"delete 30.2.0.192.in-addr.arpa 0 IN PTR  gone.example.com []",
+		"delete 20.2.0.192.in-addr.arpa 0 IN PTR  api.example.com []",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("reverse changes = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("reverse change %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if len(changes.UpdateNew) != 1 || len(changes.UpdateOld) != 1 {
+		t.Errorf("updates changed: %v, %v", changes.UpdateOld, changes.UpdateNew)
+	}
+}
+
+func Test_dnsProvider_ApplyChanges_reverseRecords(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com"}, {Name: "2.0.192.in-addr.arpa"}}, nil
+		},
+		addZoneRRSet: func(_ context.Context, zone, name, recordType string, values []dns.ResourceRecord, _ int, _ ...dns.AddZoneOpt) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, v := range values {
+				calls = append(calls, "add "+zone+" "+name+" "+recordType+" "+v.ContentToString())
+			}
+			return nil
+		},
+		deleteRRSetRecord: func(_ context.Context, zone, name, recordType string, contents ...string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, c := range contents {
+				calls = append(calls, "delete "+zone+" "+name+" "+recordType+" "+c)
+			}
+			return nil
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	WithReverseRecords()(p)
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("lb.example.com", "A", "192.0.2.10")},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("gone.example.com", "A", "192.0.2.30")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(calls)
+	want := []string{
+		"add 2.0.192.in-addr.arpa 10.2.0.192.in-addr.arpa PTR lb.example.com",
+		"add example.com lb.example.com A 192.0.2.10",
+		"delete 2.0.192.in-addr.arpa 30.2.0.192.in-addr.arpa PTR gone.example.com",
+		"delete example.com gone.example.com A 192.0.2.30",
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %q, want %q", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %q, want %q", i, calls[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	// WeightProperty is ProviderSpecific property with weight of endpoint targets in weighted routing
+	WeightProperty = "webhook/edgecenter-weight"
+	// CountriesProperty is ProviderSpecific property listing comma separated ISO 3166 country codes
+	// endpoint targets are answered to
+	CountriesProperty = "webhook/edgecenter-country"
+	// ContinentsProperty is ProviderSpecific property listing comma separated continent codes
+	// endpoint targets are answered to
+	ContinentsProperty = "webhook/edgecenter-continent"
+)
+
+// meta keys of resource records and filters of RRSet used by routing
+const (
+	metaWeight     = "weight"
+	metaCountries  = "countries"
+	metaContinents = "continents"
+
+	filterWeightedShuffle = "weighted_shuffle"
+)
+
+// continentCodes are continent codes known to geodns filter
+var continentCodes = []string{"AF", "AN", "AS", "EU", "NA", "OC", "SA"}
+
+// routing is routing policy of endpoint targets, it's stored in meta of their records
+type routing struct {
+	weighted   bool
+	weight     int
+	countries  []string
+	continents []string
+}
+
+func (r routing) empty() bool {
+	return !r.weighted && len(r.countries) == 0 && len(r.continents) == 0
+}
+
+// routingOf parses routing ProviderSpecific properties of e
+func routingOf(e *endpoint.Endpoint) (routing, error) {
+	var r routing
+	if v, ok := e.GetProviderSpecificProperty(WeightProperty); ok && v != "" {
+		w, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || w < 0 {
+			return routing{}, fmt.Errorf("weight '%s' is not a non-negative integer", v)
+		}
+		r.weighted, r.weight = true, w
+	}
+	if v, ok := e.GetProviderSpecificProperty(CountriesProperty); ok {
+		for _, c := range splitCodes(v) {
+			if len(c) != 2 || strings.Trim(c, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+				return routing{}, fmt.Errorf("country '%s' is not an ISO 3166 alpha-2 code", c)
+			}
+			r.countries = append(r.countries, c)
+		}
+	}
+	if v, ok := e.GetProviderSpecificProperty(ContinentsProperty); ok {
+		for _, c := range splitCodes(v) {
+			if !slices.Contains(continentCodes, c) {
+				return routing{}, fmt.Errorf("continent '%s' is not one of %s", c, strings.Join(continentCodes, ", "))
+			}
+			r.continents = append(r.continents, c)
+		}
+	}
+	return r, nil
+}
+
+// splitCodes splits comma separated codes to sorted upper case codes
+func splitCodes(v string) []string {
+	var res []string
+	for _, c := range strings.Split(v, ",") {
+		if c = strings.ToUpper(strings.TrimSpace(c)); c != "" && !slices.Contains(res, c) {
+			res = append(res, c)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// validateRouting checks routing properties of e, routing needs SetIdentifier
+// to tell targets of different policies apart in one RRSet
+func validateRouting(e *endpoint.Endpoint) error {
+	r, err := routingOf(e)
+	if err != nil {
+		return err
+	}
+	if !r.empty() && e.SetIdentifier == "" {
+		return errors.New("routing properties require set identifier")
+	}
+	return nil
+}
+
+// setProperties replaces routing properties of e with normalized ones, so the plan compares them as strings
+func (r routing) setProperties(e *endpoint.Endpoint) {
+	e.DeleteProviderSpecificProperty(WeightProperty)
+	e.DeleteProviderSpecificProperty(CountriesProperty)
+	e.DeleteProviderSpecificProperty(ContinentsProperty)
+	if r.weighted {
+		e.SetProviderSpecificProperty(WeightProperty, strconv.Itoa(r.weight))
+	}
+	if len(r.countries) > 0 {
+		e.SetProviderSpecificProperty(CountriesProperty, strings.Join(r.countries, ","))
+	}
+	if len(r.continents) > 0 {
+		e.SetProviderSpecificProperty(ContinentsProperty, strings.Join(r.continents, ","))
+	}
+}
+
+// normalizeRouting rewrites valid routing properties of desired endpoint e the way Records returns them
+func normalizeRouting(e *endpoint.Endpoint) {
+	if r, err := routingOf(e); err == nil {
+		r.setProperties(e)
+	}
+}
+
+// recordRouting reads routing from meta of rr, meta values are float64 and []any after decoding API response
+func recordRouting(rr dns.ResourceRecord) routing {
+	var r routing
+	switch w := rr.Meta[metaWeight].(type) {
+	case float64:
+		r.weighted, r.weight = true, int(w)
+	case int:
+		r.weighted, r.weight = true, w
+	}
+	r.countries = metaCodes(rr.Meta[metaCountries])
+	r.continents = metaCodes(rr.Meta[metaContinents])
+	return r
+}
+
+func metaCodes(v any) []string {
+	switch v := v.(type) {
+	case []string:
+		return splitCodes(strings.Join(v, ","))
+	case []any:
+		codes := make([]string, 0, len(v))
+		for _, c := range v {
+			if s, ok := c.(string); ok {
+				codes = append(codes, s)
+			}
+		}
+		return splitCodes(strings.Join(codes, ","))
+	}
+	return nil
+}
+
+// apply writes routing to meta of rr removing routing meta r doesn't have
+func (r routing) apply(rr *dns.ResourceRecord) {
+	delete(rr.Meta, metaWeight)
+	delete(rr.Meta, metaCountries)
+	delete(rr.Meta, metaContinents)
+	if r.weighted {
+		if rr.Meta == nil {
+			rr.Meta = map[string]any{}
+		}
+		rr.Meta[metaWeight] = r.weight
+	}
+	if len(r.countries) > 0 {
+		rr.AddMeta(dns.NewResourceMetaCountries(r.countries...))
+	}
+	if len(r.continents) > 0 {
+		rr.AddMeta(dns.NewResourceMetaContinents(r.continents...))
+	}
+}
+
+// routingFilters returns filter chain of RRSet serving records according to their routing meta:
+// geodns picks records of the client's country or continent, weighted_shuffle with first_n
+// answers one record chosen by weight
+func routingFilters(records []dns.ResourceRecord) []dns.RecordFilter {
+	geo, weighted := false, false
+	for _, rr := range records {
+		r := recordRouting(rr)
+		geo = geo || len(r.countries) > 0 || len(r.continents) > 0
+		weighted = weighted || r.weighted
+	}
+	var filters []dns.RecordFilter
+	if geo {
+		filters = append(filters, dns.NewGeoDNSFilter(0, false))
+	}
+	if weighted {
+		filters = append(filters, dns.RecordFilter{Type: filterWeightedShuffle}, dns.NewFirstNFilter(1, false))
+	}
+	return filters
+}
+
+// findRoutingChange reports whether routing properties of update differ from the existing endpoint
+func (p *DnsProvider) findRoutingChange(ctx context.Context, update *endpoint.Endpoint, existingEndpoints []*endpoint.Endpoint) bool {
+	var existing *endpoint.Endpoint
+	for _, ex := range existingEndpoints {
+		if !sameRecordSet(ex, update) {
+			continue
+		}
+		existing = ex
+	}
+	if existing == nil {
+		return false
+	}
+	was, _ := routingOf(existing)
+	now, _ := routingOf(update)
+	if reflect.DeepEqual(was, now) {
+		return false
+	}
+
+	msg := fmt.Sprintf("for update-routing %s %s %s %v", update.DNSName, update.RecordType, update.SetIdentifier, update.ProviderSpecific)
+	logger := log.Logger(ctx)
+	if p.dryRun {
+		logger.WithField(log.DryRunKey, true).Info(msg)
+	} else {
+		logger.Debug(msg)
+	}
+	return true
+}
+
+// applyRouting writes routing of e to meta of its records and rebuilds filters of RRSet from meta of all records
+func (p *DnsProvider) applyRouting(ctx context.Context, acc *account, zone string, e *endpoint.Endpoint) error {
+	r, err := routingOf(e)
+	if err != nil {
+		return err
+	}
+	set, err := acc.client.RRSet(ctx, zone, e.DNSName, e.RecordType)
+	if err != nil {
+		if apiErr := new(dns.APIError); errors.As(err, apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to get rrset to apply routing: %w", err)
+	}
+	changed := false
+	for i := range set.Records {
+		if recordSetIdentifier(set.Records[i]) != e.SetIdentifier || reflect.DeepEqual(recordRouting(set.Records[i]), r) {
+			continue
+		}
+		r.apply(&set.Records[i])
+		changed = true
+	}
+	if filters := routingFilters(set.Records); !slices.Equal(filters, set.Filters) {
+		set.Filters = filters
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if err = acc.client.UpdateRRSet(ctx, zone, e.DNSName, e.RecordType, set); err != nil {
+		return fmt.Errorf("failed to apply routing: %w", err)
+	}
+	return nil
+}
+
+// addRecords adds records of e to its RRSet. Records of RRSet shared with other SetIdentifiers are merged
+// with the existing ones, so routing meta and filters rebuilt from all records are written in one request
+// and the RRSet never serves routed records without their filters. Records the RRSet already has aren't added again.
+func (p *DnsProvider) addRecords(ctx context.Context, acc *account, zone string, e *endpoint.Endpoint, records []dns.ResourceRecord) error {
+	if !p.sharedRRSet(e) {
+		return p.addZoneRRSet(ctx, acc, zone, e, records)
+	}
+	set, err := acc.client.RRSet(ctx, zone, e.DNSName, e.RecordType)
+	if err != nil {
+		if apiErr := new(dns.APIError); errors.As(err, apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return p.addZoneRRSet(ctx, acc, zone, e, records)
+		}
+		return fmt.Errorf("rrset: %w", err)
+	}
+	r, err := routingOf(e)
+	if err != nil {
+		return err
+	}
+	for i := range set.Records {
+		if recordSetIdentifier(set.Records[i]) == e.SetIdentifier {
+			r.apply(&set.Records[i])
+		}
+	}
+	for _, rr := range records {
+		exists := slices.ContainsFunc(set.Records, func(ex dns.ResourceRecord) bool {
+			return recordSetIdentifier(ex) == e.SetIdentifier && ex.ContentToString() == rr.ContentToString()
+		})
+		if !exists {
+			set.Records = append(set.Records, rr)
+		}
+	}
+	set.TTL = int(e.RecordTTL)
+	set.Filters = routingFilters(set.Records)
+	return acc.client.UpdateRRSet(ctx, zone, e.DNSName, e.RecordType, set)
+}
+
+// addZoneRRSet adds records to RRSet of e with filters serving their routing
+func (p *DnsProvider) addZoneRRSet(ctx context.Context, acc *account, zone string, e *endpoint.Endpoint, records []dns.ResourceRecord) error {
+	var opts []dns.AddZoneOpt
+	if filters := routingFilters(records); len(filters) > 0 {
+		opts = append(opts, dns.WithFilters(filters...))
+	}
+	return acc.client.AddZoneRRSet(ctx, zone, e.DNSName, e.RecordType, records, int(e.RecordTTL), opts...)
+}
@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func Test_routingOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		props   map[string]string
+		want    routing
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "weight", props: map[string]string{WeightProperty: " 10 "}, want: routing{weighted: true, weight: 10}},
+		{name: "zero weight", props: map[string]string{WeightProperty: "0"}, want: routing{weighted: true}},
+		{
+			name:  "geo",
+			props: map[string]string{CountriesProperty: "us, ca,US", ContinentsProperty: "eu"},
+			want:  routing{countries: []string{"CA", "US"}, continents: []string{"EU"}},
+		},
+		{name: "negative weight", props: map[string]string{WeightProperty: "-1"}, wantErr: true},
+		{name: "bad country", props: map[string]string{CountriesProperty: "USA"}, wantErr: true},
+		{name: "bad continent", props: map[string]string{ContinentsProperty: "XX"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")
+			for k, v := range tt.props {
+				e.SetProviderSpecificProperty(k, v)
+			}
+			got, err := routingOf(e)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("routingOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routingOf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateRouting_setIdentifier(t *testing.T) {
+	e := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1").WithProviderSpecific(WeightProperty, "10")
+	if err := validateRouting(e); err == nil {
+		t.Errorf("validateRouting() without set identifier error = nil")
+	}
+	if err := validateRouting(e.WithSetIdentifier("eu")); err != nil {
+		t.Errorf("validateRouting() error = %v", err)
+	}
+}
+
+func Test_routing_roundTrip(t *testing.T) {
+	e := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1").WithSetIdentifier("eu").
+		WithProviderSpecific(WeightProperty, "10").
+		WithProviderSpecific(CountriesProperty, "de,fr").
+		WithProviderSpecific(ContinentsProperty, "EU")
+	r, err := routingOf(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := dns.ResourceRecord{Content: []any{"1.1.1.1"}}
+	r.apply(&rr)
+	// meta as decoded from API response
+	decoded := dns.ResourceRecord{Meta: map[string]any{
+		metaWeight:     float64(10),
+		metaCountries:  []any{"DE", "FR"},
+		metaContinents: []any{"EU"},
+	}}
+	for _, got := range []routing{recordRouting(rr), recordRouting(decoded)} {
+		if !reflect.DeepEqual(got, r) {
+			t.Errorf("recordRouting() = %+v, want %+v", got, r)
+		}
+	}
+
+	r.apply(&rr)
+	routing{}.apply(&rr)
+	if len(rr.Meta) != 0 {
+		t.Errorf("apply() of empty routing left meta %v", rr.Meta)
+	}
+}
+
+func Test_routingFilters(t *testing.T) {
+	weighted := dns.ResourceRecord{Meta: map[string]any{metaWeight: 10}}
+	geo := dns.ResourceRecord{Meta: map[string]any{metaContinents: []string{"EU"}}}
+	plain := dns.ResourceRecord{}
+
+	tests := []struct {
+		name    string
+		records []dns.ResourceRecord
+		want    []dns.RecordFilter
+	}{
+		{name: "plain", records: []dns.ResourceRecord{plain}},
+		{name: "geo", records: []dns.ResourceRecord{geo, plain}, want: []dns.RecordFilter{dns.NewGeoDNSFilter(0, false)}},
+		{
+			name:    "weighted",
+			records: []dns.ResourceRecord{weighted},
+			want:    []dns.RecordFilter{{Type: filterWeightedShuffle}, dns.NewFirstNFilter(1, false)},
+		},
+		{
+			name:    "geo and weighted",
+			records: []dns.ResourceRecord{weighted, geo},
+			want:    []dns.RecordFilter{dns.NewGeoDNSFilter(0, false), {Type: filterWeightedShuffle}, dns.NewFirstNFilter(1, false)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routingFilters(tt.records); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routingFilters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dnsProvider_applyRouting(t *testing.T) {
+	var updated *dns.RRSet
+	client := &clientMock{
+		rrSet: func(context.Context, string, string, string) (dns.RRSet, error) {
+			return dns.RRSet{TTL: 60, Records: []dns.ResourceRecord{
+				identifierRecord("1.1.1.1", "eu", true),
+				identifierRecord("2.2.2.2", "us", true),
+			}}, nil
+		},
+		updateRRSet: func(_ context.Context, _, _, _ string, set dns.RRSet) error {
+			updated = &set
+			return nil
+		},
+	}
+	p := &DnsProvider{}
+	acc := newAccount(DefaultAccountAlias, client, nil)
+	e := endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1").WithSetIdentifier("eu").WithProviderSpecific(ContinentsProperty, "EU")
+
+	if err := p.applyRouting(context.Background(), acc, "example.com", e); err != nil {
+		t.Fatalf("applyRouting() error = %v", err)
+	}
+	if updated == nil {
+		t.Fatal("applyRouting() didn't update rrset")
+	}
+	if got := recordRouting(updated.Records[0]); !reflect.DeepEqual(got.continents, []string{"EU"}) {
+		t.Errorf("routing of eu record = %+v", got)
+	}
+	if got := recordRouting(updated.Records[1]); !got.empty() {
+		t.Errorf("routing of us record = %+v, want empty", got)
+	}
+	if !reflect.DeepEqual(updated.Filters, []dns.RecordFilter{dns.NewGeoDNSFilter(0, false)}) {
+		t.Errorf("filters = %v", updated.Filters)
+	}
+}
+
+func Test_dnsProvider_sendCreates_sharedRouting(t *testing.T) {
+	var updated *dns.RRSet
+	client := &clientMock{
+		rrSet: func(context.Context, string, string, string) (dns.RRSet, error) {
+			us := identifierRecord("2.2.2.2", "us", true)
+			us.Meta[metaWeight] = float64(10)
+			return dns.RRSet{TTL: 60, Records: []dns.ResourceRecord{identifierRecord("1.1.1.1", "eu", true), us}}, nil
+		},
+		addZoneRRSet: func(context.Context, string, string, string, []dns.ResourceRecord, int, ...dns.AddZoneOpt) error {
+			t.Fatal("AddZoneRRSet replaces filters of shared rrset")
+			return nil
+		},
+		updateRRSet: func(_ context.Context, _, _, _ string, set dns.RRSet) error {
+			if updated != nil {
+				t.Fatal("rrset is updated twice")
+			}
+			updated = &set
+			return nil
+		},
+	}
+	p := &DnsProvider{}
+	acc := newAccount(DefaultAccountAlias, client, nil)
+	e := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "3.3.3.3").WithSetIdentifier("eu").WithProviderSpecific(WeightProperty, "5")
+	records, err := p.newRecords(e, e.Targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.sendCreates(context.Background(), acc, "example.com", e, records); err != nil {
+		t.Fatalf("sendCreates() error = %v", err)
+	}
+	if updated == nil {
+		t.Fatal("sendCreates() didn't update rrset")
+	}
+	var got []string
+	for _, rr := range updated.Records {
+		got = append(got, rr.ContentToString()+" "+recordSetIdentifier(rr)+" "+strconv.Itoa(recordRouting(rr).weight))
+	}
+	// existing record of eu isn't added again and gets the weight of eu
+	if want := []string{"1.1.1.1 eu 5", "2.2.2.2 us 10", "3.3.3.3 eu 5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	if want := routingFilters(updated.Records); len(want) == 0 || !reflect.DeepEqual(updated.Filters, want) {
+		t.Errorf("filters = %v, want %v", updated.Filters, want)
+	}
+}
@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	ENV_RRSET_CACHE_MAX_AGE = "EC_RRSET_CACHE_MAX_AGE"
+
+	// DefaultRRSetCacheMaxAge disables the cache: zone records don't tell enabled flags and meta of RRSets,
+	// so a cached RRSet misses their changes made bypassing the webhook until it expires
+	DefaultRRSetCacheMaxAge time.Duration = 0
+)
+
+// rrsetFetchConcurrency limits parallel requests of RRSets made by Records
+const rrsetFetchConcurrency = 8
+
+// WithRRSetCacheMaxAge sets how long Records reuses a fetched RRSet while its zone record is unchanged,
+// zero makes Records fetch every RRSet on each call. Enabled flags, meta and notes changed bypassing
+// the webhook stay unseen until the cached RRSet expires.
+func WithRRSetCacheMaxAge(maxAge time.Duration) Option {
+	return func(p *DnsProvider) {
+		p.rrsetCacheMaxAge = maxAge
+	}
+}
+
+// cachedRRSet is a RRSet fetched for a zone record with fingerprint
+type cachedRRSet struct {
+	fingerprint string
+	set         dns.RRSet
+	// found is false if RRSet of the zone record doesn't exist
+	found   bool
+	expires time.Time
+}
+
+// rrsetCache keeps RRSets of an account fetched by Records. Zone records carry short answers only,
+// so RRSet is fetched again once its zone record changes, it is written through the account or the entry expires.
+type rrsetCache struct {
+	mu      sync.Mutex
+	entries map[rrsetKey]cachedRRSet
+	// generation changes on every write, so RRSet fetched concurrently with a write isn't cached
+	generation uint64
+}
+
+func newRRSetCache() *rrsetCache {
+	return &rrsetCache{entries: make(map[rrsetKey]cachedRRSet)}
+}
+
+// recordFingerprint changes whenever TTL or answers of zone record change, zone records carry neither
+// enabled flags nor meta, so their changes made bypassing the webhook aren't seen until the entry expires
+func recordFingerprint(r dns.ZoneRecord) string {
+	answers := slices.Clone(r.ShortAnswers)
+	slices.Sort(answers)
+	return fmt.Sprintf("%d\n%s", r.TTL, strings.Join(answers, "\n"))
+}
+
+// get returns cached RRSet matching fingerprint, or the generation to put the fetched RRSet with
+func (c *rrsetCache) get(key rrsetKey, fingerprint string, now time.Time) (cachedRRSet, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.fingerprint != fingerprint || !now.Before(e.expires) {
+		return cachedRRSet{}, c.generation, false
+	}
+	return e, c.generation, true
+}
+
+// put caches RRSet fetched at generation, unless it was written since
+func (c *rrsetCache) put(key rrsetKey, e cachedRRSet, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		c.entries[key] = e
+	}
+}
+
+func (c *rrsetCache) invalidate(name, recordType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.entries, newRRSetKey(name, recordType))
+}
+
+// fetchRRSets returns RRSets of zone records, zone records have short answers only.
+// Cached RRSets are reused, any failed request except missing RRSet fails the whole fetch,
+// as Records built from partial RRSets would lose disabled records, SetIdentifiers and ownership.
+func (p *DnsProvider) fetchRRSets(ctx context.Context, zones []accountZone) (map[rrsetKey]dns.RRSet, error) {
+	res := make(map[rrsetKey]dns.RRSet)
+	var mu sync.Mutex
+	now := time.Now()
+
+	gr, grCtx := errgroup.WithContext(ctx)
+	gr.SetLimit(rrsetFetchConcurrency)
+	for _, z := range zones {
+		for _, r := range z.Records {
+			if !supportedRecordType(r.Type) {
+				continue
+			}
+			key := newRRSetKey(r.Name, r.Type)
+			fingerprint := recordFingerprint(r)
+			cached, generation, ok := z.account.rrsets.get(key, fingerprint, now)
+			if ok {
+				if cached.found {
+					res[key] = cached.set
+				}
+				continue
+			}
+			gr.Go(func() error {
+				set, err := z.account.client.RRSet(grCtx, z.Name, r.Name, r.Type)
+				found := err == nil
+				if apiErr := new(dns.APIError); err != nil && (!errors.As(err, apiErr) || apiErr.StatusCode != http.StatusNotFound) {
+					return fmt.Errorf("failed to get %s rrset %s of account %s: %w", r.Type, r.Name, z.account.alias, err)
+				}
+				if p.rrsetCacheMaxAge > 0 {
+					// jitter spreads refetching of RRSets cached by the same Records call
+					expires := now.Add(p.rrsetCacheMaxAge + rand.N(p.rrsetCacheMaxAge/2+1))
+					z.account.rrsets.put(key, cachedRRSet{fingerprint: fingerprint, set: set, found: found, expires: expires}, generation)
+				}
+				if !found {
+					return nil
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				res[key] = set
+				return nil
+			})
+		}
+	}
+	if err := gr.Wait(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// cachingClient drops cached RRSets written through the client, so Records doesn't serve stale meta
+// and disabled records after ApplyChanges changes them without changing zone records
+type cachingClient struct {
+	cache *rrsetCache
+	next  DnsClient
+}
+
+func (c *cachingClient) AddZoneRRSet(ctx context.Context,
+	zone, recordName, recordType string,
+	values []dns.ResourceRecord, ttl int, opts ...dns.AddZoneOpt) error {
+	defer c.cache.invalidate(recordName, recordType)
+	return c.next.AddZoneRRSet(ctx, zone, recordName, recordType, values, ttl, opts...)
+}
+
+func (c *cachingClient) ZonesWithRecords(ctx context.Context, filters ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+	return c.next.ZonesWithRecords(ctx, filters...)
+}
+
+func (c *cachingClient) DeleteRRSetRecord(ctx context.Context, zone, name, recordType string, contents ...string) error {
+	defer c.cache.invalidate(name, recordType)
+	return c.next.DeleteRRSetRecord(ctx, zone, name, recordType, contents...)
+}
+
+func (c *cachingClient) DeleteRRSet(ctx context.Context, zone, name, recordType string) error {
+	defer c.cache.invalidate(name, recordType)
+	return c.next.DeleteRRSet(ctx, zone, name, recordType)
+}
+
+func (c *cachingClient) CreateZone(ctx context.Context, name string) (uint64, error) {
+	return c.next.CreateZone(ctx, name)
+}
+
+func (c *cachingClient) RRSet(ctx context.Context, zone, name, recordType string) (dns.RRSet, error) {
+	return c.next.RRSet(ctx, zone, name, recordType)
+}
+
+func (c *cachingClient) UpdateRRSet(ctx context.Context, zone, name, recordType string, record dns.RRSet) error {
+	defer c.cache.invalidate(name, recordType)
+	return c.next.UpdateRRSet(ctx, zone, name, recordType, record)
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+)
+
+func Test_dnsProvider_Records_rrsetCache(t *testing.T) {
+	answers := []string{"1.1.1.1"}
+	var fetched atomic.Int32
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com", Records: []dns.ZoneRecord{
+				{Name: "www.example.com", Type: "A", TTL: 300, ShortAnswers: answers},
+			}}}, nil
+		},
+		rrSet: func(context.Context, string, string, string) (dns.RRSet, error) {
+			fetched.Add(1)
+			return dns.RRSet{Records: []dns.ResourceRecord{{Content: []any{"1.1.1.1"}, Enabled: true}}}, nil
+		},
+		updateRRSet: func(context.Context, string, string, string, dns.RRSet) error {
+			return nil
+		},
+	}
+	acc := newAccount(DefaultAccountAlias, client, nil)
+	p := &DnsProvider{accounts: []*account{acc}, rrsetCacheMaxAge: time.Hour}
+
+	records := func(wantFetched int32) {
+		t.Helper()
+		if _, err := p.Records(context.Background()); err != nil {
+			t.Fatalf("Records() error = %v", err)
+		}
+		if got := fetched.Load(); got != wantFetched {
+			t.Errorf("fetched %d rrsets, want %d", got, wantFetched)
+		}
+	}
+	records(1)
+	records(1)
+
+	// written through the webhook
+	if err := acc.client.UpdateRRSet(context.Background(), "example.com", "www.example.com", "A", dns.RRSet{}); err != nil {
+		t.Fatal(err)
+	}
+	records(2)
+
+	// changed out-of-band
+	answers = []string{"2.2.2.2"}
+	records(3)
+	records(3)
+}
+
+func Test_dnsProvider_Records_rrsetError(t *testing.T) {
+	client := &clientMock{
+		zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+			return []dns.Zone{{Name: "example.com", Records: []dns.ZoneRecord{
+				{Name: "www.example.com", Type: "A", TTL: 300, ShortAnswers: []string{"1.1.1.1"}},
+				{Name: "api.example.com", Type: "A", TTL: 300, ShortAnswers: []string{"1.1.1.2"}},
+			}}}, nil
+		},
+		rrSet: func(_ context.Context, _, name, _ string) (dns.RRSet, error) {
+			if name == "api.example.com" {
+				return dns.RRSet{}, dns.APIError{StatusCode: http.StatusNotFound}
+			}
+			return dns.RRSet{}, dns.APIError{StatusCode: http.StatusTooManyRequests}
+		},
+	}
+	p := &DnsProvider{accounts: []*account{newAccount(DefaultAccountAlias, client, nil)}}
+	if _, err := p.Records(context.Background()); err == nil {
+		t.Error("Records() expected error of failed rrset request")
+	}
+}
@@ -0,0 +1,222 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// setIdentifierNotePrefix starts a note with SetIdentifier of external-dns endpoint the record belongs to,
+// it lets several clusters publish their own targets of the same name and type in one RRSet
+const setIdentifierNotePrefix = "external-dns/set-identifier="
+
+func isSetIdentifierNote(note string) bool {
+	return strings.HasPrefix(note, setIdentifierNotePrefix)
+}
+
+// recordSetIdentifier returns SetIdentifier of the endpoint the record belongs to, it's empty for untagged records
+func recordSetIdentifier(rr dns.ResourceRecord) string {
+	for _, n := range recordNotes(rr) {
+		if isSetIdentifierNote(n) {
+			return strings.TrimPrefix(n, setIdentifierNotePrefix)
+		}
+	}
+	return ""
+}
+
+// tagSetIdentifier marks records which are about to be added with SetIdentifier of e
+func tagSetIdentifier(e *endpoint.Endpoint, records []dns.ResourceRecord) {
+	if e.SetIdentifier == "" {
+		return
+	}
+	for i := range records {
+		setRecordNotes(&records[i], replaceNote(recordNotes(records[i]), isSetIdentifierNote, setIdentifierNotePrefix+e.SetIdentifier))
+	}
+}
+
+// hasSetIdentifiers reports whether some records of RRSet belong to endpoints with SetIdentifier
+func hasSetIdentifiers(set dns.RRSet) bool {
+	for _, rr := range set.Records {
+		if recordSetIdentifier(rr) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// recordGroup are records of RRSet belonging to one SetIdentifier
+type recordGroup struct {
+	setIdentifier string
+	records       []dns.ResourceRecord
+}
+
+// groupBySetIdentifier splits RRSet records by SetIdentifier, untagged records go first
+func groupBySetIdentifier(set dns.RRSet) []recordGroup {
+	byID := make(map[string]*recordGroup)
+	var ids []string
+	for _, rr := range set.Records {
+		id := recordSetIdentifier(rr)
+		g, ok := byID[id]
+		if !ok {
+			g = &recordGroup{setIdentifier: id}
+			byID[id] = g
+			ids = append(ids, id)
+		}
+		g.records = append(g.records, rr)
+	}
+	sort.Strings(ids)
+	res := make([]recordGroup, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, *byID[id])
+	}
+	return res
+}
+
+// sharedRRSet reports whether RRSet of e may have records of other SetIdentifiers,
+// so its targets must be deleted without touching records of other endpoints
+func (p *DnsProvider) sharedRRSet(e *endpoint.Endpoint) bool {
+	if e.SetIdentifier != "" {
+		return true
+	}
+	snapshot := p.snapshot.Load()
+	if snapshot == nil {
+		return false
+	}
+	_, ok := snapshot.shared[newRRSetKey(e.DNSName, e.RecordType)]
+	return ok
+}
+
+// adjustSharedTTL keeps TTL of RRSet shared with records of other SetIdentifiers. TTL belongs to the whole RRSet,
+// so endpoints of several clusters desiring different TTLs would overwrite each other's TTL on every sync.
+func adjustSharedTTL(e *endpoint.Endpoint, shared map[rrsetKey]sharedRRSet) {
+	if e.SetIdentifier == "" {
+		return
+	}
+	s, ok := shared[newRRSetKey(toASCII(e.DNSName), e.RecordType)]
+	if !ok || s.ttl == e.RecordTTL || !slices.ContainsFunc(s.setIdentifiers, func(id string) bool { return id != e.SetIdentifier }) {
+		return
+	}
+	log.Logger(context.Background()).WithField(log.DNSNameKey, e.DNSName).
+		Debugf("TTL %d of %s is kept, the rrset is shared with other set identifiers", s.ttl, e.SetIdentifier)
+	e.RecordTTL = s.ttl
+}
+
+// deleteTargets deletes targets of e, only records of e.SetIdentifier are deleted from shared RRSets
+// and their filters are rebuilt from routing of the records left. The snapshot may be older than the RRSet,
+// so the RRSet is read to find records of other SetIdentifiers before deleting by content.
+func (p *DnsProvider) deleteTargets(ctx context.Context, acc *account, zone string, e *endpoint.Endpoint, targets endpoint.Targets) error {
+	contents := contentStrings(e.RecordType, targets)
+	set, err := acc.client.RRSet(ctx, zone, e.DNSName, e.RecordType)
+	notFound := false
+	if err != nil {
+		if apiErr := new(dns.APIError); !errors.As(err, apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("rrset: %w", err)
+		}
+		notFound = true
+	}
+	if !p.sharedRRSet(e) && !hasSetIdentifiers(set) {
+		return acc.client.DeleteRRSetRecord(ctx, zone, e.DNSName, e.RecordType, contents...)
+	}
+	if notFound {
+		return nil
+	}
+	kept := make([]dns.ResourceRecord, 0, len(set.Records))
+	for _, rr := range set.Records {
+		if recordSetIdentifier(rr) == e.SetIdentifier && slices.Contains(contents, rr.ContentToString()) {
+			continue
+		}
+		kept = append(kept, rr)
+	}
+	switch {
+	case len(kept) == len(set.Records):
+		return nil
+	case len(kept) == 0:
+		return acc.client.DeleteRRSet(ctx, zone, e.DNSName, e.RecordType)
+	}
+	set.Records = kept
+	set.Filters = routingFilters(kept)
+	return acc.client.UpdateRRSet(ctx, zone, e.DNSName, e.RecordType, set)
+}
+
+// sameRecordSet reports whether endpoints have the same name, type and SetIdentifier
+func sameRecordSet(a, b *endpoint.Endpoint) bool {
+	return a.RecordType == b.RecordType && a.SetIdentifier == b.SetIdentifier && sameName(a.DNSName, b.DNSName)
+}
+
+// recordEndpoints returns endpoints of zone record r, RRSet with records of several SetIdentifiers
+// becomes one endpoint per SetIdentifier with routing read from meta of its records.
+// Disabled targets are marked on the endpoints they belong to. set is empty only if the RRSet doesn't exist
+// anymore, failed requests of RRSets fail Records, as a shared RRSet must never collapse into one endpoint.
+func recordEndpoints(r dns.ZoneRecord, set dns.RRSet, disabled disabledTargets) []*endpoint.Endpoint {
+	key := newRRSetKey(r.Name, r.Type)
+	if !hasSetIdentifiers(set) {
+		targets := make([]string, 0, len(r.ShortAnswers))
+		for _, a := range r.ShortAnswers {
+			targets = append(targets, formatAnswer(r.Type, a))
+		}
+		e := endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), targets...)
+		markDisabled(e, disabled[key])
+		return []*endpoint.Endpoint{e}
+	}
+
+	groups := groupBySetIdentifier(set)
+	res := make([]*endpoint.Endpoint, 0, len(groups))
+	for _, g := range groups {
+		targets := make([]string, 0, len(g.records))
+		for _, rr := range g.records {
+			targets = append(targets, formatAnswer(r.Type, rr.ContentToString()))
+		}
+		e := endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), targets...).WithSetIdentifier(g.setIdentifier)
+		recordRouting(g.records[0]).setProperties(e)
+		markDisabled(e, disabled[key.withSetIdentifier(g.setIdentifier)])
+		res = append(res, e)
+	}
+	return res
+}
+
+// rrsetLocks serializes changes of one RRSet, endpoints of several SetIdentifiers read and write
+// the same RRSet and concurrent changes would overwrite each other
+type rrsetLocks struct {
+	mu    sync.Mutex
+	locks map[rrsetKey]*rrsetLock
+}
+
+type rrsetLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks RRSet of name and type, returned func unlocks it
+func (l *rrsetLocks) lock(name, recordType string) (unlock func()) {
+	key := newRRSetKey(name, recordType)
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[rrsetKey]*rrsetLock)
+	}
+	lk, ok := l.locks[key]
+	if !ok {
+		lk = &rrsetLock{}
+		l.locks[key] = lk
+	}
+	lk.refs++
+	l.mu.Unlock()
+
+	lk.Lock()
+	return func() {
+		lk.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if lk.refs--; lk.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func identifierRecord(content, setIdentifier string, enabled bool) dns.ResourceRecord {
+	rr := dns.ResourceRecord{Content: []any{content}, Enabled: enabled, Meta: map[string]any{}}
+	if setIdentifier != "" {
+		rr.Meta[metaNotes] = []any{"added by hand", setIdentifierNotePrefix + setIdentifier}
+	}
+	return rr
+}
+
+func Test_recordEndpoints(t *testing.T) {
+	r := dns.ZoneRecord{Name: "www.example.com", Type: "A", TTL: 60, ShortAnswers: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}}
+	set := dns.RRSet{Records: []dns.ResourceRecord{
+		identifierRecord("2.2.2.2", "us", true),
+		identifierRecord("1.1.1.1", "eu", true),
+		identifierRecord("3.3.3.3", "", true),
+		identifierRecord("4.4.4.4", "eu", false),
+	}}
+	rrsets := map[rrsetKey]dns.RRSet{newRRSetKey(r.Name, r.Type): set}
+
+	got := recordEndpoints(r, set, findDisabledTargets(rrsets))
+	eu := endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "4.4.4.4").WithSetIdentifier("eu")
+	eu.SetProviderSpecificProperty(DisabledTargetsProperty, `["4.4.4.4"]`)
+	want := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "3.3.3.3"),
+		eu,
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "2.2.2.2").WithSetIdentifier("us"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recordEndpoints() = %v, want %v", got, want)
+	}
+
+	// RRSets without SetIdentifiers keep short answers
+	got = recordEndpoints(r, dns.RRSet{}, nil)
+	if len(got) != 1 || got[0].String() != endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1", "2.2.2.2", "3.3.3.3").String() {
+		t.Errorf("recordEndpoints() without identifiers = %v", got)
+	}
+}
+
+func Test_tagSetIdentifier(t *testing.T) {
+	records := []dns.ResourceRecord{identifierRecord("1.1.1.1", "old", true)}
+	tagSetIdentifier(endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1").WithSetIdentifier("eu"), records)
+	if got := recordSetIdentifier(records[0]); got != "eu" {
+		t.Errorf("recordSetIdentifier() = %v, want eu", got)
+	}
+	if got := recordNotes(records[0]); !reflect.DeepEqual(got, []string{"added by hand", setIdentifierNotePrefix + "eu"}) {
+		t.Errorf("notes = %v", got)
+	}
+}
+
+func Test_dnsProvider_deleteTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		e       *endpoint.Endpoint
+		records []dns.ResourceRecord
+		// unshared makes the snapshot tell the RRSet has no SetIdentifiers
+		unshared    bool
+		wantUpdated []string
+		wantDeleted bool
+	}{
+		{
+			name: "keeps records of other identifiers with the same content",
+			e:    endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1").WithSetIdentifier("eu"),
+			records: []dns.ResourceRecord{
+				identifierRecord("1.1.1.1", "eu", true),
+				identifierRecord("1.1.1.1", "us", true),
+				identifierRecord("2.2.2.2", "", true),
+			},
+			wantUpdated: []string{"1.1.1.1", "2.2.2.2"},
+		},
+		{
+			name:    "keeps records of identifiers for endpoint without identifier",
+			e:       endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1", "2.2.2.2"),
+			records: []dns.ResourceRecord{identifierRecord("1.1.1.1", "eu", true), identifierRecord("2.2.2.2", "", true)},
+			// RRSet is shared according to the last Records call
+			wantUpdated: []string{"1.1.1.1"},
+		},
+		{
+			name:     "keeps records of identifiers added after the snapshot",
+			e:        endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1"),
+			records:  []dns.ResourceRecord{identifierRecord("1.1.1.1", "eu", true), identifierRecord("1.1.1.1", "", true)},
+			unshared: true,
+			// deleting by content would delete the record of eu too
+			wantUpdated: []string{"1.1.1.1"},
+		},
+		{
+			name:        "deletes RRSet without records left",
+			e:           endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1").WithSetIdentifier("eu"),
+			records:     []dns.ResourceRecord{identifierRecord("1.1.1.1", "eu", true)},
+			wantDeleted: true,
+		},
+		{
+			name:    "nothing to delete",
+			e:       endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1").WithSetIdentifier("us"),
+			records: []dns.ResourceRecord{identifierRecord("1.1.1.1", "eu", true)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated []string
+			deleted := false
+			client := &clientMock{
+				rrSet: func(context.Context, string, string, string) (dns.RRSet, error) {
+					return dns.RRSet{TTL: 60, Records: tt.records}, nil
+				},
+				updateRRSet: func(_ context.Context, _, _, _ string, set dns.RRSet) error {
+					for _, rr := range set.Records {
+						updated = append(updated, rr.ContentToString())
+					}
+					return nil
+				},
+				deleteRRSet: func(context.Context, string, string, string) error {
+					deleted = true
+					return nil
+				},
+				deleteRRSetRecord: func(context.Context, string, string, string, ...string) error {
+					t.Fatal("DeleteRRSetRecord is called for shared RRSet")
+					return nil
+				},
+			}
+			p := &DnsProvider{}
+			if !tt.unshared {
+				p.snapshot.Store(&rrsetSnapshot{shared: map[rrsetKey]sharedRRSet{newRRSetKey("www.example.com", "A"): {ttl: 300, setIdentifiers: []string{"eu"}}}})
+			}
+			acc := newAccount(DefaultAccountAlias, client, nil)
+
+			if err := p.deleteTargets(context.Background(), acc, "example.com", tt.e, tt.e.Targets); err != nil {
+				t.Fatalf("deleteTargets() error = %v", err)
+			}
+			if !reflect.DeepEqual(updated, tt.wantUpdated) {
+				t.Errorf("deleteTargets() updated = %v, want %v", updated, tt.wantUpdated)
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("deleteTargets() deleted rrset = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func Test_adjustSharedTTL(t *testing.T) {
+	shared := map[rrsetKey]sharedRRSet{
+		newRRSetKey("www.example.com", "A"): {ttl: 300, setIdentifiers: []string{"eu", "us"}},
+		newRRSetKey("api.example.com", "A"): {ttl: 300, setIdentifiers: []string{"eu"}},
+	}
+	tests := []struct {
+		name string
+		e    *endpoint.Endpoint
+		want endpoint.TTL
+	}{
+		{name: "shared with other clusters", e: endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1").WithSetIdentifier("eu"), want: 300},
+		{name: "joining shared rrset", e: endpoint.NewEndpointWithTTL("api.example.com", "A", 60, "1.1.1.1").WithSetIdentifier("us"), want: 300},
+		{name: "the only set identifier", e: endpoint.NewEndpointWithTTL("api.example.com", "A", 60, "1.1.1.1").WithSetIdentifier("eu"), want: 60},
+		{name: "new rrset", e: endpoint.NewEndpointWithTTL("new.example.com", "A", 60, "1.1.1.1").WithSetIdentifier("eu"), want: 60},
+		{name: "no set identifier", e: endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1"), want: 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adjustSharedTTL(tt.e, shared)
+			if tt.e.RecordTTL != tt.want {
+				t.Errorf("TTL = %d, want %d", tt.e.RecordTTL, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findRecordsToDelete_setIdentifier(t *testing.T) {
+	p := &DnsProvider{}
+	existing := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1").WithSetIdentifier("eu"),
+		endpoint.NewEndpoint("www.example.com", "A", "2.2.2.2").WithSetIdentifier("us"),
+	}
+	update := endpoint.NewEndpoint("www.example.com", "A", "3.3.3.3").WithSetIdentifier("eu")
+	got := p.findRecordsToDelete(context.Background(), update, existing)
+	if !reflect.DeepEqual(got, endpoint.Targets{"1.1.1.1"}) {
+		t.Errorf("findRecordsToDelete() = %v, want [1.1.1.1]", got)
+	}
+}
+
+func Test_rrsetLocks(t *testing.T) {
+	var l rrsetLocks
+	var order []string
+	unlock := l.lock("www.example.com.", "A")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer l.lock("WWW.example.com", "A")()
+		order = append(order, "second")
+	}()
+	// wait for the second caller to wait for the lock
+	for waiting := false; !waiting; runtime.Gosched() {
+		l.mu.Lock()
+		waiting = l.locks[newRRSetKey("www.example.com", "A")].refs == 2
+		l.mu.Unlock()
+	}
+	order = append(order, "first")
+	unlock()
+	<-done
+
+	if !reflect.DeepEqual(order, []string{"first", "second"}) {
+		t.Errorf("order = %v, want first, second", order)
+	}
+	if len(l.locks) != 0 {
+		t.Errorf("locks = %v, want released", l.locks)
+	}
+}
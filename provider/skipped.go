@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const ENV_SKIP_POLICY = "EC_SKIP_POLICY"
+
+// SkipPolicy defines how changes which can't be applied are reported
+type SkipPolicy string
+
+const (
+	// SkipPolicyWarn logs skipped changes, ApplyChanges succeeds
+	SkipPolicyWarn SkipPolicy = "warn"
+	// SkipPolicyFail fails ApplyChanges with SkippedChangesError after applying the rest of changes
+	SkipPolicyFail SkipPolicy = "fail"
+)
+
+const (
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+	// actionCreateZone is creation of a zone for created records, it's only audited
+	actionCreateZone = "create-zone"
+	// actionUpdateOwner is writing of ownership to records by the meta registry, it's only audited
+	actionUpdateOwner = "update-owner"
+
+	skipReasonNoZone        = "no such zone"
+	skipReasonDelegated     = "name is in delegated subzone"
+	skipReasonInvalidTarget = "invalid target"
+)
+
+// ParseSkipPolicy parses policy name, empty name means SkipPolicyWarn
+func ParseSkipPolicy(s string) (SkipPolicy, error) {
+	switch SkipPolicy(strings.ToLower(s)) {
+	case "", SkipPolicyWarn:
+		return SkipPolicyWarn, nil
+	case SkipPolicyFail:
+		return SkipPolicyFail, nil
+	}
+	return "", fmt.Errorf("unknown skip policy '%s', expected %s or %s", s, SkipPolicyWarn, SkipPolicyFail)
+}
+
+// WithSkipPolicy sets how changes which can't be applied are reported
+func WithSkipPolicy(policy SkipPolicy) Option {
+	return func(p *DnsProvider) {
+		p.skipPolicy = policy
+	}
+}
+
+// SkippedChange is a change which was not applied
+type SkippedChange struct {
+	Action        string
+	DNSName       string
+	RecordType    string
+	SetIdentifier string
+	Reason        string
+}
+
+func (c SkippedChange) String() string {
+	return fmt.Sprintf("%s %s %s: %s", c.Action, c.DNSName, c.RecordType, c.Reason)
+}
+
+// SkippedChangesError lists every change skipped by ApplyChanges
+type SkippedChangesError struct {
+	Changes []SkippedChange
+}
+
+func (e *SkippedChangesError) Error() string {
+	items := make([]string, 0, len(e.Changes))
+	for _, c := range e.Changes {
+		items = append(items, c.String())
+	}
+	return fmt.Sprintf("%d change(s) skipped: %s", len(e.Changes), strings.Join(items, "; "))
+}
+
+// skippedChanges collects changes skipped during ApplyChanges
+type skippedChanges struct {
+	changes []SkippedChange
+}
+
+func (s *skippedChanges) add(ctx context.Context, action string, e *endpoint.Endpoint, reason string) {
+	log.Logger(ctx).WithField(log.DNSNameKey, e.DNSName).Warningf("%s skipped - %s", action, reason)
+	metrics.SkippedChanges.WithLabelValues(action, reason).Inc()
+	s.changes = append(s.changes, SkippedChange{
+		Action:        action,
+		DNSName:       e.DNSName,
+		RecordType:    e.RecordType,
+		SetIdentifier: e.SetIdentifier,
+		Reason:        reason,
+	})
+}
+
+// err returns error for skipped changes according to policy
+func (s *skippedChanges) err(policy SkipPolicy) error {
+	if len(s.changes) == 0 || policy != SkipPolicyFail {
+		return nil
+	}
+	return &SkippedChangesError{Changes: s.changes}
+}
+
+// changeResults collects records whose changes failed during ApplyChanges, so the rest of changes
+// are treated as applied. applied is called for every change applied successfully.
+type changeResults struct {
+	applied func(action string, e *endpoint.Endpoint)
+
+	mu     sync.Mutex
+	failed map[rrsetKey]bool
+}
+
+// add records result of action on e
+func (r *changeResults) add(action string, e *endpoint.Endpoint, err error) {
+	if err == nil {
+		if r.applied != nil {
+			r.applied(action, e)
+		}
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed == nil {
+		r.failed = make(map[rrsetKey]bool)
+	}
+	r.failed[driftKey(e)] = true
+}
+
+func (r *changeResults) hasFailed(e *endpoint.Endpoint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failed[driftKey(e)]
+}
@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_ParseSkipPolicy(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    SkipPolicy
+		wantErr bool
+	}{
+		{s: "", want: SkipPolicyWarn},
+		{s: "warn", want: SkipPolicyWarn},
+		{s: "FAIL", want: SkipPolicyFail},
+		{s: "ignore", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseSkipPolicy(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSkipPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSkipPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dnsProvider_ApplyChanges_skipPolicy(t *testing.T) {
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1"),
+			endpoint.NewEndpointWithTTL("www.unknown.com", "A", 60, "1.1.1.1"),
+		},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.unknown.com", "A", 60, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.unknown.com", "A", 60, "2.2.2.2")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.unknown.com", "CNAME", 60, "www.unknown.com")},
+	}
+	wantSkipped := []SkippedChange{
+		{Action: actionUpdate, DNSName: "api.unknown.com", RecordType: "A", Reason: skipReasonNoZone},
+		{Action: actionDelete, DNSName: "old.unknown.com", RecordType: "CNAME", Reason: skipReasonNoZone},
+		{Action: actionCreate, DNSName: "www.unknown.com", RecordType: "A", Reason: skipReasonNoZone},
+	}
+
+	for _, policy := range []SkipPolicy{SkipPolicyWarn, SkipPolicyFail} {
+		t.Run(string(policy), func(t *testing.T) {
+			client := &zonesClient{zones: []dns.Zone{{Name: "example.com"}}}
+			p := &DnsProvider{accounts: []*account{newAccount("main", client, nil)}}
+			WithSkipPolicy(policy)(p)
+
+			err := p.ApplyChanges(context.Background(), changes)
+			if !reflect.DeepEqual(client.created, []string{"example.com www.example.com A"}) {
+				t.Errorf("created = %v, changes for known zones must be applied", client.created)
+			}
+			if policy == SkipPolicyWarn {
+				if err != nil {
+					t.Errorf("ApplyChanges() error = %v", err)
+				}
+				return
+			}
+			var skipped *SkippedChangesError
+			if !errors.As(err, &skipped) {
+				t.Fatalf("ApplyChanges() error = %v, want SkippedChangesError", err)
+			}
+			if !reflect.DeepEqual(skipped.Changes, wantSkipped) {
+				t.Errorf("skipped = %v, want %v", skipped.Changes, wantSkipped)
+			}
+		})
+	}
+}
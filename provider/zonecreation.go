@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	ENV_ZONE_CREATION_SUFFIXES = "EC_ZONE_CREATION_SUFFIXES"
+	ENV_ZONE_CREATION_LIMIT    = "EC_ZONE_CREATION_LIMIT"
+
+	DefaultZoneCreationLimit = 5
+)
+
+// zoneCreation is a policy of creating zones missing for changed records
+type zoneCreation struct {
+	suffixes []string
+	limit    int
+}
+
+// WithZoneCreation enables creation of a zone for a record under one of suffixes which matches no existing zone.
+// The zone is created one label below the longest matching suffix, e.g. app.example.com for
+// www.app.example.com and suffix example.com. At most limit zones are created per ApplyChanges.
+func WithZoneCreation(suffixes []string, limit int) Option {
+	return func(p *DnsProvider) {
+		zc := &zoneCreation{limit: limit}
+		for _, s := range suffixes {
+			if s = normalizeZone(s); s != "" {
+				zc.suffixes = append(zc.suffixes, s)
+			}
+		}
+		if len(zc.suffixes) > 0 && limit > 0 {
+			p.zoneCreation = zc
+		}
+	}
+}
+
+// zoneFor returns zone to create for DNS name, it's empty if name isn't under allowed suffixes
+func (zc *zoneCreation) zoneFor(name string) string {
+	name = normalizeZone(name)
+	best := ""
+	for _, s := range zc.suffixes {
+		if strings.HasSuffix(name, "."+s) && len(s) > len(best) {
+			best = s
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	rest := strings.TrimSuffix(name, "."+best)
+	return rest[strings.LastIndex(rest, ".")+1:] + "." + best
+}
+
+// createMissingZones creates zones for created and updated records which have no zone yet.
+// Returned index contains created zones, so records are applied within the same ApplyChanges.
+func (p *DnsProvider) createMissingZones(ctx context.Context, endpoints []*endpoint.Endpoint, zones *zoneIndex) (*zoneIndex, error) {
+	attempted := make(map[string]bool)
+	// only created zones count towards the limit, so failed or dry-run zones don't use it up
+	created := 0
+	var errs []error
+
+	for _, e := range endpoints {
+		if _, _, reason := zones.lookup(e.DNSName, e.RecordType); reason != skipReasonNoZone {
+			continue
+		}
+		zone := p.zoneCreation.zoneFor(e.DNSName)
+		if zone == "" || attempted[zone] {
+			continue
+		}
+		logger := log.Logger(ctx).WithField(log.DNSNameKey, e.DNSName)
+		if created >= p.zoneCreation.limit {
+			logger.Warningf("zone %s is not created - limit of %d zones per apply is reached", zone, p.zoneCreation.limit)
+			continue
+		}
+		attempted[zone] = true
+
+		acc := p.accountForZone(zone)
+		if acc == nil {
+			logger.Warningf("zone %s is not created - no account serves it", zone)
+			continue
+		}
+		logger = logger.WithField(log.AccountKey, acc.alias)
+		if p.dryRun {
+			logger.WithField(log.DryRunKey, true).Infof("for create zone %s", zone)
+			p.writeAudit(ctx, p.newAuditEntry(ctx, acc, zone, actionCreateZone, zone, "", "", nil))
+			continue
+		}
+		_, err := acc.client.CreateZone(ctx, zone)
+		p.writeAudit(ctx, p.newAuditEntry(ctx, acc, zone, actionCreateZone, zone, "", "", err))
+		if err != nil {
+			err = fmt.Errorf("failed to create zone %s: %w", zone, err)
+			logger.Error(err)
+			errs = append(errs, err)
+			continue
+		}
+		created++
+		zones = zones.with(zone, acc)
+		if !zones.partial {
+			p.index.Store(zones)
+		}
+		p.logDelegation(ctx, acc, zone)
+	}
+	return zones, errors.Join(errs...)
+}
+
+// accountForZone returns the first account allowed to serve zone
+func (p *DnsProvider) accountForZone(zone string) *account {
+	for _, acc := range p.accounts {
+		if acc.serves(zone) {
+			return acc
+		}
+	}
+	return nil
+}
+
+// logDelegation logs nameservers the new zone has to be delegated to from its parent
+func (p *DnsProvider) logDelegation(ctx context.Context, acc *account, zone string) {
+	logger := log.Logger(ctx).WithField(log.AccountKey, acc.alias)
+
+	zones, err := acc.client.ZonesWithRecords(ctx, func(f *dns.ZonesFilter) {
+		f.Names = []string{zone}
+	})
+	if err != nil {
+		logger.WithField(log.ErrorKey, err).Warningf("zone %s created, failed to get its nameservers for delegation", zone)
+		return
+	}
+	var nameservers []string
+	for _, z := range zones {
+		for _, r := range z.Records {
+			if r.Type == endpoint.RecordTypeNS && normalizeZone(r.Name) == zone {
+				nameservers = append(nameservers, r.ShortAnswers...)
+			}
+		}
+	}
+	if len(nameservers) == 0 {
+		logger.Warningf("zone %s created, delegate it to EdgeCenter nameservers from the control panel", zone)
+		return
+	}
+	logger.Warningf("zone %s created, delegate it from the parent zone to nameservers: %s", zone, strings.Join(nameservers, ", "))
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_zoneCreation_zoneFor(t *testing.T) {
+	p := &DnsProvider{}
+	WithZoneCreation([]string{"example.com.", "Dev.Example.com", ""}, 1)(p)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "www.app.example.com", want: "app.example.com"},
+		{name: "app.example.com.", want: "app.example.com"},
+		{name: "a.b.dev.example.com", want: "b.dev.example.com"},
+		{name: "dev.example.com", want: "dev.example.com"},
+		{name: "example.com", want: ""},
+		{name: "www.example.org", want: ""},
+		{name: "notexample.com", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.zoneCreation.zoneFor(tt.name); got != tt.want {
+				t.Errorf("zoneFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_WithZoneCreation_disabled(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		suffixes []string
+		limit    int
+	}{
+		{name: "no suffixes", limit: 1},
+		{name: "no limit", suffixes: []string{"example.com"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &DnsProvider{}
+			WithZoneCreation(tt.suffixes, tt.limit)(p)
+			if p.zoneCreation != nil {
+				t.Errorf("zone creation is enabled")
+			}
+		})
+	}
+}
+
+func Test_dnsProvider_createMissingZones(t *testing.T) {
+	client := &zonesClient{zones: []dns.Zone{{Name: "example.org"}}}
+	p := &DnsProvider{accounts: []*account{newAccount("main", client, nil)}}
+	WithZoneCreation([]string{"example.com", "example.net"}, 1)(p)
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.app.example.com", "A", 60, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("api.app.example.com", "A", 60, "1.1.1.2"),
+		endpoint.NewEndpointWithTTL("www.example.org", "A", 60, "1.1.1.3"),
+		endpoint.NewEndpointWithTTL("www.other.example.net", "A", 60, "1.1.1.4"),
+		endpoint.NewEndpointWithTTL("www.example.io", "A", 60, "1.1.1.5"),
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	zones := make([]string, 0, len(client.zones))
+	for _, z := range client.zones {
+		zones = append(zones, z.Name)
+	}
+	if want := []string{"example.org", "app.example.com"}; !reflect.DeepEqual(zones, want) {
+		t.Errorf("zones = %v, want %v", zones, want)
+	}
+	sort.Strings(client.created)
+	want := []string{
+		"app.example.com api.app.example.com A",
+		"app.example.com www.app.example.com A",
+		"example.org www.example.org A",
+	}
+	if !reflect.DeepEqual(client.created, want) {
+		t.Errorf("created = %v, want %v", client.created, want)
+	}
+}
+
+func Test_dnsProvider_createMissingZones_failedZoneIsNotCounted(t *testing.T) {
+	client := &zonesClient{failZone: "bad.example.com"}
+	p := &DnsProvider{accounts: []*account{newAccount("main", client, nil)}}
+	WithZoneCreation([]string{"example.com"}, 1)(p)
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.bad.example.com", "A", 60, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("www.good.example.com", "A", 60, "1.1.1.2"),
+	}})
+	if err == nil {
+		t.Error("ApplyChanges() expected error of failed zone")
+	}
+	if len(client.zones) != 1 || client.zones[0].Name != "good.example.com" {
+		t.Errorf("zones = %v, want good.example.com", client.zones)
+	}
+}
+
+func Test_dnsProvider_createMissingZones_partialIndexIsNotCached(t *testing.T) {
+	client := &zonesClient{}
+	broken := &clientMock{zonesWithRecords: func(context.Context, ...func(zone *dns.ZonesFilter)) ([]dns.Zone, error) {
+		return nil, errors.New("unavailable")
+	}}
+	p := &DnsProvider{accounts: []*account{newAccount("main", client, nil), newAccount("broken", broken, nil)}}
+	WithZoneCreation([]string{"example.com"}, 1)(p)
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.app.example.com", "A", 60, "1.1.1.1"),
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if len(client.zones) != 1 {
+		t.Errorf("zones = %v, want app.example.com", client.zones)
+	}
+	if idx := p.index.Load(); idx != nil {
+		t.Errorf("index built without zones of broken account is cached: %v", idx.zones)
+	}
+}
+
+func Test_dnsProvider_createMissingZones_dryRun(t *testing.T) {
+	client := &zonesClient{}
+	p := &DnsProvider{accounts: []*account{newAccount("main", client, nil)}, dryRun: true}
+	WithZoneCreation([]string{"example.com"}, 1)(p)
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.app.example.com", "A", 60, "1.1.1.1"),
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if len(client.zones) != 0 || len(client.created) != 0 {
+		t.Errorf("dry run changed zones %v, records %v", client.zones, client.created)
+	}
+}
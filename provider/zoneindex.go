@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"golang.org/x/net/idna"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// zoneIndexMaxAge is how long ApplyChanges reuses zone index built by Records
+var zoneIndexMaxAge = time.Minute
+
+// idnaProfile converts names to punycode, it allows underscores and wildcards used in DNS records
+var idnaProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.Transitional(false))
+
+// normalizeZone returns canonical form of DNS name: lower case punycode without leading and trailing dots
+func normalizeZone(name string) string {
+	name = strings.Trim(name, ".")
+	if ascii, err := idnaProfile.ToASCII(name); err == nil {
+		return ascii
+	}
+	return strings.ToLower(name)
+}
+
+// isSubdomain reports whether canonical name is zone or is below it
+func isSubdomain(name, zone string) bool {
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// inZones reports whether name is any of canonical zones or is below it
+func inZones(name string, zones []string) bool {
+	name = normalizeZone(name)
+	for _, z := range zones {
+		if isSubdomain(name, z) {
+			return true
+		}
+	}
+	return false
+}
+
+// zoneIndex finds zone and account serving a DNS name by the longest matching zone suffix
+type zoneIndex struct {
+	zones map[string]accountZone
+	// delegations are names of subzones delegated by NS records to nameservers outside of the parent zone
+	delegations map[string]struct{}
+	built       time.Time
+	// partial is set if zones of some accounts failed to be listed, such index isn't cached
+	partial bool
+}
+
+func newZoneIndex(zones []accountZone) *zoneIndex {
+	idx := &zoneIndex{
+		zones:       make(map[string]accountZone, len(zones)),
+		delegations: make(map[string]struct{}),
+		built:       time.Now(),
+	}
+	for _, z := range zones {
+		idx.add(z)
+	}
+	return idx
+}
+
+func (idx *zoneIndex) add(z accountZone) {
+	zone := normalizeZone(z.Name)
+	idx.zones[zone] = z
+	for _, r := range z.Records {
+		if r.Type != endpoint.RecordTypeNS {
+			continue
+		}
+		owner := normalizeZone(r.Name)
+		if owner == zone || !isSubdomain(owner, zone) {
+			continue
+		}
+		for _, ns := range r.ShortAnswers {
+			if !isSubdomain(normalizeZone(ns), zone) {
+				idx.delegations[owner] = struct{}{}
+				break
+			}
+		}
+	}
+}
+
+// with returns copy of index with zone served by acc added
+func (idx *zoneIndex) with(zone string, acc *account) *zoneIndex {
+	res := &zoneIndex{
+		zones:       make(map[string]accountZone, len(idx.zones)+1),
+		delegations: make(map[string]struct{}, len(idx.delegations)),
+		built:       idx.built,
+		partial:     idx.partial,
+	}
+	for k, v := range idx.zones {
+		res.zones[k] = v
+	}
+	for k := range idx.delegations {
+		res.delegations[k] = struct{}{}
+	}
+	res.add(accountZone{Zone: dns.Zone{Name: zone}, account: acc})
+	return res
+}
+
+// lookup returns zone serving name and account owning it.
+// skipReason is set if a record of recordType can't be written to name, zone is empty then.
+// Records under a delegated subzone are refused, except NS records of the delegation itself.
+func (idx *zoneIndex) lookup(name, recordType string) (zone string, acc *account, skipReason string) {
+	name = normalizeZone(name)
+
+	var found accountZone
+	var foundName string
+	for s := name; ; {
+		if z, ok := idx.zones[s]; ok {
+			found, foundName = z, s
+			break
+		}
+		i := strings.IndexByte(s, '.')
+		if i < 0 {
+			return "", nil, skipReasonNoZone
+		}
+		s = s[i+1:]
+	}
+
+	for s := name; s != foundName; s = s[strings.IndexByte(s, '.')+1:] {
+		if _, ok := idx.delegations[s]; !ok {
+			continue
+		}
+		if s == name && recordType == endpoint.RecordTypeNS {
+			break
+		}
+		return "", nil, skipReasonDelegated
+	}
+	return strings.Trim(found.Name, "."), found.account, ""
+}
+
+// zoneIndex returns index built by a recent Records call or builds a new one
+func (p *DnsProvider) zoneIndex(ctx context.Context) *zoneIndex {
+	if idx := p.index.Load(); idx != nil && time.Since(idx.built) < zoneIndexMaxAge {
+		return idx
+	}
+	zones, err := p.accountZones(ctx)
+	if err != nil {
+		log.Logger(ctx).Errorf("failed to get zones with records: %s", err)
+	}
+	idx := newZoneIndex(zones)
+	idx.partial = err != nil
+	if !idx.partial {
+		p.index.Store(idx)
+	}
+	return idx
+}
+
+// hasAnswer reports whether indexed zone records contain answer in RRSet of name and recordType
+func (idx *zoneIndex) hasAnswer(name, recordType, answer string) bool {
+	zone, _, reason := idx.lookup(name, recordType)
+	if reason != "" {
+		return false
+	}
+	z := idx.zones[normalizeZone(zone)]
+	for _, r := range z.Records {
+		if r.Type != recordType || !sameName(r.Name, name) {
+			continue
+		}
+		for _, a := range r.ShortAnswers {
+			if sameTarget(recordType, formatAnswer(recordType, a), answer) {
+				return true
+			}
+		}
+	}
+	return false
+}
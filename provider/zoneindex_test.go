@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	dns "github.com/Edge-Center/edgecenter-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_zoneIndex_lookup(t *testing.T) {
+	main := &account{alias: "main"}
+	other := &account{alias: "other"}
+	idx := newZoneIndex([]accountZone{
+		{Zone: dns.Zone{Name: "example.com", Records: []dns.ZoneRecord{
+			{Name: "example.com", Type: "NS", ShortAnswers: []string{"ns1.edgecenter.ru", "ns2.edgecenter.ru"}},
+			{Name: "ext.example.com", Type: "NS", ShortAnswers: []string{"ns1.other.net."}},
+			{Name: "int.example.com", Type: "NS", ShortAnswers: []string{"ns.example.com"}},
+			{Name: "Mixed.example.com", Type: "NS", ShortAnswers: []string{"ns.example.com", "NS.Other.net"}},
+		}}, account: main},
+		{Zone: dns.Zone{Name: "Sub.Example.com."}, account: other},
+		{Zone: dns.Zone{Name: "xn--e1afmkfd.xn--p1ai"}, account: main},
+	})
+
+	tests := []struct {
+		name       string
+		recordType string
+		wantZone   string
+		wantAcc    *account
+		wantReason string
+	}{
+		{name: "www.example.com", recordType: "A", wantZone: "example.com", wantAcc: main},
+		{name: "WWW.EXAMPLE.COM.", recordType: "A", wantZone: "example.com", wantAcc: main},
+		{name: "example.com", recordType: "A", wantZone: "example.com", wantAcc: main},
+		{name: "www.sub.example.com", recordType: "A", wantZone: "Sub.Example.com", wantAcc: other},
+		{name: "sub.example.com", recordType: "CNAME", wantZone: "Sub.Example.com", wantAcc: other},
+		{name: "www.пример.рф", recordType: "A", wantZone: "xn--e1afmkfd.xn--p1ai", wantAcc: main},
+		{name: "www.xn--e1afmkfd.xn--p1ai", recordType: "A", wantZone: "xn--e1afmkfd.xn--p1ai", wantAcc: main},
+		{name: "ext.example.com", recordType: "A", wantReason: skipReasonDelegated},
+		{name: "a.b.ext.example.com", recordType: "TXT", wantReason: skipReasonDelegated},
+		{name: "a.ext.example.com", recordType: "NS", wantReason: skipReasonDelegated},
+		{name: "ext.example.com", recordType: "NS", wantZone: "example.com", wantAcc: main},
+		{name: "mixed.example.com", recordType: "A", wantReason: skipReasonDelegated},
+		{name: "www.int.example.com", recordType: "A", wantZone: "example.com", wantAcc: main},
+		{name: "www.notexample.com", recordType: "A", wantReason: skipReasonNoZone},
+		{name: "com", recordType: "A", wantReason: skipReasonNoZone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.recordType, func(t *testing.T) {
+			zone, acc, reason := idx.lookup(tt.name, tt.recordType)
+			if zone != tt.wantZone || acc != tt.wantAcc || reason != tt.wantReason {
+				t.Errorf("lookup() = %q, %v, %q, want %q, %v, %q", zone, acc, reason, tt.wantZone, tt.wantAcc, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_zoneIndex_with(t *testing.T) {
+	acc := &account{alias: "main"}
+	idx := newZoneIndex([]accountZone{{Zone: dns.Zone{Name: "example.com"}, account: acc}})
+	extended := idx.with("app.example.org", acc)
+
+	if zone, _, _ := idx.lookup("www.app.example.org", "A"); zone != "" {
+		t.Errorf("with() changed original index")
+	}
+	if zone, _, _ := extended.lookup("www.app.example.org", "A"); zone != "app.example.org" {
+		t.Errorf("lookup() in extended index = %q", zone)
+	}
+	if zone, _, _ := extended.lookup("www.example.com", "A"); zone != "example.com" {
+		t.Errorf("lookup() of existing zone in extended index = %q", zone)
+	}
+}
+
+func Test_dnsProvider_zoneIndexReuse(t *testing.T) {
+	client := &zonesClient{zones: []dns.Zone{{Name: "example.com"}}}
+	p := &DnsProvider{accounts: []*account{newAccount("main", client, nil)}}
+	ctx := context.Background()
+
+	if _, err := p.Records(ctx); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	err := p.ApplyChanges(ctx, &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "1.1.1.1"),
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if client.calls != 1 {
+		t.Errorf("zones are fetched %d times, want ApplyChanges to reuse zones from Records", client.calls)
+	}
+}
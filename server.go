@@ -8,10 +8,12 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"syscall"
 	"time"
 
 	"github.com/Edge-Center/external-dns-ec-webhook/log"
+	"github.com/Edge-Center/external-dns-ec-webhook/metrics"
 	"github.com/Edge-Center/external-dns-ec-webhook/provider"
 	"github.com/go-chi/chi/v5"
 	"github.com/sirupsen/logrus"
@@ -24,32 +26,83 @@ const (
 	HeaderAccept      = "Accept"
 	HeaderVary        = "Vary"
 
-	ContentTypePlainText = "text/plain"
-	ContentTypeAppJson   = "application/external.dns.webhook+json;version=1"
+	// ContentTypeAppJson is media type of the first version of webhook protocol
+	ContentTypeAppJson = "application/external.dns.webhook+json;version=1"
 )
 
-var supportedMediaVersion = "application/external.dns.webhook+json;version=1"
-
 type Server struct {
 	*http.Server
 }
 
-func StartServer(p *provider.DnsProvider, addr string) {
+// ServerConfig describes how the webhook server listens for requests
+type ServerConfig struct {
+	Addr string
+	TLS  TLSConfig
+	Auth AuthConfig
+
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	// MaxBodyBytes limits request body of every route except /healthz and /metrics,
+	// read routes have no body, but it is read to check HMAC signature
+	MaxBodyBytes int64
+}
+
+const (
+	DefaultReadTimeout     = 10 * time.Second
+	DefaultWriteTimeout    = 60 * time.Second
+	DefaultIdleTimeout     = 60 * time.Second
+	DefaultShutdownTimeout = 30 * time.Second
+	DefaultMaxBodyBytes    = 10 << 20
+)
+
+func StartServer(p *provider.DnsProvider, cfg ServerConfig) {
 	logger := log.Logger(context.Background())
 
-	api := InitAPI(p)
+	api, err := InitAPI(p, cfg)
+	if err != nil {
+		logger.Fatalf("failed to init API: %s", err)
+	}
 	srv := &Server{
 		&http.Server{
-			Addr:    addr,
-			Handler: api,
+			Addr:              cfg.Addr,
+			Handler:           api,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
 		},
 	}
 
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go p.WatchTokens(watchCtx)
+	go p.WatchDrift(watchCtx)
+	go p.WatchFreeze(watchCtx)
+	go p.WatchJournal(watchCtx)
+
+	if cfg.TLS.Enabled() {
+		reloader, err := newTLSReloader(cfg.TLS)
+		if err != nil {
+			logger.Fatalf("failed to init TLS: %s", err)
+		}
+		srv.TLSConfig = reloader.TLSConfig()
+		go reloader.watch(watchCtx)
+	}
+
 	// start listening
 	go func() {
-		logger.Infof("starting listening on %s", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Fatalf("can't serve on addr %s", srv.Addr)
+		var err error
+		if srv.TLSConfig != nil {
+			logger.WithField("mtls", cfg.TLS.ClientCAFile != "").Infof("starting listening on %s over TLS", srv.Addr)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			logger.Infof("starting listening on %s", srv.Addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("can't serve on addr %s: %s", srv.Addr, err)
 		}
 	}()
 
@@ -58,61 +111,142 @@ func StartServer(p *provider.DnsProvider, addr string) {
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	sig := <-sigCh
 	logger.Infof("shutting down server due to received signal: %v", sig)
-	ctx, _ := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.WithField(log.ErrorKey, err).Error("error shutting down server")
 	}
+	if err := p.CloseAudit(ctx); err != nil {
+		logger.WithField(log.ErrorKey, err).Error("error closing audit sink")
+	}
+	if err := p.WaitNotifications(ctx); err != nil {
+		logger.WithField(log.ErrorKey, err).Error("error delivering notifications")
+	}
 }
 
 // InitAPI will create a router with the following API
 // - / (GET): initialization, negotiates headers and returns the domain filter
 // - /healthz (GET) health endpount for checking if app is up
+// - /metrics (GET) Prometheus metrics
 // - /records (GET): returns the current records
 // - /records (POST): applies the changes
 // - /adjustendpoints (POST): executes the AdjustEndpoints method
-func InitAPI(p *provider.DnsProvider) *chi.Mux {
-	r := chi.NewRouter()
+// - /debug/drift (GET): returns the last drift check report, 404 if drift detection is disabled
+// - /approvals (GET): lists changes held for approval, 404 if approvals are disabled
+// - /approvals/{id}/approve, /approvals/{id}/reject (POST): decide on a held change
+// Read-only, mutating and admin routes are protected according to cfg.Auth, /healthz and /metrics are always open.
+func InitAPI(p *provider.DnsProvider, cfg ServerConfig) (*chi.Mux, error) {
+	readAuth, err := newAuthMiddleware(cfg.Auth.Read)
+	if err != nil {
+		return nil, fmt.Errorf("read routes auth: %w", err)
+	}
+	writeAuth, err := newAuthMiddleware(cfg.Auth.Write)
+	if err != nil {
+		return nil, fmt.Errorf("write routes auth: %w", err)
+	}
+	adminRule := cfg.Auth.Admin
+	if !adminRule.Enabled() {
+		adminRule = cfg.Auth.Write
+	}
+	adminAuth, err := newAuthMiddleware(adminRule)
+	if err != nil {
+		return nil, fmt.Errorf("admin routes auth: %w", err)
+	}
+
+	router := chi.NewRouter()
+	router.Use(traceRequest, recoverPanic)
 
 	//
 	// GET /healthz
-	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+	router.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	//
+	// GET /metrics
+	router.Method(http.MethodGet, "/metrics", metrics.Handler())
+
+	router.Group(func(r chi.Router) {
+		r.Use(limitBody(cfg.MaxBodyBytes), readAuth)
+		initReadRoutes(r, p)
+	})
+	router.Group(func(r chi.Router) {
+		r.Use(limitBody(cfg.MaxBodyBytes), writeAuth)
+		initWriteRoutes(r, p)
+	})
+	router.Group(func(r chi.Router) {
+		r.Use(limitBody(cfg.MaxBodyBytes), adminAuth)
+		initAdminRoutes(r, p)
+	})
+
+	return router, nil
+}
+
+// traceRequest adds tracing ID to request ctx, so all logs of a request can be correlated
+func traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(log.Trace(r.Context())))
+	})
+}
+
+// recoverPanic turns a panic in a handler into 500 response instead of crashing the whole webhook
+func recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			logWithReqInfo(r).
+				WithField("panic", rec).
+				WithField("stack", string(debug.Stack())).
+				Error("recovered from panic in handler")
+			writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, errors.New("internal server error"))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitBody restricts size of request body, reading beyond the limit fails with *http.MaxBytesError
+func limitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes > 0 && r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func initReadRoutes(r chi.Router, p *provider.DnsProvider) {
+
 	//
 	// GET /
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		r = r.WithContext(log.Trace(r.Context()))
 		logger := logWithReqInfo(r)
 		logger.Debug("GET /")
 
-		err := checkHeaders(w, r)
+		version, err := checkHeaders(w, r)
 		if err != nil {
 			logger.WithField(log.ErrorKey, err).Error("failed header check")
 			return
 		}
-		b, err := p.GetDomainFilter(r.Context()).MarshalJSON()
-		if err != nil {
-			logger.WithField(log.ErrorKey, err).Error("failed to marshal domain filter")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set(HeaderContentType, ContentTypeAppJson)
-		if _, err = w.Write(b); err != nil {
-			logger.WithField(log.ErrorKey, err).Error("failed to write response")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+
+		w.Header().Set(HeaderVary, HeaderAccept)
+		writeJSON(w, r, contentTypeForVersion(version), p.GetDomainFilter(r.Context()))
 	})
 
 	//
 	// GET /records
 	r.Get("/records", func(w http.ResponseWriter, r *http.Request) {
-		r = r.WithContext(log.Trace(r.Context()))
 		logger := logWithReqInfo(r)
 		logger.Debug("GET /records")
 
-		err := checkHeaders(w, r)
+		version, err := checkHeaders(w, r)
 		if err != nil {
 			logger.WithField(log.ErrorKey, err).Error("failed header check")
 			return
@@ -121,28 +255,36 @@ func InitAPI(p *provider.DnsProvider) *chi.Mux {
 		records, err := p.Records(r.Context())
 		if err != nil {
 			logger.WithField(log.ErrorKey, err).Error("failed to get records from provider")
-			w.WriteHeader(http.StatusInternalServerError)
+			writeProviderError(w, r, err)
 			return
 		}
 
 		logger.Infof("found %d records", len(records))
 
-		w.Header().Set(HeaderContentType, ContentTypeAppJson)
-		w.Header().Set(HeaderVary, HeaderContentType)
+		w.Header().Set(HeaderVary, HeaderAccept)
+		writeJSON(w, r, contentTypeForVersion(version), records)
+	})
 
-		err = json.NewEncoder(w).Encode(records)
-		if err != nil {
-			logger.WithField(log.ErrorKey, err).Error("failed to encode records")
-			w.WriteHeader(http.StatusInternalServerError)
+	//
+	// GET /debug/drift
+	r.Get("/debug/drift", func(w http.ResponseWriter, r *http.Request) {
+		logWithReqInfo(r).Debug("GET /debug/drift")
+
+		report, ok := p.DriftReport()
+		if !ok {
+			writeError(w, r, http.StatusNotFound, ErrCodeNotFound, errors.New("drift detection is disabled"))
 			return
 		}
+		writeJSON(w, r, ContentTypeJson, report)
 	})
+}
+
+func initWriteRoutes(r chi.Router, p *provider.DnsProvider) {
 	r.Post("/records", func(w http.ResponseWriter, r *http.Request) {
-		r = r.WithContext(log.Trace(r.Context()))
 		logger := logWithReqInfo(r)
 		logger.Info("POST /records")
 
-		err := checkHeaders(w, r)
+		_, err := checkHeaders(w, r)
 		if err != nil {
 			logger.WithField(log.ErrorKey, err).Error("failed header check")
 			return
@@ -151,30 +293,22 @@ func InitAPI(p *provider.DnsProvider) *chi.Mux {
 		changes := &plan.Changes{}
 		if err = json.NewDecoder(r.Body).Decode(changes); err != nil {
 			logger.WithField(log.ErrorKey, err).Warning("failed to decode changes")
-
-			w.Header().Set(HeaderContentType, ContentTypePlainText)
-			errMsg := fmt.Sprintf("failed to decode changes: %s", err)
-			if _, err = fmt.Fprint(w, errMsg); err != nil {
-				logger.WithField(log.ErrorKey, err).Error("failed to write error message to response")
-			}
-
-			w.WriteHeader(http.StatusBadRequest)
+			writeDecodeError(w, r, fmt.Errorf("failed to decode changes: %w", err))
 			return
 		}
 
 		if err = p.ApplyChanges(r.Context(), changes); err != nil {
 			logger.WithField(log.ErrorKey, err).Error("failed to apply changes")
-			w.WriteHeader(http.StatusInternalServerError)
+			writeProviderError(w, r, err)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 	})
 	r.Post("/adjustendpoints", func(w http.ResponseWriter, r *http.Request) {
-		r = r.WithContext(log.Trace(r.Context()))
 		logger := logWithReqInfo(r)
 		logger.Info("POST /adjustendpoints")
 
-		err := checkHeaders(w, r)
+		version, err := checkHeaders(w, r)
 		if err != nil {
 			logger.WithField(log.ErrorKey, err).Error("failed header check")
 			return
@@ -183,81 +317,83 @@ func InitAPI(p *provider.DnsProvider) *chi.Mux {
 		endpoints := make([]*endpoint.Endpoint, 0)
 		if err = json.NewDecoder(r.Body).Decode(&endpoints); err != nil {
 			logger.WithField(log.ErrorKey, err).Warning("failed to decode endpoints for adjustment")
-
-			w.Header().Set(HeaderContentType, ContentTypePlainText)
-			errMsg := fmt.Sprintf("failed to decode endpoints for adjustment: %s", err)
-			if _, err = fmt.Fprint(w, errMsg); err != nil {
-				logger.WithField(log.ErrorKey, err).Error("failed to write error message to response")
-			}
-
-			w.WriteHeader(http.StatusBadRequest)
+			writeDecodeError(w, r, fmt.Errorf("failed to decode endpoints for adjustment: %w", err))
 			return
 		}
 
 		endpoints, err = p.AdjustEndpoints(endpoints)
 		if err != nil {
 			logger.WithField(log.ErrorKey, err).Error("failed to adjust endpoints")
-			w.WriteHeader(http.StatusInternalServerError)
+			writeProviderError(w, r, err)
 			return
 		}
 
-		w.Header().Set(HeaderContentType, ContentTypeAppJson)
-		w.Header().Set(HeaderVary, HeaderContentType)
-		err = json.NewEncoder(w).Encode(endpoints)
-		if err != nil {
-			logger.WithField(log.ErrorKey, err).Error("failed to encode endpoints")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		w.Header().Set(HeaderVary, HeaderAccept+", "+HeaderContentType)
+		writeJSON(w, r, contentTypeForVersion(version), endpoints)
 	})
-
-	return r
 }
 
-func checkHeaders(w http.ResponseWriter, r *http.Request) error {
-	var header string
-	logger := logWithReqInfo(r)
-	if r.Method == http.MethodPost {
-		header = r.Header.Get(HeaderContentType)
-	} else {
-		header = r.Header.Get(HeaderAccept)
-	}
-
-	logger.WithField("header", header).Debug("start validating header")
+func initAdminRoutes(r chi.Router, p *provider.DnsProvider) {
 
-	if len(header) == 0 {
-		w.Header().Set(HeaderContentType, ContentTypePlainText)
-		w.WriteHeader(http.StatusBadRequest)
+	//
+	// GET /approvals
+	r.Get("/approvals", func(w http.ResponseWriter, r *http.Request) {
+		logWithReqInfo(r).Debug("GET /approvals")
 
-		var err error
-		if r.Method == http.MethodPost {
-			err = errors.New("'Content-Type' header is required")
-		} else {
-			err = errors.New("'Accept' header is required")
-		}
-		if _, writeEr := fmt.Fprint(w, err); writeEr != nil {
-			logWithReqInfo(r).WithField(log.ErrorKey, writeEr).Fatal("got error on writing error message to response writer")
+		approvals, ok := p.Approvals()
+		if !ok {
+			writeError(w, r, http.StatusNotFound, ErrCodeNotFound, errors.New("approvals are disabled"))
+			return
 		}
-		return err
-	}
-
-	if header != supportedMediaVersion {
-		w.Header().Set(HeaderContentType, ContentTypePlainText)
-		w.WriteHeader(http.StatusUnsupportedMediaType)
+		writeJSON(w, r, ContentTypeJson, approvals)
+	})
 
-		var err error
-		if r.Method == http.MethodPost {
-			err = errors.New("valid media type is required in 'Content-Type' header")
-		} else {
-			err = errors.New("valid media type is required in 'Accept' header")
-		}
-		if _, writeEr := fmt.Fprint(w, err); writeEr != nil {
-			logger.WithField(log.ErrorKey, writeEr).Fatal("got error on writing error message to response writer")
+	//
+	// POST /approvals/{id}/approve, POST /approvals/{id}/reject
+	decide := func(approve bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			logger := logWithReqInfo(r)
+			logger.Info("POST " + r.URL.Path)
+
+			approval, err := p.DecideApproval(r.Context(), chi.URLParam(r, "id"), approve)
+			if errors.Is(err, provider.ErrApprovalNotFound) {
+				writeError(w, r, http.StatusNotFound, ErrCodeNotFound, err)
+				return
+			}
+			if err != nil {
+				logger.WithField(log.ErrorKey, err).Error("failed to decide on approval")
+				writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err)
+				return
+			}
+			writeJSON(w, r, ContentTypeJson, approval)
 		}
-		return err
 	}
+	r.Post("/approvals/{id}/approve", decide(true))
+	r.Post("/approvals/{id}/reject", decide(false))
+}
 
-	return nil
+// checkHeaders validates media type headers and returns negotiated protocol version,
+// on failure the error response is already written
+func checkHeaders(w http.ResponseWriter, r *http.Request) (string, error) {
+	logger := logWithReqInfo(r)
+	logger.
+		WithField("accept", r.Header.Get(HeaderAccept)).
+		WithField("content_type", r.Header.Get(HeaderContentType)).
+		Debug("start validating headers")
+
+	version, err := negotiateVersion(r)
+	var hErr *headerError
+	switch {
+	case err == nil:
+		return version, nil
+	case errors.Is(err, errNoMediaType):
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err)
+	case errors.As(err, &hErr) && hErr.header == HeaderContentType:
+		writeError(w, r, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType, err)
+	default:
+		writeError(w, r, http.StatusNotAcceptable, ErrCodeNotAcceptable, err)
+	}
+	return "", err
 }
 
 // logWithReqInfo uses traced(!) ctx and info from request to log valuable debug fields
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInitAPI_hardening(t *testing.T) {
+	api, err := InitAPI(nil, ServerConfig{MaxBodyBytes: 16})
+	if err != nil {
+		t.Fatalf("InitAPI() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{
+			// provider is nil, so the handler panics
+			name:   "panic is recovered",
+			method: http.MethodGet,
+			path:   "/records",
+			want:   http.StatusInternalServerError,
+		},
+		{
+			name:   "body over limit",
+			method: http.MethodPost,
+			path:   "/records",
+			body:   `{"Create": [{"dnsName": "test.example.com"}]}`,
+			want:   http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "body over limit on adjustendpoints",
+			method: http.MethodPost,
+			path:   "/adjustendpoints",
+			body:   `[{"dnsName": "test.example.com"}]`,
+			want:   http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(HeaderAccept, ContentTypeAppJson)
+			req.Header.Set(HeaderContentType, ContentTypeAppJson)
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Edge-Center/external-dns-ec-webhook/log"
+)
+
+// tlsReloadInterval is how often cert, key and client CA files are checked for rotation
+var tlsReloadInterval = 30 * time.Second
+
+// TLSConfig describes TLS settings of the webhook server.
+// Server is started over plain HTTP if CertFile and KeyFile are empty.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS: client certificates are required and verified against this bundle
+	ClientCAFile string
+	// MinVersion is one of "1.0", "1.1", "1.2", "1.3", default is "1.2"
+	MinVersion string
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+func (c TLSConfig) validate() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("both TLS cert and key files must be set")
+	}
+	_, err := parseTLSVersion(c.MinVersion)
+	return err
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(v)), "TLS") {
+	case "":
+		return tls.VersionTLS12, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version '%s'", v)
+}
+
+// tlsReloader keeps cert, key and client CA bundle loaded from files
+// and swaps them when files are rotated, without restarting the server
+type tlsReloader struct {
+	cfg   TLSConfig
+	base  *tls.Config
+	state atomic.Pointer[tlsState]
+}
+
+type tlsState struct {
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamp     string
+}
+
+func newTLSReloader(cfg TLSConfig) (*tlsReloader, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	minVersion, _ := parseTLSVersion(cfg.MinVersion)
+
+	r := &tlsReloader{
+		cfg: cfg,
+		base: &tls.Config{
+			MinVersion: minVersion,
+		},
+	}
+	if cfg.ClientCAFile != "" {
+		r.base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns server TLS config that always serves the latest loaded files
+func (r *tlsReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: r.base.MinVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			st := r.state.Load()
+			c := r.base.Clone()
+			c.Certificates = []tls.Certificate{*st.cert}
+			c.ClientCAs = st.clientCAs
+			return c, nil
+		},
+	}
+}
+
+// reload reads files if they were changed since the last load, returns true if state was swapped
+func (r *tlsReloader) reload() (bool, error) {
+	stamp, err := r.filesStamp()
+	if err != nil {
+		return false, err
+	}
+	if cur := r.state.Load(); cur != nil && cur.stamp == stamp {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	st := &tlsState{cert: &cert, stamp: stamp}
+
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		st.clientCAs = x509.NewCertPool()
+		if !st.clientCAs.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("no certificates found in client CA file '%s'", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.state.Store(st)
+	return true, nil
+}
+
+// filesStamp builds a fingerprint of watched files from their size and modification time
+func (r *tlsReloader) filesStamp() (string, error) {
+	var sb strings.Builder
+	for _, f := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat TLS file: %w", err)
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d;", f, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
+
+// watch polls files until ctx is done, keeping the previous state if new files are broken
+func (r *tlsReloader) watch(ctx context.Context) {
+	logger := log.Logger(ctx)
+	ticker := time.NewTicker(tlsReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				logger.WithField(log.ErrorKey, err).Error("failed to reload TLS files, keep serving previous ones")
+				continue
+			}
+			if reloaded {
+				logger.Info("TLS files reloaded")
+			}
+		}
+	}
+}
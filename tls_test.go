@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{"localhost"},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	parentCert, parentKey := tmpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_parseTLSVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint16
+		wantErr bool
+	}{
+		{in: "", want: tls.VersionTLS12},
+		{in: "1.3", want: tls.VersionTLS13},
+		{in: "TLS1.1", want: tls.VersionTLS11},
+		{in: "tls13", want: tls.VersionTLS13},
+		{in: "2.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseTLSVersion(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTLSVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseTLSVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_tlsReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, true)
+	server := newTestCert(t, "server", ca, false)
+	client := newTestCert(t, "client", ca, false)
+
+	cfg := TLSConfig{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	writeFile(t, cfg.CertFile, server.certPEM)
+	writeFile(t, cfg.KeyFile, server.keyPEM)
+	writeFile(t, cfg.ClientCAFile, ca.certPEM)
+
+	reloader, err := newTLSReloader(cfg)
+	if err != nil {
+		t.Fatalf("newTLSReloader() error = %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = reloader.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCert, _ := tls.X509KeyPair(client.certPEM, client.keyPEM)
+
+	get := func(certs ...tls.Certificate) (*x509.Certificate, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: certs,
+		}}}
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return resp.TLS.PeerCertificates[0], nil
+	}
+
+	if _, err = get(); err == nil {
+		t.Error("expected handshake failure without client certificate")
+	}
+	peer, err := get(clientCert)
+	if err != nil {
+		t.Fatalf("request with client certificate failed: %v", err)
+	}
+	if !peer.Equal(server.cert) {
+		t.Error("unexpected server certificate")
+	}
+
+	rotated := newTestCert(t, "server-rotated", ca, false)
+	writeFile(t, cfg.CertFile, rotated.certPEM)
+	writeFile(t, cfg.KeyFile, rotated.keyPEM)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(cfg.CertFile, future, future)
+
+	if reloaded, err := reloader.reload(); err != nil || !reloaded {
+		t.Fatalf("reload() = %v, %v", reloaded, err)
+	}
+	peer, err = get(clientCert)
+	if err != nil {
+		t.Fatalf("request after rotation failed: %v", err)
+	}
+	if !peer.Equal(rotated.cert) {
+		t.Error("rotated server certificate is not served")
+	}
+
+	writeFile(t, cfg.KeyFile, []byte("broken"))
+	_ = os.Chtimes(cfg.KeyFile, future.Add(time.Minute), future.Add(time.Minute))
+	if _, err = reloader.reload(); err == nil {
+		t.Error("expected reload error for broken key")
+	}
+	if peer, err = get(clientCert); err != nil || !peer.Equal(rotated.cert) {
+		t.Error("previous certificate must be kept after failed reload")
+	}
+}